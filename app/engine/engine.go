@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"strconv"
 	"sync"
 	"time"
 )
@@ -8,6 +9,122 @@ import (
 type DbStore struct {
 	Dict *map[string]RedisObj
 	Mu   *sync.RWMutex
+	// Replica is set when the keyspace is replicated from a master, which alone decides expiration:
+	// expired keys are then hidden by the lookups of clients but only deleted by the DEL of the master
+	Replica bool
+	// FromMaster is set while a command of the master runs, its lookups find the keys the master
+	// still considers live however late the clock of the replica is
+	FromMaster bool
+
+	// expired keys found by lookups, taken by the master to delete and propagate them, and
+	// those modified since, whose expired value the modification replaced
+	expiredMu sync.Mutex
+	expired   map[string]struct{}
+	replaced  map[string]struct{}
+
+	// watches of WATCH by key
+	watchMu sync.Mutex
+	watched map[string]map[*Watch]struct{}
+
+	// keys of Dict for SCAN and RANDOMKEY, built on first use then updated with the keys
+	// touched since the last use
+	indexMu sync.Mutex
+	index   *ScanIndex
+	indexed *map[string]RedisObj
+	touched map[string]struct{}
+}
+
+// Lookup returns the object stored at key, or nil when the key does not exist
+// or has already expired. The caller must hold Mu.
+// Lookups may hold the read lock only, so an expired key is queued for TakeExpired
+// instead of being deleted here.
+func (db *DbStore) Lookup(key string) RedisObj {
+	obj, ok := (*db.Dict)[key]
+	if !ok {
+		return nil
+	}
+	if db.Replica && db.FromMaster {
+		return obj
+	}
+	if obj.Value() == nil {
+		if !db.Replica {
+			db.expiredMu.Lock()
+			if db.expired == nil {
+				db.expired = make(map[string]struct{})
+			}
+			db.expired[key] = struct{}{}
+			db.expiredMu.Unlock()
+		}
+		return nil
+	}
+	return obj
+}
+
+// TakeExpired returns the expired keys found by lookups since the last call, the keys
+// modified since they were found are returned in replaced and need no deletion
+func (db *DbStore) TakeExpired() (expired []string, replaced []string) {
+	db.expiredMu.Lock()
+	defer db.expiredMu.Unlock()
+	for key := range db.expired {
+		expired = append(expired, key)
+	}
+	for key := range db.replaced {
+		replaced = append(replaced, key)
+	}
+	db.expired = nil
+	db.replaced = nil
+	return expired, replaced
+}
+
+// replaceExpired moves key from the expired keys to the replaced ones when it is modified
+func (db *DbStore) replaceExpired(key string) {
+	db.expiredMu.Lock()
+	defer db.expiredMu.Unlock()
+	if _, ok := db.expired[key]; !ok {
+		return
+	}
+	delete(db.expired, key)
+	if db.replaced == nil {
+		db.replaced = make(map[string]struct{})
+	}
+	db.replaced[key] = struct{}{}
+}
+
+// DeleteIfExpired deletes key if it is still expired, a key written again since it was
+// found expired is kept. The caller must hold Mu.
+func (db *DbStore) DeleteIfExpired(key string) bool {
+	obj, ok := (*db.Dict)[key]
+	if !ok || obj.Value() != nil {
+		return false
+	}
+	delete(*db.Dict, key)
+	db.Touch(key)
+	return true
+}
+
+// ExpireSample visits the keys in the random order of map iteration and deletes the expired
+// ones among the first sample keys having a TTL. At most scanLimit keys are visited so that
+// a keyspace with few volatile keys is not walked entirely. It returns how many keys with
+// a TTL were sampled and the deleted keys. The caller must hold Mu.
+func (db *DbStore) ExpireSample(sample int, scanLimit int) (sampled int, expired []string) {
+	now := time.Now()
+	visited := 0
+	for key, obj := range *db.Dict {
+		if visited >= scanLimit || sampled >= sample {
+			break
+		}
+		visited++
+		if !obj.HasExpiration() {
+			continue
+		}
+		sampled++
+		if obj.GetExpiration().Before(now) {
+			delete(*db.Dict, key)
+			db.Touch(key)
+			expired = append(expired, key)
+		}
+	}
+	return sampled, expired
 }
 
 type RedisObj interface {
@@ -16,15 +133,100 @@ type RedisObj interface {
 	HasExpiration() bool
 	GetExpiration() time.Time
 }
+
+// WithExpiration returns obj expiring at expiration, the zero time makes it persistent
+func WithExpiration(obj RedisObj, expiration time.Time) RedisObj {
+	switch o := obj.(type) {
+	case RedisString:
+		o.Expiration = expiration
+		return o
+	case RedisList:
+		o.Expiration = expiration
+		return o
+	case RedisHash:
+		o.Expiration = expiration
+		return o
+	case RedisSet:
+		o.Expiration = expiration
+		return o
+	case RedisZSet:
+		o.Expiration = expiration
+		return o
+	case RedisStream:
+		o.Expiration = expiration
+		return o
+	}
+	return obj
+}
+
+// CopyObject returns a deep copy of obj, so that the copy can be modified independently
+func CopyObject(obj RedisObj) RedisObj {
+	switch o := obj.(type) {
+	case RedisList:
+		o.Data = append([]string(nil), o.Data...)
+		return o
+	case RedisHash:
+		data := make(map[string]string, len(o.Data))
+		for field, value := range o.Data {
+			data[field] = value
+		}
+		copied := NewRedisHash(data)
+		copied.Expiration = o.Expiration
+		return copied
+	case RedisSet:
+		data := make(map[string]struct{}, len(o.Data))
+		for member := range o.Data {
+			data[member] = struct{}{}
+		}
+		copied := NewRedisSet(data)
+		copied.Expiration = o.Expiration
+		return copied
+	case RedisZSet:
+		copied := NewRedisZSet()
+		for member, score := range o.Data {
+			copied.Add(member, score)
+		}
+		copied.Expiration = o.Expiration
+		return copied
+	case RedisStream:
+		o.Data = o.Data.Copy()
+		return o
+	}
+	return obj
+}
+
 type RedisString struct {
-	Data       string
+	Data string
+	// integer-valued strings are stored in Int with IsInt set, Data is empty then
+	Int        int64
+	IsInt      bool
 	Expiration time.Time
 }
 type RedisList struct {
 	Data       []string
 	Expiration time.Time
 }
+type RedisHash struct {
+	Data map[string]string
+	// Buckets indexes the fields of Data for HSCAN, nil in a hash built without NewRedisHash
+	Buckets    *ScanIndex
+	Expiration time.Time
+}
+type RedisSet struct {
+	Data map[string]struct{}
+	// Buckets indexes the members of Data for SSCAN, nil in a set built without NewRedisSet
+	Buckets    *ScanIndex
+	Expiration time.Time
+}
+type RedisZSet struct {
+	Data  map[string]float64
+	Index *SkipList
+	// Buckets indexes the members of Data for ZSCAN
+	Buckets    *ScanIndex
+	Expiration time.Time
+}
 type RedisStream struct {
+	Data       *Stream
 	Expiration time.Time
 }
 
@@ -65,13 +267,204 @@ func (r RedisList) GetExpiration() time.Time {
 	return r.Expiration
 }
 
+// NewRedisHash returns the hash holding data
+func NewRedisHash(data map[string]string) RedisHash {
+	return RedisHash{Data: data, Buckets: NewScanIndex(data)}
+}
+
+// Set sets field to value, it returns false if field already existed
+func (r RedisHash) Set(field string, value string) bool {
+	_, exists := r.Data[field]
+	r.Data[field] = value
+	if !exists && r.Buckets != nil {
+		r.Buckets.Add(field)
+	}
+	return !exists
+}
+
+// Delete deletes field, it returns false if field does not exist
+func (r RedisHash) Delete(field string) bool {
+	if _, ok := r.Data[field]; !ok {
+		return false
+	}
+	delete(r.Data, field)
+	if r.Buckets != nil {
+		r.Buckets.Remove(field)
+	}
+	return true
+}
+
+func (r RedisHash) Type() string {
+	return "HASH"
+}
+func (r RedisHash) Value() interface{} {
+	expiration := r.Expiration
+	if expiration.Compare(time.Now()) >= 0 || expiration.IsZero() {
+		return r.Data
+	}
+	return nil
+}
+func (r RedisHash) HasExpiration() bool {
+	return !r.Expiration.IsZero()
+}
+func (r RedisHash) GetExpiration() time.Time {
+	return r.Expiration
+}
+
+// NewRedisSet returns the set holding data
+func NewRedisSet(data map[string]struct{}) RedisSet {
+	return RedisSet{Data: data, Buckets: NewScanIndex(data)}
+}
+
+// Add inserts member, it returns false if member is already in the set
+func (r RedisSet) Add(member string) bool {
+	if _, ok := r.Data[member]; ok {
+		return false
+	}
+	r.Data[member] = struct{}{}
+	if r.Buckets != nil {
+		r.Buckets.Add(member)
+	}
+	return true
+}
+
+// Remove deletes member, it returns false if member is not in the set
+func (r RedisSet) Remove(member string) bool {
+	if _, ok := r.Data[member]; !ok {
+		return false
+	}
+	delete(r.Data, member)
+	if r.Buckets != nil {
+		r.Buckets.Remove(member)
+	}
+	return true
+}
+
+func (r RedisSet) Type() string {
+	return "SET"
+}
+func (r RedisSet) Value() interface{} {
+	expiration := r.Expiration
+	if expiration.Compare(time.Now()) >= 0 || expiration.IsZero() {
+		return r.Data
+	}
+	return nil
+}
+func (r RedisSet) HasExpiration() bool {
+	return !r.Expiration.IsZero()
+}
+func (r RedisSet) GetExpiration() time.Time {
+	return r.Expiration
+}
+
+func NewRedisZSet() RedisZSet {
+	return RedisZSet{
+		Data:    make(map[string]float64),
+		Index:   NewSkipList(),
+		Buckets: NewScanIndex[float64](nil),
+	}
+}
+
+// Add inserts member or updates its score
+func (r RedisZSet) Add(member string, score float64) {
+	if old, ok := r.Data[member]; ok {
+		if old == score {
+			return
+		}
+		r.Index.Delete(old, member)
+	} else {
+		r.Buckets.Add(member)
+	}
+	r.Data[member] = score
+	r.Index.Insert(score, member)
+}
+
+// Remove deletes member, it returns false if member is not in the set
+func (r RedisZSet) Remove(member string) bool {
+	score, ok := r.Data[member]
+	if !ok {
+		return false
+	}
+	delete(r.Data, member)
+	r.Index.Delete(score, member)
+	r.Buckets.Remove(member)
+	return true
+}
+
+// Rank returns the 0-based rank of member in ascending order
+func (r RedisZSet) Rank(member string) (int, bool) {
+	score, ok := r.Data[member]
+	if !ok {
+		return 0, false
+	}
+	return r.Index.Rank(score, member) - 1, true
+}
+
+func (r RedisZSet) Len() int {
+	return len(r.Data)
+}
+
+func (r RedisZSet) Type() string {
+	return "ZSET"
+}
+func (r RedisZSet) Value() interface{} {
+	expiration := r.Expiration
+	if expiration.Compare(time.Now()) >= 0 || expiration.IsZero() {
+		return r.Data
+	}
+	return nil
+}
+func (r RedisZSet) HasExpiration() bool {
+	return !r.Expiration.IsZero()
+}
+func (r RedisZSet) GetExpiration() time.Time {
+	return r.Expiration
+}
+
+// NewRedisString stores value with the integer encoding when it is the canonical form of an int64
+func NewRedisString(value string, expiration time.Time) RedisString {
+	if n, ok := ParseInt64(value); ok {
+		return RedisString{Int: n, IsInt: true, Expiration: expiration}
+	}
+	return RedisString{Data: value, Expiration: expiration}
+}
+
+// ParseInt64 parses s as redis does: no sign other than a leading -, no spaces
+// and no leading zeros, so that only the canonical form of an integer is accepted
+func ParseInt64(s string) (int64, bool) {
+	if len(s) == 0 || len(s) > 20 {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || strconv.FormatInt(n, 10) != s {
+		return 0, false
+	}
+	return n, true
+}
+
+// String returns the value whatever its encoding
+func (r RedisString) String() string {
+	if r.IsInt {
+		return strconv.FormatInt(r.Int, 10)
+	}
+	return r.Data
+}
+
+// Int64 returns the value as an integer, ok is false when it is not one
+func (r RedisString) Int64() (int64, bool) {
+	if r.IsInt {
+		return r.Int, true
+	}
+	return ParseInt64(r.Data)
+}
+
 func (r RedisString) Type() string {
 	return "STRING"
 }
 func (r RedisString) Value() interface{} {
 	expiration := r.Expiration
 	if expiration.Compare(time.Now()) >= 0 || expiration.IsZero() {
-		return r.Data
+		return r.String()
 	}
 	return nil
 }
@@ -0,0 +1,195 @@
+package engine
+
+import (
+	"hash/maphash"
+	"math/bits"
+	"math/rand"
+	"slices"
+)
+
+// Cursor-based iteration of the keyspace and of collections, for SCAN and the per-type scans.
+// A ScanIndex holds the keys of a map spread by hash over a table of 2^n buckets, and is
+// maintained on every insert and delete so that a call visits only the buckets it returns.
+// The table grows when it holds more keys than buckets and shrinks when it is less than an
+// eighth full, rehashing at once.
+// Like dictScan in redis the cursor is the next bucket to visit and is incremented on its
+// reversed bits, so when the table grows or shrinks between two calls the buckets already
+// visited map to buckets already visited: every key present for the whole iteration is
+// returned, some maybe twice.
+
+// scanSeed lives as long as the process so that cursors stay valid between calls
+var scanSeed = maphash.MakeSeed()
+
+// the smallest table has 4 buckets like the dict of redis
+const scanMinTableBits = 2
+
+// a call visits at most this many buckets per element asked, so that a sparse table does
+// not make it long
+const scanEmptyVisits = 10
+
+type ScanIndex struct {
+	buckets [][]string
+	count   int
+}
+
+// NewScanIndex returns the index of the keys of m
+func NewScanIndex[V any](m map[string]V) *ScanIndex {
+	s := &ScanIndex{}
+	s.resize(tableSize(len(m)))
+	for key := range m {
+		b := s.bucket(key)
+		s.buckets[b] = append(s.buckets[b], key)
+	}
+	s.count = len(m)
+	return s
+}
+
+// ScanIndexOf returns s when it indexes the keys of m, or a new index of them otherwise,
+// for collections created without one
+func ScanIndexOf[V any](s *ScanIndex, m map[string]V) *ScanIndex {
+	if s == nil || s.count != len(m) {
+		return NewScanIndex(m)
+	}
+	return s
+}
+
+// tableSize is the smallest table holding count keys, with one key per bucket at most
+func tableSize(count int) int {
+	size := 1 << scanMinTableBits
+	for size < count {
+		size <<= 1
+	}
+	return size
+}
+
+func (s *ScanIndex) bucket(key string) int {
+	return int(maphash.String(scanSeed, key) & uint64(len(s.buckets)-1))
+}
+
+func (s *ScanIndex) resize(size int) {
+	old := s.buckets
+	s.buckets = make([][]string, size)
+	for _, bucket := range old {
+		for _, key := range bucket {
+			b := s.bucket(key)
+			s.buckets[b] = append(s.buckets[b], key)
+		}
+	}
+}
+
+func (s *ScanIndex) Len() int {
+	return s.count
+}
+
+// Add indexes key, it returns false if key was already indexed
+func (s *ScanIndex) Add(key string) bool {
+	b := s.bucket(key)
+	if slices.Contains(s.buckets[b], key) {
+		return false
+	}
+	s.buckets[b] = append(s.buckets[b], key)
+	s.count++
+	if s.count > len(s.buckets) {
+		s.resize(2 * len(s.buckets))
+	}
+	return true
+}
+
+// Remove unindexes key, it returns false if key was not indexed
+func (s *ScanIndex) Remove(key string) bool {
+	b := s.bucket(key)
+	bucket := s.buckets[b]
+	i := slices.Index(bucket, key)
+	if i < 0 {
+		return false
+	}
+	last := len(bucket) - 1
+	bucket[i] = bucket[last]
+	bucket[last] = ""
+	s.buckets[b] = bucket[:last]
+	s.count--
+	if len(s.buckets) > 1<<scanMinTableBits && s.count < len(s.buckets)/8 {
+		s.resize(len(s.buckets) / 2)
+	}
+	return true
+}
+
+// Scan calls fn for the keys of the buckets following cursor until about count keys were
+// found, and returns the cursor of the next call, 0 once the iteration is complete.
+func (s *ScanIndex) Scan(cursor uint64, count int, fn func(key string)) uint64 {
+	if s.count == 0 {
+		return 0
+	}
+	mask := uint64(len(s.buckets) - 1)
+	found := 0
+	for visits := 0; found < count && visits < count*scanEmptyVisits; visits++ {
+		for _, key := range s.buckets[cursor&mask] {
+			fn(key)
+		}
+		found += len(s.buckets[cursor&mask])
+		// increment the reversed bits of the cursor
+		cursor |= ^mask
+		cursor = bits.Reverse64(bits.Reverse64(cursor) + 1)
+		if cursor == 0 {
+			return 0
+		}
+	}
+	return cursor
+}
+
+// Random returns a key picked at random from a random non-empty bucket, false when the
+// index is empty
+func (s *ScanIndex) Random() (string, bool) {
+	if s.count == 0 {
+		return "", false
+	}
+	for {
+		if bucket := s.buckets[rand.Intn(len(s.buckets))]; len(bucket) > 0 {
+			return bucket[rand.Intn(len(bucket))], true
+		}
+	}
+}
+
+// Keys returns the index of the keys of db. It is built on first use and then updated with
+// the keys touched since, or built again when it no longer matches the dict, after SWAPDB
+// or FLUSHDB replaced it. It may hold keys expired or deleted without a Touch, which callers
+// skip. The caller must hold Mu.
+func (db *DbStore) Keys() *ScanIndex {
+	db.indexMu.Lock()
+	defer db.indexMu.Unlock()
+	if db.index != nil && db.indexed == db.Dict {
+		for key := range db.touched {
+			if _, ok := (*db.Dict)[key]; ok {
+				db.index.Add(key)
+			} else {
+				db.index.Remove(key)
+			}
+		}
+	}
+	db.touched = nil
+	// an index missing keys or holding mostly stale ones is built again
+	size := len(*db.Dict)
+	if db.index == nil || db.indexed != db.Dict || db.index.Len() < size || db.index.Len() > 2*max(size, 1<<scanMinTableBits) {
+		db.index = NewScanIndex(*db.Dict)
+		db.indexed = db.Dict
+	}
+	return db.index
+}
+
+// touchIndex records that key changed for the next use of the index of the keys. Past
+// as many touched keys as keys it is cheaper to build the index again.
+func (db *DbStore) touchIndex(key string) {
+	db.indexMu.Lock()
+	defer db.indexMu.Unlock()
+	if db.index == nil {
+		return
+	}
+	if db.touched == nil {
+		db.touched = make(map[string]struct{})
+	}
+	db.touched[key] = struct{}{}
+	if len(db.touched) > len(*db.Dict) {
+		db.index = nil
+		db.touched = nil
+	}
+}
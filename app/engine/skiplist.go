@@ -0,0 +1,309 @@
+package engine
+
+import "math/rand"
+
+// Skip list ordering sorted set members by (score, member).
+// Every level keeps the span it jumps over so ranks are computed in O(log n),
+// the same layout as the zskiplist of redis.
+
+const (
+	skipListMaxLevel    = 32
+	skipListProbability = 0.25
+)
+
+type skipListLevel struct {
+	forward *SkipListNode
+	span    int
+}
+
+type SkipListNode struct {
+	Member   string
+	Score    float64
+	backward *SkipListNode
+	level    []skipListLevel
+}
+
+type SkipList struct {
+	header *SkipListNode
+	tail   *SkipListNode
+	length int
+	level  int
+}
+
+// ScoreRange is a score interval, Min and Max are excluded when MinEx / MaxEx are set
+type ScoreRange struct {
+	Min   float64
+	Max   float64
+	MinEx bool
+	MaxEx bool
+}
+
+// LexRange is a member interval for members sharing the same score,
+// MinInf / MaxInf stand for the - and + special bounds
+type LexRange struct {
+	Min    string
+	Max    string
+	MinEx  bool
+	MaxEx  bool
+	MinInf bool
+	MaxInf bool
+}
+
+func NewSkipList() *SkipList {
+	return &SkipList{
+		header: &SkipListNode{level: make([]skipListLevel, skipListMaxLevel)},
+		level:  1,
+	}
+}
+
+func (n *SkipListNode) Next() *SkipListNode {
+	return n.level[0].forward
+}
+
+func (n *SkipListNode) Prev() *SkipListNode {
+	return n.backward
+}
+
+func (sl *SkipList) Len() int {
+	return sl.length
+}
+
+func randomLevel() int {
+	level := 1
+	for level < skipListMaxLevel && rand.Float64() < skipListProbability {
+		level++
+	}
+	return level
+}
+
+// less reports whether (score, member) sorts before node
+func less(score float64, member string, node *SkipListNode) bool {
+	return node.Score < score || (node.Score == score && node.Member < member)
+}
+
+// Insert adds a member that is not in the list yet
+func (sl *SkipList) Insert(score float64, member string) *SkipListNode {
+	var update [skipListMaxLevel]*SkipListNode
+	var rank [skipListMaxLevel]int
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		if i < sl.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.level[i].forward != nil && less(score, member, x.level[i].forward) {
+			rank[i] += x.level[i].span
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+	level := randomLevel()
+	if level > sl.level {
+		for i := sl.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = sl.header
+			update[i].level[i].span = sl.length
+		}
+		sl.level = level
+	}
+	node := &SkipListNode{
+		Member: member,
+		Score:  score,
+		level:  make([]skipListLevel, level),
+	}
+	for i := 0; i < level; i++ {
+		node.level[i].forward = update[i].level[i].forward
+		update[i].level[i].forward = node
+		node.level[i].span = update[i].level[i].span - (rank[0] - rank[i])
+		update[i].level[i].span = rank[0] - rank[i] + 1
+	}
+	for i := level; i < sl.level; i++ {
+		update[i].level[i].span++
+	}
+	if update[0] != sl.header {
+		node.backward = update[0]
+	}
+	if node.level[0].forward != nil {
+		node.level[0].forward.backward = node
+	} else {
+		sl.tail = node
+	}
+	sl.length++
+	return node
+}
+
+// Delete removes the node holding (score, member), it returns false if there is none
+func (sl *SkipList) Delete(score float64, member string) bool {
+	var update [skipListMaxLevel]*SkipListNode
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && less(score, member, x.level[i].forward) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+	x = x.level[0].forward
+	if x == nil || x.Score != score || x.Member != member {
+		return false
+	}
+	sl.deleteNode(x, update[:])
+	return true
+}
+
+func (sl *SkipList) deleteNode(x *SkipListNode, update []*SkipListNode) {
+	for i := 0; i < sl.level; i++ {
+		if update[i].level[i].forward == x {
+			update[i].level[i].span += x.level[i].span - 1
+			update[i].level[i].forward = x.level[i].forward
+		} else {
+			update[i].level[i].span--
+		}
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x.backward
+	} else {
+		sl.tail = x.backward
+	}
+	for sl.level > 1 && sl.header.level[sl.level-1].forward == nil {
+		sl.level--
+	}
+	sl.length--
+}
+
+// Rank returns the 1-based rank of (score, member), 0 when it is not in the list
+func (sl *SkipList) Rank(score float64, member string) int {
+	rank := 0
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil &&
+			(less(score, member, x.level[i].forward) ||
+				(x.level[i].forward.Score == score && x.level[i].forward.Member == member)) {
+			rank += x.level[i].span
+			x = x.level[i].forward
+		}
+		if x != sl.header && x.Score == score && x.Member == member {
+			return rank
+		}
+	}
+	return 0
+}
+
+// ByRank returns the node at the 1-based rank, nil when out of range
+func (sl *SkipList) ByRank(rank int) *SkipListNode {
+	if rank < 1 || rank > sl.length {
+		return nil
+	}
+	traversed := 0
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && traversed+x.level[i].span <= rank {
+			traversed += x.level[i].span
+			x = x.level[i].forward
+		}
+		if traversed == rank {
+			return x
+		}
+	}
+	return nil
+}
+
+func (r ScoreRange) aboveMin(score float64) bool {
+	if r.MinEx {
+		return score > r.Min
+	}
+	return score >= r.Min
+}
+
+func (r ScoreRange) belowMax(score float64) bool {
+	if r.MaxEx {
+		return score < r.Max
+	}
+	return score <= r.Max
+}
+
+// Contains reports whether score is inside the range
+func (r ScoreRange) Contains(score float64) bool {
+	return r.aboveMin(score) && r.belowMax(score)
+}
+
+// FirstInRange returns the first node with a score inside r
+func (sl *SkipList) FirstInRange(r ScoreRange) *SkipListNode {
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !r.aboveMin(x.level[i].forward.Score) {
+			x = x.level[i].forward
+		}
+	}
+	x = x.level[0].forward
+	if x == nil || !r.belowMax(x.Score) {
+		return nil
+	}
+	return x
+}
+
+// LastInRange returns the last node with a score inside r
+func (sl *SkipList) LastInRange(r ScoreRange) *SkipListNode {
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && r.belowMax(x.level[i].forward.Score) {
+			x = x.level[i].forward
+		}
+	}
+	if x == sl.header || !r.aboveMin(x.Score) {
+		return nil
+	}
+	return x
+}
+
+func (r LexRange) aboveMin(member string) bool {
+	if r.MinInf {
+		return true
+	}
+	if r.MinEx {
+		return member > r.Min
+	}
+	return member >= r.Min
+}
+
+func (r LexRange) belowMax(member string) bool {
+	if r.MaxInf {
+		return true
+	}
+	if r.MaxEx {
+		return member < r.Max
+	}
+	return member <= r.Max
+}
+
+// Contains reports whether member is inside the range
+func (r LexRange) Contains(member string) bool {
+	return r.aboveMin(member) && r.belowMax(member)
+}
+
+// FirstInLexRange returns the first node with a member inside r
+func (sl *SkipList) FirstInLexRange(r LexRange) *SkipListNode {
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !r.aboveMin(x.level[i].forward.Member) {
+			x = x.level[i].forward
+		}
+	}
+	x = x.level[0].forward
+	if x == nil || !r.belowMax(x.Member) {
+		return nil
+	}
+	return x
+}
+
+// LastInLexRange returns the last node with a member inside r
+func (sl *SkipList) LastInLexRange(r LexRange) *SkipListNode {
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && r.belowMax(x.level[i].forward.Member) {
+			x = x.level[i].forward
+		}
+	}
+	if x == sl.header || !r.aboveMin(x.Member) {
+		return nil
+	}
+	return x
+}
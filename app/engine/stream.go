@@ -0,0 +1,296 @@
+package engine
+
+import (
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Stream storage.
+// Entries are packed in nodes of at most StreamNodeMaxEntries entries and the nodes
+// are kept ordered by their master (first) ID, the way redis keeps listpacks in a rax.
+// Deleting an entry only flags it, a node is dropped once all its entries are deleted.
+
+const StreamNodeMaxEntries = 100
+
+// StreamID is the <ms>-<seq> identifier of a stream entry
+type StreamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+// MaxStreamID is the greatest possible ID, the + of range queries
+var MaxStreamID = StreamID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+
+type StreamEntry struct {
+	ID      StreamID
+	Fields  []string
+	deleted bool
+}
+
+type streamNode struct {
+	master  StreamID
+	entries []StreamEntry
+	live    int
+}
+
+type Stream struct {
+	nodes  []*streamNode
+	length int
+	// LastID is the ID of the last entry ever added, it survives deletions
+	LastID       StreamID
+	MaxDeletedID StreamID
+	EntriesAdded uint64
+	Groups       map[string]*StreamGroup
+}
+
+func (id StreamID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+func (id StreamID) Compare(other StreamID) int {
+	switch {
+	case id.Ms < other.Ms:
+		return -1
+	case id.Ms > other.Ms:
+		return 1
+	case id.Seq < other.Seq:
+		return -1
+	case id.Seq > other.Seq:
+		return 1
+	}
+	return 0
+}
+
+func (id StreamID) Less(other StreamID) bool {
+	return id.Compare(other) < 0
+}
+
+func (id StreamID) IsZero() bool {
+	return id.Ms == 0 && id.Seq == 0
+}
+
+// Incr returns the ID that follows id, ok is false when id is the greatest ID
+func (id StreamID) Incr() (StreamID, bool) {
+	switch {
+	case id.Seq < math.MaxUint64:
+		return StreamID{Ms: id.Ms, Seq: id.Seq + 1}, true
+	case id.Ms < math.MaxUint64:
+		return StreamID{Ms: id.Ms + 1}, true
+	}
+	return id, false
+}
+
+// Decr returns the ID that precedes id, ok is false when id is 0-0
+func (id StreamID) Decr() (StreamID, bool) {
+	switch {
+	case id.Seq > 0:
+		return StreamID{Ms: id.Ms, Seq: id.Seq - 1}, true
+	case id.Ms > 0:
+		return StreamID{Ms: id.Ms - 1, Seq: math.MaxUint64}, true
+	}
+	return id, false
+}
+
+func NewStream() *Stream {
+	return &Stream{}
+}
+
+func (s *Stream) Len() int {
+	return s.length
+}
+
+// Append adds an entry at the end of the stream, id must be greater than LastID
+func (s *Stream) Append(id StreamID, fields []string) {
+	var node *streamNode
+	if len(s.nodes) > 0 {
+		node = s.nodes[len(s.nodes)-1]
+	}
+	if node == nil || len(node.entries) >= StreamNodeMaxEntries {
+		node = &streamNode{master: id}
+		s.nodes = append(s.nodes, node)
+	}
+	node.entries = append(node.entries, StreamEntry{ID: id, Fields: fields})
+	node.live++
+	s.length++
+	s.LastID = id
+	s.EntriesAdded++
+}
+
+// Nodes returns the number of nodes holding the entries
+func (s *Stream) Nodes() int {
+	return len(s.nodes)
+}
+
+// EachNode calls fn with the master ID and the live entries of every node in order
+func (s *Stream) EachNode(fn func(master StreamID, entries []StreamEntry)) {
+	for _, node := range s.nodes {
+		entries := make([]StreamEntry, 0, node.live)
+		for _, entry := range node.entries {
+			if !entry.deleted {
+				entries = append(entries, entry)
+			}
+		}
+		fn(node.master, entries)
+	}
+}
+
+// First returns the first entry that is not deleted
+func (s *Stream) First() (StreamEntry, bool) {
+	entries := s.Range(StreamID{}, MaxStreamID, 1, false)
+	if len(entries) == 0 {
+		return StreamEntry{}, false
+	}
+	return entries[0], true
+}
+
+// Last returns the last entry that is not deleted
+func (s *Stream) Last() (StreamEntry, bool) {
+	entries := s.Range(StreamID{}, MaxStreamID, 1, true)
+	if len(entries) == 0 {
+		return StreamEntry{}, false
+	}
+	return entries[0], true
+}
+
+// findNode returns the index of the node that may hold id
+func (s *Stream) findNode(id StreamID) int {
+	i := sort.Search(len(s.nodes), func(i int) bool {
+		return id.Less(s.nodes[i].master)
+	})
+	if i > 0 {
+		i--
+	}
+	return i
+}
+
+// Range returns up to count entries with start <= ID <= end, in descending order when rev is set.
+// A count of 0 or less returns every entry in the range.
+func (s *Stream) Range(start StreamID, end StreamID, count int, rev bool) []StreamEntry {
+	var entries []StreamEntry
+	if len(s.nodes) == 0 || end.Less(start) {
+		return entries
+	}
+	full := func() bool {
+		return count > 0 && len(entries) >= count
+	}
+	if !rev {
+		for n := s.findNode(start); n < len(s.nodes) && !full(); n++ {
+			for _, entry := range s.nodes[n].entries {
+				if end.Less(entry.ID) {
+					return entries
+				}
+				if entry.deleted || entry.ID.Less(start) {
+					continue
+				}
+				entries = append(entries, entry)
+				if full() {
+					break
+				}
+			}
+		}
+		return entries
+	}
+	for n := s.findNode(end); n >= 0 && !full(); n-- {
+		node := s.nodes[n]
+		for i := len(node.entries) - 1; i >= 0; i-- {
+			entry := node.entries[i]
+			if entry.ID.Less(start) {
+				return entries
+			}
+			if entry.deleted || end.Less(entry.ID) {
+				continue
+			}
+			entries = append(entries, entry)
+			if full() {
+				break
+			}
+		}
+	}
+	return entries
+}
+
+// Delete flags the entry with the given id as deleted, it returns false if there is none
+func (s *Stream) Delete(id StreamID) bool {
+	if len(s.nodes) == 0 {
+		return false
+	}
+	n := s.findNode(id)
+	node := s.nodes[n]
+	i := sort.Search(len(node.entries), func(i int) bool {
+		return !node.entries[i].ID.Less(id)
+	})
+	if i == len(node.entries) || node.entries[i].ID != id || node.entries[i].deleted {
+		return false
+	}
+	node.entries[i].deleted = true
+	node.entries[i].Fields = nil
+	node.live--
+	s.length--
+	if s.MaxDeletedID.Less(id) {
+		s.MaxDeletedID = id
+	}
+	if node.live == 0 {
+		s.nodes = append(s.nodes[:n], s.nodes[n+1:]...)
+	}
+	return true
+}
+
+// TrimMaxLen evicts the oldest entries until at most maxLen are left.
+// When approx is set only whole nodes are evicted, and at most limit entries
+// are evicted when limit is positive. It returns the number of evicted entries.
+func (s *Stream) TrimMaxLen(maxLen int, approx bool, limit int) int {
+	return s.trim(approx, limit, func(node *streamNode) bool {
+		return s.length-node.live >= maxLen
+	}, func(entry StreamEntry) bool {
+		return s.length > maxLen
+	})
+}
+
+// TrimMinID evicts the entries with an ID lower than minID, see TrimMaxLen for approx and limit
+func (s *Stream) TrimMinID(minID StreamID, approx bool, limit int) int {
+	return s.trim(approx, limit, func(node *streamNode) bool {
+		return node.entries[len(node.entries)-1].ID.Less(minID)
+	}, func(entry StreamEntry) bool {
+		return entry.ID.Less(minID)
+	})
+}
+
+// trim evicts head nodes while wholeNode allows it, then single entries
+// of the next node while entry allows it unless approx is set
+func (s *Stream) trim(approx bool, limit int, wholeNode func(*streamNode) bool, entry func(StreamEntry) bool) int {
+	evicted := 0
+	for len(s.nodes) > 0 {
+		node := s.nodes[0]
+		if limit > 0 && evicted+node.live > limit {
+			break
+		}
+		if wholeNode(node) {
+			evicted += node.live
+			s.length -= node.live
+			s.nodes = s.nodes[1:]
+			continue
+		}
+		if approx {
+			break
+		}
+		for i := range node.entries {
+			if node.entries[i].deleted {
+				continue
+			}
+			if !entry(node.entries[i]) {
+				break
+			}
+			node.entries[i].deleted = true
+			node.entries[i].Fields = nil
+			node.live--
+			s.length--
+			evicted++
+		}
+		if node.live == 0 {
+			s.nodes = s.nodes[1:]
+		}
+		break
+	}
+	return evicted
+}
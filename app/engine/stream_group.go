@@ -0,0 +1,257 @@
+package engine
+
+import (
+	"sort"
+	"time"
+)
+
+// Consumer groups.
+// A group keeps the pending entries list (PEL) of the entries delivered to its consumers
+// and not acknowledged yet, every consumer references the same NACKs in its own PEL.
+
+// InvalidEntriesRead marks a group whose entries-read counter can not be computed
+const InvalidEntriesRead = -1
+
+type StreamNACK struct {
+	Consumer      *StreamConsumer
+	DeliveryTime  time.Time
+	DeliveryCount uint64
+}
+
+type StreamConsumer struct {
+	Name string
+	// SeenTime is the last time the consumer interacted with the group,
+	// ActiveTime the last time it read or claimed entries, zero if never
+	SeenTime   time.Time
+	ActiveTime time.Time
+	Pending    map[StreamID]*StreamNACK
+}
+
+type StreamGroup struct {
+	Name        string
+	LastID      StreamID
+	EntriesRead int64
+	Pending     map[StreamID]*StreamNACK
+	Consumers   map[string]*StreamConsumer
+}
+
+// CreateGroup adds a group delivering the entries after lastID, it returns false if the group exists
+func (s *Stream) CreateGroup(name string, lastID StreamID, entriesRead int64) (*StreamGroup, bool) {
+	if s.Groups == nil {
+		s.Groups = make(map[string]*StreamGroup)
+	}
+	if _, ok := s.Groups[name]; ok {
+		return nil, false
+	}
+	group := &StreamGroup{
+		Name:        name,
+		LastID:      lastID,
+		EntriesRead: entriesRead,
+		Pending:     make(map[StreamID]*StreamNACK),
+		Consumers:   make(map[string]*StreamConsumer),
+	}
+	s.Groups[name] = group
+	return group, true
+}
+
+func (s *Stream) Group(name string) *StreamGroup {
+	return s.Groups[name]
+}
+
+func (s *Stream) DestroyGroup(name string) bool {
+	if _, ok := s.Groups[name]; !ok {
+		return false
+	}
+	delete(s.Groups, name)
+	return true
+}
+
+// GroupNames returns the names of the groups in lexicographic order
+func (s *Stream) GroupNames() []string {
+	names := make([]string, 0, len(s.Groups))
+	for name := range s.Groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Entry returns the entry with the given id if it was not deleted
+func (s *Stream) Entry(id StreamID) (StreamEntry, bool) {
+	entries := s.Range(id, id, 1, false)
+	if len(entries) == 0 {
+		return StreamEntry{}, false
+	}
+	return entries[0], true
+}
+
+// HasTombstones reports whether entries after start were deleted
+func (s *Stream) HasTombstones(start StreamID) bool {
+	if s.length == 0 || s.MaxDeletedID.IsZero() {
+		return false
+	}
+	return !s.MaxDeletedID.Less(start)
+}
+
+// EntriesReadAt estimates how many entries were added up to id,
+// InvalidEntriesRead when deletions make it impossible to know
+func (s *Stream) EntriesReadAt(id StreamID) int64 {
+	added := int64(s.EntriesAdded)
+	if added == 0 {
+		return 0
+	}
+	cmpLast := id.Compare(s.LastID)
+	if s.length == 0 && cmpLast <= 0 {
+		return added
+	}
+	if cmpLast == 0 {
+		return added
+	}
+	if cmpLast > 0 {
+		return InvalidEntriesRead
+	}
+	first, _ := s.First()
+	if s.MaxDeletedID.IsZero() || s.MaxDeletedID.Less(first.ID) {
+		switch id.Compare(first.ID) {
+		case -1:
+			return added - int64(s.length)
+		case 0:
+			return added - int64(s.length) + 1
+		}
+	}
+	return InvalidEntriesRead
+}
+
+// Lag returns the number of entries the group still has to read, ok is false when it is unknown
+func (s *Stream) Lag(group *StreamGroup) (int64, bool) {
+	if s.EntriesAdded == 0 {
+		return 0, true
+	}
+	if group.EntriesRead != InvalidEntriesRead && !s.HasTombstones(group.LastID) {
+		return int64(s.EntriesAdded) - group.EntriesRead, true
+	}
+	read := s.EntriesReadAt(group.LastID)
+	if read == InvalidEntriesRead {
+		return 0, false
+	}
+	return int64(s.EntriesAdded) - read, true
+}
+
+// Advance moves the group past id after it was delivered as a new entry
+func (s *Stream) Advance(group *StreamGroup, id StreamID) {
+	if group.EntriesRead != InvalidEntriesRead && !s.HasTombstones(id) {
+		group.EntriesRead++
+	} else if s.EntriesAdded > 0 {
+		group.EntriesRead = s.EntriesReadAt(id)
+	}
+	group.LastID = id
+}
+
+// Consumer returns the named consumer, creating it when create is set
+func (g *StreamGroup) Consumer(name string, create bool) (consumer *StreamConsumer, created bool) {
+	if consumer, ok := g.Consumers[name]; ok || !create {
+		return consumer, false
+	}
+	consumer = &StreamConsumer{
+		Name:     name,
+		SeenTime: time.Now(),
+		Pending:  make(map[StreamID]*StreamNACK),
+	}
+	g.Consumers[name] = consumer
+	return consumer, true
+}
+
+// DeleteConsumer removes a consumer and its pending entries, it returns how many were pending
+func (g *StreamGroup) DeleteConsumer(name string) (int, bool) {
+	consumer, ok := g.Consumers[name]
+	if !ok {
+		return 0, false
+	}
+	for id := range consumer.Pending {
+		delete(g.Pending, id)
+	}
+	delete(g.Consumers, name)
+	return len(consumer.Pending), true
+}
+
+// ConsumerNames returns the names of the consumers in lexicographic order
+func (g *StreamGroup) ConsumerNames() []string {
+	names := make([]string, 0, len(g.Consumers))
+	for name := range g.Consumers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Assign makes consumer the owner of the pending entry id, creating the NACK if needed
+func (g *StreamGroup) Assign(id StreamID, consumer *StreamConsumer) *StreamNACK {
+	nack, ok := g.Pending[id]
+	if !ok {
+		nack = &StreamNACK{}
+		g.Pending[id] = nack
+	}
+	if nack.Consumer != nil {
+		delete(nack.Consumer.Pending, id)
+	}
+	nack.Consumer = consumer
+	consumer.Pending[id] = nack
+	return nack
+}
+
+// Ack removes id from the PEL, it returns false if it was not pending
+func (g *StreamGroup) Ack(id StreamID) bool {
+	nack, ok := g.Pending[id]
+	if !ok {
+		return false
+	}
+	delete(nack.Consumer.Pending, id)
+	delete(g.Pending, id)
+	return true
+}
+
+// PendingIDs returns the IDs of pel between start and end in ascending order
+func PendingIDs(pel map[StreamID]*StreamNACK, start StreamID, end StreamID) []StreamID {
+	ids := make([]StreamID, 0, len(pel))
+	for id := range pel {
+		if !id.Less(start) && !end.Less(id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].Less(ids[j])
+	})
+	return ids
+}
+
+// Copy returns a deep copy of the stream, its groups and their PELs
+func (s *Stream) Copy() *Stream {
+	c := &Stream{
+		nodes:        make([]*streamNode, len(s.nodes)),
+		length:       s.length,
+		LastID:       s.LastID,
+		MaxDeletedID: s.MaxDeletedID,
+		EntriesAdded: s.EntriesAdded,
+	}
+	for i, node := range s.nodes {
+		c.nodes[i] = &streamNode{
+			master:  node.master,
+			entries: append([]StreamEntry(nil), node.entries...),
+			live:    node.live,
+		}
+	}
+	for name, group := range s.Groups {
+		copied, _ := c.CreateGroup(name, group.LastID, group.EntriesRead)
+		for consumerName, consumer := range group.Consumers {
+			copiedConsumer, _ := copied.Consumer(consumerName, true)
+			copiedConsumer.SeenTime = consumer.SeenTime
+			copiedConsumer.ActiveTime = consumer.ActiveTime
+		}
+		for id, nack := range group.Pending {
+			copiedNack := copied.Assign(id, copied.Consumers[nack.Consumer.Name])
+			copiedNack.DeliveryTime = nack.DeliveryTime
+			copiedNack.DeliveryCount = nack.DeliveryCount
+		}
+	}
+	return c
+}
@@ -0,0 +1,72 @@
+package engine
+
+import "sync/atomic"
+
+// Optimistic locking for WATCH.
+// A Watch belongs to one client and is registered under every key it watches. Modifying a
+// key, expiring it included, flags the watches registered under it dirty, which makes the
+// next EXEC of their client fail. Keys are watched per database, not per dict, so they stay
+// watched when SWAPDB exchanges the contents of two databases.
+
+// Watch is the set of keys watched by a client
+type Watch struct {
+	dirty atomic.Bool
+}
+
+// Dirty reports whether a watched key was modified
+func (w *Watch) Dirty() bool {
+	return w.dirty.Load()
+}
+
+// Watch registers w under key
+func (db *DbStore) Watch(key string, w *Watch) {
+	db.watchMu.Lock()
+	defer db.watchMu.Unlock()
+	if db.watched == nil {
+		db.watched = make(map[string]map[*Watch]struct{})
+	}
+	if db.watched[key] == nil {
+		db.watched[key] = make(map[*Watch]struct{})
+	}
+	db.watched[key][w] = struct{}{}
+}
+
+// Unwatch removes w from key
+func (db *DbStore) Unwatch(key string, w *Watch) {
+	db.watchMu.Lock()
+	defer db.watchMu.Unlock()
+	delete(db.watched[key], w)
+	if len(db.watched[key]) == 0 {
+		delete(db.watched, key)
+	}
+}
+
+// Touch flags dirty the watches of key, it is called with Mu held after every modification
+func (db *DbStore) Touch(key string) {
+	db.touchIndex(key)
+	db.replaceExpired(key)
+	db.watchMu.Lock()
+	defer db.watchMu.Unlock()
+	for w := range db.watched[key] {
+		w.dirty.Store(true)
+	}
+}
+
+// TouchExisting flags dirty the watches of the keys that exist in db or in other, before
+// db is emptied or its contents exchanged with other. other may be nil. The caller must
+// hold Mu, and the lock of other.
+func (db *DbStore) TouchExisting(other *DbStore) {
+	db.watchMu.Lock()
+	defer db.watchMu.Unlock()
+	for key, watches := range db.watched {
+		_, exists := (*db.Dict)[key]
+		if !exists && other != nil {
+			_, exists = (*other.Dict)[key]
+		}
+		if exists {
+			for w := range watches {
+				w.dirty.Store(true)
+			}
+		}
+	}
+}
@@ -7,21 +7,37 @@ import (
 	"time"
 
 	"github.com/codecrafters-io/redis-starter-go/app/engine"
+	"github.com/hdt3213/rdb/crc64jones"
 	"github.com/hdt3213/rdb/encoder"
+	"github.com/hdt3213/rdb/model"
 	"github.com/hdt3213/rdb/parser"
 )
 
+// Encode loads the database 0 of the RDB file at path, empty if the file cannot be read
 func Encode(path string) map[string]engine.RedisObj {
+	return EncodeDatabases(path, 1)[0]
+}
+
+// EncodeDatabases loads the databases of the RDB file at path, keys of databases past
+// count are dropped
+func EncodeDatabases(path string, count int) []map[string]engine.RedisObj {
+	dicts := make([]map[string]engine.RedisObj, count)
+	for i := range dicts {
+		dicts[i] = make(map[string]engine.RedisObj)
+	}
 	rdbFile, err := os.Open(path)
-	dict := make(map[string]engine.RedisObj)
 	if err != nil {
-		return dict
+		return dicts
 	}
 	defer func() {
 		_ = rdbFile.Close()
 	}()
 	decoder := parser.NewDecoder(rdbFile)
 	err = decoder.Parse(func(o parser.RedisObject) bool {
+		if o.GetDBIndex() >= count {
+			return true
+		}
+		dict := dicts[o.GetDBIndex()]
 		switch o.GetType() {
 		case parser.StringType:
 			str := o.(*parser.StringObject)
@@ -29,9 +45,48 @@ func Encode(path string) map[string]engine.RedisObj {
 			if str.Expiration != nil {
 				exp = *str.Expiration
 			}
-			dict[str.Key] = engine.RedisString{
-				Data:       string(str.Value),
-				Expiration: exp,
+			dict[str.Key] = engine.NewRedisString(string(str.Value), exp)
+		case parser.ListType:
+			list := o.(*parser.ListObject)
+			data := make([]string, len(list.Values))
+			for i, value := range list.Values {
+				data[i] = string(value)
+			}
+			dict[list.Key] = engine.RedisList{
+				Data:       data,
+				Expiration: expiration(o),
+			}
+		case parser.HashType:
+			hash := o.(*parser.HashObject)
+			data := make(map[string]string, len(hash.Hash))
+			for field, value := range hash.Hash {
+				data[field] = string(value)
+			}
+			h := engine.NewRedisHash(data)
+			h.Expiration = expiration(o)
+			dict[hash.Key] = h
+		case parser.SetType:
+			set := o.(*parser.SetObject)
+			data := make(map[string]struct{}, len(set.Members))
+			for _, member := range set.Members {
+				data[string(member)] = struct{}{}
+			}
+			s := engine.NewRedisSet(data)
+			s.Expiration = expiration(o)
+			dict[set.Key] = s
+		case parser.ZSetType:
+			zsetObj := o.(*parser.ZSetObject)
+			zset := engine.NewRedisZSet()
+			for _, entry := range zsetObj.Entries {
+				zset.Add(entry.Member, entry.Score)
+			}
+			zset.Expiration = expiration(o)
+			dict[zsetObj.Key] = zset
+		case parser.StreamType:
+			stream := o.(*parser.StreamObject)
+			dict[stream.Key] = engine.RedisStream{
+				Data:       decodeStream(stream),
+				Expiration: expiration(o),
 			}
 		}
 		return true
@@ -39,10 +94,32 @@ func Encode(path string) map[string]engine.RedisObj {
 	if err != nil {
 		fmt.Println(err)
 	}
-	return dict
+	return dicts
+}
+
+// expiration returns the expiration of a parsed object, zero when it has none
+func expiration(o parser.RedisObject) time.Time {
+	if exp := o.GetExpiration(); exp != nil {
+		return *exp
+	}
+	return time.Time{}
 }
 
+// ttlOptions returns the encoder options carrying the expiration of obj, if any
+func ttlOptions(obj engine.RedisObj) []interface{} {
+	if !obj.HasExpiration() {
+		return nil
+	}
+	return []interface{}{encoder.WithTTL(uint64(obj.GetExpiration().UnixMilli()))}
+}
+
+// GenerateRDBBinary encodes dict as the only database
 func GenerateRDBBinary(dict *map[string]engine.RedisObj) ([]byte, error) {
+	return GenerateDatabasesBinary([]*map[string]engine.RedisObj{dict})
+}
+
+// GenerateDatabasesBinary encodes every database, each one in its own section
+func GenerateDatabasesBinary(dicts []*map[string]engine.RedisObj) ([]byte, error) {
 	var buf bytes.Buffer
 	enc := encoder.NewEncoder(&buf)
 	err := enc.WriteHeader()
@@ -73,45 +150,18 @@ func GenerateRDBBinary(dict *map[string]engine.RedisObj) ([]byte, error) {
 		return nil, fmt.Errorf("failed to write aof-base: %w", err)
 	}
 
-	// Only write DB header and objects if dict is not empty
-	if len(*dict) > 0 {
-		dictSize := len(*dict)
-		expiringKeys := 0
-		for _, redisObj := range *dict {
-			if redisObj.HasExpiration() {
-				expiringKeys++
-			}
-		}
-
-		if err := enc.WriteDBHeader(0, uint64(dictSize), uint64(expiringKeys)); err != nil {
-			return nil, fmt.Errorf("failed to write DB header: %w", err)
-		}
-
-		for key, redisObj := range *dict {
-			var err error
-
-			switch redisObj.Type() {
-			case "STRING":
-				if redisObj.HasExpiration() {
-					expirationMs := uint64(redisObj.GetExpiration().Unix() * 1000)
-					err = enc.WriteStringObject(key, []byte(redisObj.Value().(string)), encoder.WithTTL(expirationMs))
-				} else {
-					err = enc.WriteStringObject(key, []byte(redisObj.Value().(string)))
-				}
-			default:
-				continue
-			}
-
-			if err != nil {
-				return nil, fmt.Errorf("failed to write object %s (type: %s): %w", key, redisObj.Type(), err)
-			}
+	for db, dict := range dicts {
+		if err := appendDatabase(&buf, enc, db, dict); err != nil {
+			return nil, err
 		}
 	}
 
-	// Write end marker - this produces ff followed by checksum
-	if err := enc.WriteEnd(); err != nil {
-		return nil, fmt.Errorf("failed to write RDB end marker: %w", err)
-	}
+	// Write end marker - ff followed by the checksum, computed over the whole
+	// buffer since streams are written next to the encoder
+	buf.WriteByte(opCodeEOF)
+	crc := crc64jones.New()
+	crc.Write(buf.Bytes())
+	buf.Write(crc.Sum(nil))
 	return buf.Bytes(), nil
 }
 func GenerateRDBFile(dict *map[string]engine.RedisObj, filename string) error {
@@ -122,3 +172,97 @@ func GenerateRDBFile(dict *map[string]engine.RedisObj, filename string) error {
 
 	return os.WriteFile(filename, data, 0644)
 }
+
+// appendDatabase writes the section of database db, skipped when it holds no live key.
+// Streams are written next to the encoder, which refuses a new section right after a header,
+// so they come last and the header is written by hand when a section holds streams only.
+func appendDatabase(buf *bytes.Buffer, enc *encoder.Encoder, db int, dict *map[string]engine.RedisObj) error {
+	var keys, streams []string
+	expiringKeys := 0
+	for key, redisObj := range *dict {
+		if redisObj.Value() == nil {
+			// expired
+			continue
+		}
+		if redisObj.Type() == "STREAM" {
+			streams = append(streams, key)
+		} else if isEncoded(redisObj) {
+			keys = append(keys, key)
+		} else {
+			continue
+		}
+		if redisObj.HasExpiration() {
+			expiringKeys++
+		}
+	}
+	size := uint64(len(keys) + len(streams))
+	if size == 0 {
+		return nil
+	}
+	if len(keys) == 0 {
+		appendDBHeader(buf, db, size, uint64(expiringKeys))
+	} else if err := enc.WriteDBHeader(uint(db), size, uint64(expiringKeys)); err != nil {
+		return fmt.Errorf("failed to write DB header: %w", err)
+	}
+
+	for _, key := range keys {
+		var err error
+		redisObj := (*dict)[key]
+		value := redisObj.Value()
+		options := ttlOptions(redisObj)
+
+		switch redisObj.Type() {
+		case "STRING":
+			err = enc.WriteStringObject(key, []byte(value.(string)), options...)
+		case "LIST":
+			values := make([][]byte, len(value.([]string)))
+			for i, element := range value.([]string) {
+				values[i] = []byte(element)
+			}
+			err = enc.WriteListObject(key, values, options...)
+		case "HASH":
+			hash := make(map[string][]byte, len(value.(map[string]string)))
+			for field, fieldValue := range value.(map[string]string) {
+				hash[field] = []byte(fieldValue)
+			}
+			err = enc.WriteHashMapObject(key, hash, options...)
+		case "SET":
+			members := make([][]byte, 0, len(value.(map[string]struct{})))
+			for member := range value.(map[string]struct{}) {
+				members = append(members, []byte(member))
+			}
+			err = enc.WriteSetObject(key, members, options...)
+		case "ZSET":
+			entries := make([]*model.ZSetEntry, 0, len(value.(map[string]float64)))
+			for member, score := range value.(map[string]float64) {
+				entries = append(entries, &model.ZSetEntry{Member: member, Score: score})
+			}
+			err = enc.WriteZSetObject(key, entries, options...)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write object %s (type: %s): %w", key, redisObj.Type(), err)
+		}
+	}
+	for _, key := range streams {
+		appendStreamObject(buf, key, (*dict)[key].(engine.RedisStream))
+	}
+	return nil
+}
+
+// appendDBHeader appends the SELECTDB and RESIZEDB opcodes starting the section of database db
+func appendDBHeader(buf *bytes.Buffer, db int, size uint64, expiringKeys uint64) {
+	buf.WriteByte(opCodeSelectDB)
+	appendLength(buf, uint64(db))
+	buf.WriteByte(opCodeResizeDB)
+	appendLength(buf, size)
+	appendLength(buf, expiringKeys)
+}
+
+// isEncoded reports whether obj is written by the encoder
+func isEncoded(obj engine.RedisObj) bool {
+	switch obj.Type() {
+	case "STRING", "LIST", "HASH", "SET", "ZSET":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,301 @@
+package rdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/engine"
+	"github.com/hdt3213/rdb/model"
+)
+
+// Streams are not supported by the encoder library, they are written here
+// in the RDB_TYPE_STREAM_LISTPACKS_3 layout of redis 7.2.
+
+const (
+	opCodeResizeDB       = 251
+	opCodeExpireTimeMs   = 252
+	opCodeSelectDB       = 254
+	opCodeEOF            = 255
+	typeStreamListPacks3 = 21
+
+	streamItemFlagSameFields = 1 << 1
+)
+
+// appendLength appends an RDB length encoding
+func appendLength(buf *bytes.Buffer, n uint64) {
+	switch {
+	case n < 1<<6:
+		buf.WriteByte(byte(n))
+	case n < 1<<14:
+		buf.WriteByte(byte(n>>8) | 0x40)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint32:
+		buf.WriteByte(0x80)
+		_ = binary.Write(buf, binary.BigEndian, uint32(n))
+	default:
+		buf.WriteByte(0x81)
+		_ = binary.Write(buf, binary.BigEndian, n)
+	}
+}
+
+func appendString(buf *bytes.Buffer, s []byte) {
+	appendLength(buf, uint64(len(s)))
+	buf.Write(s)
+}
+
+func appendRawID(buf *bytes.Buffer, id engine.StreamID) {
+	_ = binary.Write(buf, binary.BigEndian, id.Ms)
+	_ = binary.Write(buf, binary.BigEndian, id.Seq)
+}
+
+func appendMillis(buf *bytes.Buffer, t time.Time) {
+	var ms uint64
+	if !t.IsZero() {
+		ms = uint64(t.UnixMilli())
+	}
+	_ = binary.Write(buf, binary.LittleEndian, ms)
+}
+
+// listpack builds the listpack holding the entries of one stream node
+type listpack struct {
+	body  bytes.Buffer
+	count int
+}
+
+func (lp *listpack) appendEntry(encoded []byte) {
+	lp.body.Write(encoded)
+	// the backlen stores the entry size 7 bits at a time, read from the right
+	size := uint64(len(encoded))
+	var backlen []byte
+	for {
+		backlen = append([]byte{byte(size & 0x7f)}, backlen...)
+		size >>= 7
+		if size == 0 {
+			break
+		}
+	}
+	for i := 1; i < len(backlen); i++ {
+		backlen[i] |= 0x80
+	}
+	lp.body.Write(backlen)
+	lp.count++
+}
+
+func (lp *listpack) appendInt(n int64) {
+	encoded := make([]byte, 9)
+	encoded[0] = 0xf4
+	binary.LittleEndian.PutUint64(encoded[1:], uint64(n))
+	lp.appendEntry(encoded)
+}
+
+func (lp *listpack) appendString(s string) {
+	var encoded []byte
+	switch {
+	case len(s) < 1<<6:
+		encoded = append([]byte{0x80 | byte(len(s))}, s...)
+	case len(s) < 1<<12:
+		encoded = append([]byte{0xe0 | byte(len(s)>>8), byte(len(s))}, s...)
+	default:
+		encoded = make([]byte, 5, 5+len(s))
+		encoded[0] = 0xf0
+		binary.LittleEndian.PutUint32(encoded[1:], uint32(len(s)))
+		encoded = append(encoded, s...)
+	}
+	lp.appendEntry(encoded)
+}
+
+func (lp *listpack) bytes() []byte {
+	out := make([]byte, 6, 6+lp.body.Len()+1)
+	binary.LittleEndian.PutUint32(out, uint32(6+lp.body.Len()+1))
+	binary.LittleEndian.PutUint16(out[4:], uint16(min(lp.count, math.MaxUint16)))
+	out = append(out, lp.body.Bytes()...)
+	return append(out, 0xff)
+}
+
+func sameFields(entry engine.StreamEntry, master []string) bool {
+	if len(entry.Fields)/2 != len(master) {
+		return false
+	}
+	for i, field := range master {
+		if entry.Fields[2*i] != field {
+			return false
+		}
+	}
+	return true
+}
+
+// streamNodeListpack encodes a node: the master entry holding the fields of the first entry,
+// then every entry as flags, ID delta, fields and values, and its element count
+func streamNodeListpack(master engine.StreamID, entries []engine.StreamEntry) []byte {
+	var lp listpack
+	var masterFields []string
+	for i := 0; i < len(entries[0].Fields); i += 2 {
+		masterFields = append(masterFields, entries[0].Fields[i])
+	}
+	lp.appendInt(int64(len(entries)))
+	lp.appendInt(0)
+	lp.appendInt(int64(len(masterFields)))
+	for _, field := range masterFields {
+		lp.appendString(field)
+	}
+	lp.appendInt(0)
+	for _, entry := range entries {
+		same := sameFields(entry, masterFields)
+		flags := int64(0)
+		if same {
+			flags |= streamItemFlagSameFields
+		}
+		lp.appendInt(flags)
+		lp.appendInt(int64(entry.ID.Ms - master.Ms))
+		lp.appendInt(int64(entry.ID.Seq - master.Seq))
+		if same {
+			for i := 1; i < len(entry.Fields); i += 2 {
+				lp.appendString(entry.Fields[i])
+			}
+			lp.appendInt(int64(len(masterFields) + 3))
+			continue
+		}
+		lp.appendInt(int64(len(entry.Fields) / 2))
+		for _, field := range entry.Fields {
+			lp.appendString(field)
+		}
+		lp.appendInt(int64(len(entry.Fields) + 4))
+	}
+	return lp.bytes()
+}
+
+// appendStreamObject appends the key and stream s, preceded by its expiration if any
+func appendStreamObject(buf *bytes.Buffer, key string, obj engine.RedisStream) {
+	if obj.HasExpiration() {
+		buf.WriteByte(opCodeExpireTimeMs)
+		_ = binary.Write(buf, binary.LittleEndian, uint64(obj.GetExpiration().UnixMilli()))
+	}
+	s := obj.Data
+	buf.WriteByte(typeStreamListPacks3)
+	appendString(buf, []byte(key))
+
+	appendLength(buf, uint64(s.Nodes()))
+	s.EachNode(func(master engine.StreamID, entries []engine.StreamEntry) {
+		var nodeKey bytes.Buffer
+		appendRawID(&nodeKey, master)
+		appendString(buf, nodeKey.Bytes())
+		appendString(buf, streamNodeListpack(master, entries))
+	})
+	appendLength(buf, uint64(s.Len()))
+	first, _ := s.First()
+	for _, id := range []engine.StreamID{s.LastID, first.ID, s.MaxDeletedID} {
+		appendLength(buf, id.Ms)
+		appendLength(buf, id.Seq)
+	}
+	appendLength(buf, s.EntriesAdded)
+
+	appendLength(buf, uint64(len(s.Groups)))
+	for _, name := range s.GroupNames() {
+		group := s.Group(name)
+		appendString(buf, []byte(name))
+		appendLength(buf, group.LastID.Ms)
+		appendLength(buf, group.LastID.Seq)
+		appendLength(buf, uint64(group.EntriesRead))
+		pending := engine.PendingIDs(group.Pending, engine.StreamID{}, engine.MaxStreamID)
+		appendLength(buf, uint64(len(pending)))
+		for _, id := range pending {
+			appendRawID(buf, id)
+			appendMillis(buf, group.Pending[id].DeliveryTime)
+			appendLength(buf, group.Pending[id].DeliveryCount)
+		}
+		appendLength(buf, uint64(len(group.Consumers)))
+		for _, consumerName := range group.ConsumerNames() {
+			consumer := group.Consumers[consumerName]
+			appendString(buf, []byte(consumerName))
+			appendMillis(buf, consumer.SeenTime)
+			appendMillis(buf, consumer.ActiveTime)
+			pending := engine.PendingIDs(consumer.Pending, engine.StreamID{}, engine.MaxStreamID)
+			appendLength(buf, uint64(len(pending)))
+			for _, id := range pending {
+				appendRawID(buf, id)
+			}
+		}
+	}
+}
+
+func fromModelID(id *model.StreamId) engine.StreamID {
+	if id == nil {
+		return engine.StreamID{}
+	}
+	return engine.StreamID{Ms: id.Ms, Seq: id.Sequence}
+}
+
+func fromMillis(ms uint64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(int64(ms))
+}
+
+// hasFields reports whether fields holds exactly the given names
+func hasFields(fields map[string]string, names []string) bool {
+	if len(fields) != len(names) {
+		return false
+	}
+	for _, name := range names {
+		if _, ok := fields[name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeStream rebuilds a stream parsed by the decoder library. The library returns
+// the fields of an entry as a map, so entries sharing the fields of their node master
+// keep their order and the others get their fields sorted.
+func decodeStream(obj *model.StreamObject) *engine.Stream {
+	s := engine.NewStream()
+	for _, node := range obj.Entries {
+		for _, msg := range node.Msgs {
+			if msg.Deleted {
+				continue
+			}
+			order := node.Fields
+			if !hasFields(msg.Fields, order) {
+				order = make([]string, 0, len(msg.Fields))
+				for field := range msg.Fields {
+					order = append(order, field)
+				}
+				sort.Strings(order)
+			}
+			fields := make([]string, 0, 2*len(order))
+			for _, field := range order {
+				fields = append(fields, field, msg.Fields[field])
+			}
+			s.Append(fromModelID(msg.Id), fields)
+		}
+	}
+	s.LastID = fromModelID(obj.LastId)
+	s.MaxDeletedID = fromModelID(obj.MaxDeletedId)
+	if obj.AddedEntriesCount > 0 {
+		s.EntriesAdded = obj.AddedEntriesCount
+	}
+	for _, g := range obj.Groups {
+		group, _ := s.CreateGroup(g.Name, fromModelID(g.LastId), int64(g.EntriesRead))
+		nacks := make(map[engine.StreamID]*model.StreamNAck, len(g.Pending))
+		for _, nack := range g.Pending {
+			nacks[fromModelID(nack.Id)] = nack
+		}
+		for _, c := range g.Consumers {
+			consumer, _ := group.Consumer(c.Name, true)
+			consumer.SeenTime = fromMillis(c.SeenTime)
+			consumer.ActiveTime = fromMillis(c.ActiveTime)
+			for _, id := range c.Pending {
+				nack := group.Assign(fromModelID(id), consumer)
+				if parsed, ok := nacks[fromModelID(id)]; ok {
+					nack.DeliveryTime = fromMillis(parsed.DeliveryTime)
+					nack.DeliveryCount = parsed.DeliveryCount
+				}
+			}
+		}
+	}
+	return s
+}
@@ -1,6 +1,9 @@
 package resp
 
 import (
+	"bytes"
+	"math"
+	"math/big"
 	"strconv"
 )
 
@@ -12,6 +15,20 @@ const (
 	Array        = '*'
 	CLRF         = "\r\n"
 	Nil          = "$-1\r\n"
+	NilArray     = "*-1\r\n"
+)
+
+// RESP3 types, sent to the clients that negotiated protocol 3 with HELLO
+const (
+	Null           = '_'
+	Boolean        = '#'
+	Double         = ','
+	BigNumber      = '('
+	VerbatimString = '='
+	Map            = '%'
+	Set            = '~'
+	Attribute      = '|'
+	Push           = '>'
 )
 
 func SimpleStringDecoder(str string) []byte {
@@ -33,3 +50,148 @@ func ArrayDecoder(arr []string) []byte {
 	}
 	return []byte(out)
 }
+func IntegerArrayDecoder(arr []int) []byte {
+	out := string(Array) + strconv.Itoa(len(arr)) + CLRF
+	for _, num := range arr {
+		out += string(IntegerDecoder(num))
+	}
+	return []byte(out)
+}
+
+// RawArrayDecoder wraps already encoded elements, used for nested arrays and arrays holding nil
+func RawArrayDecoder(elements [][]byte) []byte {
+	out := []byte(string(Array) + strconv.Itoa(len(elements)) + CLRF)
+	for _, element := range elements {
+		out = append(out, element...)
+	}
+	return out
+}
+
+func NullDecoder() []byte {
+	return []byte(string(Null) + CLRF)
+}
+func BooleanDecoder(b bool) []byte {
+	if b {
+		return []byte(string(Boolean) + "t" + CLRF)
+	}
+	return []byte(string(Boolean) + "f" + CLRF)
+}
+
+// DoubleDecoder encodes f in its shortest exact form, infinities as inf and -inf
+func DoubleDecoder(f float64) []byte {
+	var str string
+	switch {
+	case math.IsInf(f, 1):
+		str = "inf"
+	case math.IsInf(f, -1):
+		str = "-inf"
+	case math.IsNaN(f):
+		str = "nan"
+	default:
+		str = strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return []byte(string(Double) + str + CLRF)
+}
+func BigNumberDecoder(num *big.Int) []byte {
+	return []byte(string(BigNumber) + num.String() + CLRF)
+}
+
+// VerbatimStringDecoder encodes str with its three letters format, txt or mkd
+func VerbatimStringDecoder(format, str string) []byte {
+	return []byte(string(VerbatimString) + strconv.Itoa(len(format)+1+len(str)) + CLRF + format + ":" + str + CLRF)
+}
+
+// MapDecoder encodes flat key/value pairs
+func MapDecoder(pairs []string) []byte {
+	out := []byte(string(Map) + strconv.Itoa(len(pairs)/2) + CLRF)
+	for _, str := range pairs {
+		out = append(out, BulkStringDecoder(str)...)
+	}
+	return out
+}
+
+// RawMapDecoder wraps already encoded keys and values, given as flat pairs
+func RawMapDecoder(pairs [][]byte) []byte {
+	return aggregate(Map, len(pairs)/2, pairs)
+}
+func SetDecoder(arr []string) []byte {
+	out := []byte(string(Set) + strconv.Itoa(len(arr)) + CLRF)
+	for _, str := range arr {
+		out = append(out, BulkStringDecoder(str)...)
+	}
+	return out
+}
+
+// AttributeDecoder wraps already encoded flat pairs, to be sent right before the reply they
+// describe
+func AttributeDecoder(pairs [][]byte) []byte {
+	return aggregate(Attribute, len(pairs)/2, pairs)
+}
+
+// PushDecoder wraps already encoded elements of an out-of-band message, like pub/sub messages
+func PushDecoder(elements [][]byte) []byte {
+	return aggregate(Push, len(elements), elements)
+}
+
+func aggregate(kind byte, n int, elements [][]byte) []byte {
+	out := []byte(string(kind) + strconv.Itoa(n) + CLRF)
+	for _, element := range elements {
+		out = append(out, element...)
+	}
+	return out
+}
+
+// ReplaceNils returns reply with its nil bulk strings and nil arrays, nested in aggregates
+// or not, replaced by the null of RESP3. A reply that does not parse is returned unchanged.
+func ReplaceNils(reply []byte) []byte {
+	if !bytes.Contains(reply, []byte("-1"+CLRF)) {
+		return reply
+	}
+	out := make([]byte, 0, len(reply))
+	for rest := reply; len(rest) > 0; {
+		var ok bool
+		out, rest, ok = replaceNils(out, rest)
+		if !ok {
+			return reply
+		}
+	}
+	return out
+}
+
+// replaceNils appends the element at the start of in to out, it returns the rest of in
+func replaceNils(out, in []byte) ([]byte, []byte, bool) {
+	end := bytes.Index(in, []byte(CLRF))
+	if end < 1 {
+		return out, in, false
+	}
+	header, rest := in[:end+2], in[end+2:]
+	switch in[0] {
+	case BulkString, VerbatimString, Array, Map, Set, Attribute, Push:
+	default:
+		return append(out, header...), rest, true
+	}
+	n, err := strconv.Atoi(string(in[1:end]))
+	if err != nil {
+		return out, in, false
+	}
+	if n < 0 {
+		return append(out, NullDecoder()...), rest, true
+	}
+	switch in[0] {
+	case BulkString, VerbatimString:
+		if len(rest) < n+2 {
+			return out, in, false
+		}
+		return append(append(out, header...), rest[:n+2]...), rest[n+2:], true
+	case Map, Attribute:
+		n *= 2
+	}
+	out = append(out, header...)
+	for i := 0; i < n; i++ {
+		var ok bool
+		if out, rest, ok = replaceNils(out, rest); !ok {
+			return out, in, false
+		}
+	}
+	return out, rest, true
+}
@@ -0,0 +1,364 @@
+package server
+
+import (
+	"errors"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/engine"
+)
+
+// Clients parked by blocking commands.
+// A waiter is registered under every key it waits on while the store lock is held,
+// so a push that happens after the registration always finds it.
+// Waiters are served in FIFO order by the goroutine of the command that made a key ready,
+// the parked goroutine only formats the reply.
+// Stream readers do not consume what they read, so XADD wakes every reader of the key
+// and each of them runs its read again on its own goroutine. They are woken after XADD
+// was propagated, so replicas get the entries before the deliveries of consumer groups.
+
+var (
+	ErrTimeoutNotFloat   = errors.New("ERR timeout is not a float or out of range")
+	ErrTimeoutNotInteger = errors.New("ERR timeout is not an integer or out of range")
+	ErrTimeoutNegative   = errors.New("ERR timeout is negative")
+)
+
+type blockKey struct {
+	store *engine.DbStore
+	key   string
+}
+
+type listResult struct {
+	key   string
+	value string
+	err   []byte
+}
+
+type listWaiter struct {
+	keys   []string
+	head   bool
+	move   bool
+	dest   string
+	toHead bool
+	served bool
+	result chan listResult
+}
+
+type blockingRegistry struct {
+	mu      sync.Mutex
+	waiters map[blockKey][]*listWaiter
+}
+
+var blockedClients = &blockingRegistry{
+	waiters: make(map[blockKey][]*listWaiter),
+}
+
+func newListWaiter(keys []string) *listWaiter {
+	return &listWaiter{
+		keys:   keys,
+		result: make(chan listResult, 1),
+	}
+}
+
+func (r *blockingRegistry) add(store *engine.DbStore, waiter *listWaiter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, key := range waiter.keys {
+		bk := blockKey{store, key}
+		r.waiters[bk] = append(r.waiters[bk], waiter)
+	}
+}
+
+// next removes the oldest waiter blocked on key from every queue it is in and marks it served
+func (r *blockingRegistry) next(store *engine.DbStore, key string) *listWaiter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	queue := r.waiters[blockKey{store, key}]
+	if len(queue) == 0 {
+		return nil
+	}
+	waiter := queue[0]
+	waiter.served = true
+	r.remove(store, waiter)
+	return waiter
+}
+
+// cancel unregisters a waiter that timed out, it returns false if the waiter was served first
+func (r *blockingRegistry) cancel(store *engine.DbStore, waiter *listWaiter) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if waiter.served {
+		return false
+	}
+	r.remove(store, waiter)
+	return true
+}
+
+// keys returns the keys of store that clients are blocked on
+func (r *blockingRegistry) keys(store *engine.DbStore) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var keys []string
+	for bk := range r.waiters {
+		if bk.store == store {
+			keys = append(keys, bk.key)
+		}
+	}
+	return keys
+}
+
+// count returns the number of waiters blocked on keys of store
+func (r *blockingRegistry) count(store *engine.DbStore) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	waiters := make(map[*listWaiter]struct{})
+	for bk, queue := range r.waiters {
+		if bk.store == store {
+			for _, waiter := range queue {
+				waiters[waiter] = struct{}{}
+			}
+		}
+	}
+	return len(waiters)
+}
+
+func (r *blockingRegistry) remove(store *engine.DbStore, waiter *listWaiter) {
+	for _, key := range waiter.keys {
+		bk := blockKey{store, key}
+		queue := r.waiters[bk]
+		kept := queue[:0]
+		for _, w := range queue {
+			if w != waiter {
+				kept = append(kept, w)
+			}
+		}
+		if len(kept) == 0 {
+			delete(r.waiters, bk)
+		} else {
+			r.waiters[bk] = kept
+		}
+	}
+}
+
+type streamWaiter struct {
+	keys  []string
+	ready chan struct{}
+}
+
+type streamRegistry struct {
+	mu      sync.Mutex
+	waiters map[blockKey][]*streamWaiter
+}
+
+var blockedReaders = &streamRegistry{
+	waiters: make(map[blockKey][]*streamWaiter),
+}
+
+func newStreamWaiter(keys []string) *streamWaiter {
+	return &streamWaiter{
+		keys:  keys,
+		ready: make(chan struct{}, 1),
+	}
+}
+
+func (r *streamRegistry) add(store *engine.DbStore, waiter *streamWaiter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, key := range waiter.keys {
+		bk := blockKey{store, key}
+		r.waiters[bk] = append(r.waiters[bk], waiter)
+	}
+}
+
+func (r *streamRegistry) remove(store *engine.DbStore, waiter *streamWaiter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, key := range waiter.keys {
+		bk := blockKey{store, key}
+		queue := r.waiters[bk]
+		kept := queue[:0]
+		for _, w := range queue {
+			if w != waiter {
+				kept = append(kept, w)
+			}
+		}
+		if len(kept) == 0 {
+			delete(r.waiters, bk)
+		} else {
+			r.waiters[bk] = kept
+		}
+	}
+}
+
+// keys returns the keys of store that readers are blocked on
+func (r *streamRegistry) keys(store *engine.DbStore) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var keys []string
+	for bk := range r.waiters {
+		if bk.store == store {
+			keys = append(keys, bk.key)
+		}
+	}
+	return keys
+}
+
+// count returns the number of readers blocked on keys of store
+func (r *streamRegistry) count(store *engine.DbStore) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	waiters := make(map[*streamWaiter]struct{})
+	for bk, queue := range r.waiters {
+		if bk.store == store {
+			for _, waiter := range queue {
+				waiters[waiter] = struct{}{}
+			}
+		}
+	}
+	return len(waiters)
+}
+
+// BlockedClients returns the number of clients blocked on keys of store
+func BlockedClients(store *engine.DbStore) int {
+	return blockedClients.count(store) + blockedReaders.count(store)
+}
+
+// signalStreamReady wakes the readers blocked on the stream at key once the command was propagated
+func (request *Request) signalStreamReady(store *engine.DbStore, key string) {
+	request.readyStreams = append(request.readyStreams, blockKey{store, key})
+}
+
+// signal wakes every reader blocked on key. A reader registers under the store lock after
+// its first read, so it either sees the new entries or is registered when signal runs.
+func (r *streamRegistry) signal(store *engine.DbStore, key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, waiter := range r.waiters[blockKey{store, key}] {
+		select {
+		case waiter.ready <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// parseTimeout parses a blocking timeout given in (fractional) seconds, zero means forever
+func parseTimeout(arg string) (time.Duration, error) {
+	seconds, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return 0, ErrTimeoutNotFloat
+	}
+	if seconds < 0 {
+		return 0, ErrTimeoutNegative
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// parseTimeoutMillis parses the BLOCK argument of stream reads, zero means forever
+func parseTimeoutMillis(arg string) (time.Duration, error) {
+	ms, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || ms > math.MaxInt64/int64(time.Millisecond) {
+		return 0, ErrTimeoutNotInteger
+	}
+	if ms < 0 {
+		return 0, ErrTimeoutNegative
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// waitForStreams runs read until it returns a reply, the timeout expires or the client
+// disconnects. read is called with the store lock held, first right away and then every
+// time an entry is added to one of keys. A negative timeout, or a transaction, does not
+// block at all. ok is false when read never returned a reply.
+func waitForStreams(request *Request, store *engine.DbStore, keys []string, timeout time.Duration, read func() ([]byte, bool)) ([]byte, bool) {
+	waiter := newStreamWaiter(keys)
+	store.Mu.Lock()
+	if out, ok := read(); ok || timeout < 0 || request.inExec {
+		store.Mu.Unlock()
+		return out, ok
+	}
+	blockedReaders.add(store, waiter)
+	store.Mu.Unlock()
+	defer blockedReaders.remove(store, waiter)
+	defer request.parkGate()()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	closed, stop := watchDisconnect(request)
+	defer stop()
+
+	for {
+		select {
+		case <-waiter.ready:
+		case <-expired:
+			return nil, false
+		case <-closed:
+			return nil, false
+		}
+		store.Mu.Lock()
+		out, ok := read()
+		store.Mu.Unlock()
+		if ok {
+			return out, true
+		}
+	}
+}
+
+// waitForList parks the calling goroutine until the waiter is served, the timeout expires
+// or the client disconnects. ok is false when the waiter was not served. Inside a
+// transaction the timeout expires right away.
+func waitForList(request *Request, store *engine.DbStore, waiter *listWaiter, timeout time.Duration) (listResult, bool) {
+	if !request.inExec {
+		defer request.parkGate()()
+		var expired <-chan time.Time
+		if timeout > 0 {
+			timer := time.NewTimer(timeout)
+			defer timer.Stop()
+			expired = timer.C
+		}
+		closed, stop := watchDisconnect(request)
+		defer stop()
+
+		select {
+		case res := <-waiter.result:
+			return res, true
+		case <-expired:
+		case <-closed:
+		}
+	}
+	if blockedClients.cancel(store, waiter) {
+		return listResult{}, false
+	}
+	// served while we were timing out
+	return <-waiter.result, true
+}
+
+// watchDisconnect reports on closed when the client goes away while its goroutine is parked.
+// stop must be called before the connection reader is used again.
+func watchDisconnect(request *Request) (<-chan struct{}, func()) {
+	closed := make(chan struct{})
+	if request.Conn == nil || request.Reader == nil {
+		return closed, func() {}
+	}
+	conn := *request.Conn
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := request.Reader.Peek(1)
+		if err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
+			close(closed)
+		}
+	}()
+	stop := func() {
+		conn.SetReadDeadline(time.Now())
+		<-done
+		conn.SetReadDeadline(time.Time{})
+	}
+	return closed, stop
+}
@@ -17,6 +17,12 @@ var (
 	ErrInvalidLength      = errors.New("invalid length")
 	ErrEmptyCommand       = errors.New("empty command")
 	ErrInvalidCommand     = errors.New("invalid command")
+	ErrWrongType          = errors.New("wrong type")
+)
+
+const (
+	WrongTypeErr  = "WRONGTYPE Operation against a key holding the wrong kind of value"
+	NotIntegerErr = "ERR value is not an integer or out of range"
 )
 
 type HandlerCmd func(request *Request) ([]byte, error)
@@ -27,6 +33,7 @@ var (
 	writeCommand         map[string]bool
 	propagateCommand     map[string]bool
 	suppressReplyCommand map[string]bool
+	arityCommand         map[string]int
 )
 
 type Command struct {
@@ -36,42 +43,628 @@ type Command struct {
 	SuppressReply  bool
 	IsWritable     bool
 	Handle         HandlerCmd
+	// number of arguments including the name like in redis, -n for at least n
+	Arity int
+	// database a command queued by alsoPropagate applies to
+	Db int
 }
 
 func InitCommands() {
 	lookUpCommands = map[string]HandlerCmd{
-		"SET":      set,
-		"GET":      get,
-		"ECHO":     echo,
-		"PING":     ping,
-		"CONFIG":   config,
-		"KEYS":     keys,
-		"INFO":     info,
-		"PSYNC":    psync,
-		"REPLCONF": replconf,
-		"WAIT":     wait,
-		"SELECT":   selectIndex,
+		"SET":              set,
+		"GET":              get,
+		"INCR":             incr,
+		"DECR":             decr,
+		"INCRBY":           incrby,
+		"DECRBY":           decrby,
+		"INCRBYFLOAT":      incrbyfloat,
+		"APPEND":           appendCommand,
+		"STRLEN":           strlen,
+		"GETRANGE":         getrange,
+		"SETRANGE":         setrange,
+		"GETDEL":           getdel,
+		"GETEX":            getex,
+		"GETSET":           getset,
+		"LCS":              lcs,
+		"MGET":             mget,
+		"MSET":             mset,
+		"MSETNX":           msetnx,
+		"DEL":              del,
+		"UNLINK":           unlink,
+		"EXISTS":           exists,
+		"TOUCH":            touch,
+		"TYPE":             typeCommand,
+		"RENAME":           rename,
+		"RENAMENX":         renamenx,
+		"COPY":             copyCommand,
+		"MOVE":             moveCommand,
+		"SWAPDB":           swapdb,
+		"FLUSHDB":          flushdb,
+		"FLUSHALL":         flushall,
+		"RANDOMKEY":        randomkey,
+		"DBSIZE":           dbsize,
+		"EXPIRE":           expire,
+		"PEXPIRE":          pexpire,
+		"EXPIREAT":         expireat,
+		"PEXPIREAT":        pexpireat,
+		"TTL":              ttl,
+		"PTTL":             pttl,
+		"EXPIRETIME":       expiretime,
+		"PEXPIRETIME":      pexpiretime,
+		"PERSIST":          persist,
+		"ECHO":             echo,
+		"PING":             ping,
+		"CONFIG":           config,
+		"KEYS":             keys,
+		"SCAN":             scan,
+		"INFO":             info,
+		"PSYNC":            psync,
+		"REPLCONF":         replconf,
+		"WAIT":             wait,
+		"SELECT":           selectIndex,
+		"LPUSH":            lpush,
+		"RPUSH":            rpush,
+		"LPUSHX":           lpushx,
+		"RPUSHX":           rpushx,
+		"LPOP":             lpop,
+		"RPOP":             rpop,
+		"LLEN":             llen,
+		"LRANGE":           lrange,
+		"LINDEX":           lindex,
+		"LSET":             lset,
+		"LREM":             lrem,
+		"LTRIM":            ltrim,
+		"LINSERT":          linsert,
+		"LPOS":             lpos,
+		"LMOVE":            lmove,
+		"RPOPLPUSH":        rpoplpush,
+		"BLPOP":            blpop,
+		"BRPOP":            brpop,
+		"BLMOVE":           blmove,
+		"BRPOPLPUSH":       brpoplpush,
+		"HSET":             hset,
+		"HSETNX":           hsetnx,
+		"HMSET":            hmset,
+		"HGET":             hget,
+		"HMGET":            hmget,
+		"HDEL":             hdel,
+		"HGETALL":          hgetall,
+		"HKEYS":            hkeys,
+		"HVALS":            hvals,
+		"HLEN":             hlen,
+		"HEXISTS":          hexists,
+		"HSTRLEN":          hstrlen,
+		"HINCRBY":          hincrby,
+		"HINCRBYFLOAT":     hincrbyfloat,
+		"HRANDFIELD":       hrandfield,
+		"HSCAN":            hscan,
+		"SADD":             sadd,
+		"SREM":             srem,
+		"SMEMBERS":         smembers,
+		"SISMEMBER":        sismember,
+		"SMISMEMBER":       smismember,
+		"SCARD":            scard,
+		"SMOVE":            smove,
+		"SPOP":             spop,
+		"SRANDMEMBER":      srandmember,
+		"SINTER":           sinter,
+		"SUNION":           sunion,
+		"SDIFF":            sdiff,
+		"SINTERSTORE":      sinterstore,
+		"SUNIONSTORE":      sunionstore,
+		"SDIFFSTORE":       sdiffstore,
+		"SINTERCARD":       sintercard,
+		"SSCAN":            sscan,
+		"ZADD":             zadd,
+		"ZINCRBY":          zincrby,
+		"ZREM":             zrem,
+		"ZCARD":            zcard,
+		"ZSCORE":           zscore,
+		"ZMSCORE":          zmscore,
+		"ZRANK":            zrank,
+		"ZREVRANK":         zrevrank,
+		"ZCOUNT":           zcount,
+		"ZLEXCOUNT":        zlexcount,
+		"ZRANGE":           zrange,
+		"ZREVRANGE":        zrevrange,
+		"ZRANGEBYSCORE":    zrangebyscore,
+		"ZREVRANGEBYSCORE": zrevrangebyscore,
+		"ZRANGEBYLEX":      zrangebylex,
+		"ZREVRANGEBYLEX":   zrevrangebylex,
+		"ZPOPMIN":          zpopmin,
+		"ZPOPMAX":          zpopmax,
+		"ZREMRANGEBYRANK":  zremrangebyrank,
+		"ZREMRANGEBYSCORE": zremrangebyscore,
+		"ZREMRANGEBYLEX":   zremrangebylex,
+		"ZSCAN":            zscan,
+		"XADD":             xadd,
+		"XRANGE":           xrange,
+		"XREVRANGE":        xrevrange,
+		"XLEN":             xlen,
+		"XTRIM":            xtrim,
+		"XDEL":             xdel,
+		"XGROUP":           xgroup,
+		"XREADGROUP":       xreadgroup,
+		"XREAD":            xread,
+		"XACK":             xack,
+		"XPENDING":         xpending,
+		"XCLAIM":           xclaim,
+		"XAUTOCLAIM":       xautoclaim,
+		"XINFO":            xinfo,
+		"MULTI":            multi,
+		"EXEC":             exec,
+		"DISCARD":          discard,
+		"WATCH":            watch,
+		"UNWATCH":          unwatch,
+		"SUBSCRIBE":        subscribe,
+		"UNSUBSCRIBE":      unsubscribe,
+		"PSUBSCRIBE":       psubscribe,
+		"PUNSUBSCRIBE":     punsubscribe,
+		"PUBLISH":          publish,
+		"SSUBSCRIBE":       ssubscribe,
+		"SUNSUBSCRIBE":     sunsubscribe,
+		"SPUBLISH":         spublish,
+		"PUBSUB":           pubsub,
+		"QUIT":             quit,
+		"HELLO":            hello,
+		"CLIENT":           clientCommand,
 	}
 
 	writeCommand = map[string]bool{
-		"SET": true,
+		"SET":              true,
+		"INCR":             true,
+		"DECR":             true,
+		"INCRBY":           true,
+		"DECRBY":           true,
+		"INCRBYFLOAT":      true,
+		"APPEND":           true,
+		"SETRANGE":         true,
+		"GETDEL":           true,
+		"GETEX":            true,
+		"GETSET":           true,
+		"MSET":             true,
+		"MSETNX":           true,
+		"DEL":              true,
+		"UNLINK":           true,
+		"RENAME":           true,
+		"RENAMENX":         true,
+		"COPY":             true,
+		"MOVE":             true,
+		"SWAPDB":           true,
+		"FLUSHDB":          true,
+		"FLUSHALL":         true,
+		"EXPIRE":           true,
+		"PEXPIRE":          true,
+		"EXPIREAT":         true,
+		"PEXPIREAT":        true,
+		"PERSIST":          true,
+		"LPUSH":            true,
+		"RPUSH":            true,
+		"LPUSHX":           true,
+		"RPUSHX":           true,
+		"LPOP":             true,
+		"RPOP":             true,
+		"LSET":             true,
+		"LREM":             true,
+		"LTRIM":            true,
+		"LINSERT":          true,
+		"LMOVE":            true,
+		"RPOPLPUSH":        true,
+		"BLPOP":            true,
+		"BRPOP":            true,
+		"BLMOVE":           true,
+		"BRPOPLPUSH":       true,
+		"HSET":             true,
+		"HSETNX":           true,
+		"HMSET":            true,
+		"HDEL":             true,
+		"HINCRBY":          true,
+		"HINCRBYFLOAT":     true,
+		"SADD":             true,
+		"SREM":             true,
+		"SMOVE":            true,
+		"SPOP":             true,
+		"SINTERSTORE":      true,
+		"SUNIONSTORE":      true,
+		"SDIFFSTORE":       true,
+		"ZADD":             true,
+		"ZINCRBY":          true,
+		"ZREM":             true,
+		"ZPOPMIN":          true,
+		"ZPOPMAX":          true,
+		"ZREMRANGEBYRANK":  true,
+		"ZREMRANGEBYSCORE": true,
+		"ZREMRANGEBYLEX":   true,
+		"XADD":             true,
+		"XTRIM":            true,
+		"XDEL":             true,
+		"XGROUP":           true,
+		"XREADGROUP":       true,
+		"XACK":             true,
+		"XCLAIM":           true,
+		"XAUTOCLAIM":       true,
 	}
 
+	// blocking commands are propagated as the non-blocking pops they perform,
+	// SET with an absolute PXAT, GETDEL as DEL, the EXPIRE family and GETEX as PEXPIREAT,
+	// HINCRBYFLOAT as the HSET of its result, INCRBYFLOAT as SET KEEPTTL, SPOP as SREM of the popped members
+	// XADD / XTRIM with the final ID and an exact trim, and stream deliveries as XCLAIM
 	propagateCommand = map[string]bool{
-		"SET": true,
+		"INCR":             true,
+		"DECR":             true,
+		"INCRBY":           true,
+		"DECRBY":           true,
+		"APPEND":           true,
+		"SETRANGE":         true,
+		"GETSET":           true,
+		"MSET":             true,
+		"MSETNX":           true,
+		"DEL":              true,
+		"UNLINK":           true,
+		"RENAME":           true,
+		"RENAMENX":         true,
+		"COPY":             true,
+		"MOVE":             true,
+		"SWAPDB":           true,
+		"FLUSHDB":          true,
+		"FLUSHALL":         true,
+		"PERSIST":          true,
+		"LPUSH":            true,
+		"RPUSH":            true,
+		"LPUSHX":           true,
+		"RPUSHX":           true,
+		"LPOP":             true,
+		"RPOP":             true,
+		"LSET":             true,
+		"LREM":             true,
+		"LTRIM":            true,
+		"LINSERT":          true,
+		"LMOVE":            true,
+		"RPOPLPUSH":        true,
+		"HSET":             true,
+		"HSETNX":           true,
+		"HMSET":            true,
+		"HDEL":             true,
+		"HINCRBY":          true,
+		"SADD":             true,
+		"SREM":             true,
+		"SMOVE":            true,
+		"SINTERSTORE":      true,
+		"SUNIONSTORE":      true,
+		"SDIFFSTORE":       true,
+		"ZADD":             true,
+		"ZINCRBY":          true,
+		"ZREM":             true,
+		"ZPOPMIN":          true,
+		"ZPOPMAX":          true,
+		"ZREMRANGEBYRANK":  true,
+		"ZREMRANGEBYSCORE": true,
+		"ZREMRANGEBYLEX":   true,
+		"XDEL":             true,
+		"XGROUP":           true,
+		"XACK":             true,
+		"PUBLISH":          true,
+		"SPUBLISH":         true,
 	}
 
 	suppressReplyCommand = map[string]bool{
-		"SET":      true,
-		"GET":      true,
-		"ECHO":     true,
-		"PING":     true,
-		"CONFIG":   true,
-		"KEYS":     true,
-		"INFO":     true,
-		"PSYNC":    true,
-		"REPLCONF": false,
-		"SELECT":   true,
+		"SET":              true,
+		"GET":              true,
+		"INCR":             true,
+		"DECR":             true,
+		"INCRBY":           true,
+		"DECRBY":           true,
+		"INCRBYFLOAT":      true,
+		"APPEND":           true,
+		"STRLEN":           true,
+		"GETRANGE":         true,
+		"SETRANGE":         true,
+		"GETDEL":           true,
+		"GETEX":            true,
+		"GETSET":           true,
+		"MSET":             true,
+		"MSETNX":           true,
+		"DEL":              true,
+		"UNLINK":           true,
+		"EXISTS":           true,
+		"TOUCH":            true,
+		"TYPE":             true,
+		"RENAME":           true,
+		"RENAMENX":         true,
+		"COPY":             true,
+		"MOVE":             true,
+		"SWAPDB":           true,
+		"FLUSHDB":          true,
+		"FLUSHALL":         true,
+		"RANDOMKEY":        true,
+		"DBSIZE":           true,
+		"EXPIRE":           true,
+		"PEXPIRE":          true,
+		"EXPIREAT":         true,
+		"PEXPIREAT":        true,
+		"TTL":              true,
+		"PTTL":             true,
+		"EXPIRETIME":       true,
+		"PEXPIRETIME":      true,
+		"PERSIST":          true,
+		"LCS":              true,
+		"MGET":             true,
+		"ECHO":             true,
+		"PING":             true,
+		"CONFIG":           true,
+		"KEYS":             true,
+		"SCAN":             true,
+		"INFO":             true,
+		"PSYNC":            true,
+		"REPLCONF":         false,
+		"SELECT":           true,
+		"LPUSH":            true,
+		"RPUSH":            true,
+		"LPUSHX":           true,
+		"RPUSHX":           true,
+		"LPOP":             true,
+		"RPOP":             true,
+		"LLEN":             true,
+		"LRANGE":           true,
+		"LINDEX":           true,
+		"LSET":             true,
+		"LREM":             true,
+		"LTRIM":            true,
+		"LINSERT":          true,
+		"LPOS":             true,
+		"LMOVE":            true,
+		"RPOPLPUSH":        true,
+		"BLPOP":            true,
+		"BRPOP":            true,
+		"BLMOVE":           true,
+		"BRPOPLPUSH":       true,
+		"HSET":             true,
+		"HSETNX":           true,
+		"HMSET":            true,
+		"HGET":             true,
+		"HMGET":            true,
+		"HDEL":             true,
+		"HGETALL":          true,
+		"HKEYS":            true,
+		"HVALS":            true,
+		"HLEN":             true,
+		"HEXISTS":          true,
+		"HSTRLEN":          true,
+		"HINCRBY":          true,
+		"HINCRBYFLOAT":     true,
+		"HRANDFIELD":       true,
+		"HSCAN":            true,
+		"SADD":             true,
+		"SREM":             true,
+		"SMEMBERS":         true,
+		"SISMEMBER":        true,
+		"SMISMEMBER":       true,
+		"SCARD":            true,
+		"SMOVE":            true,
+		"SPOP":             true,
+		"SRANDMEMBER":      true,
+		"SINTER":           true,
+		"SUNION":           true,
+		"SDIFF":            true,
+		"SINTERSTORE":      true,
+		"SUNIONSTORE":      true,
+		"SDIFFSTORE":       true,
+		"SINTERCARD":       true,
+		"SSCAN":            true,
+		"ZADD":             true,
+		"ZINCRBY":          true,
+		"ZREM":             true,
+		"ZCARD":            true,
+		"ZSCORE":           true,
+		"ZMSCORE":          true,
+		"ZRANK":            true,
+		"ZREVRANK":         true,
+		"ZCOUNT":           true,
+		"ZLEXCOUNT":        true,
+		"ZRANGE":           true,
+		"ZREVRANGE":        true,
+		"ZRANGEBYSCORE":    true,
+		"ZREVRANGEBYSCORE": true,
+		"ZRANGEBYLEX":      true,
+		"ZREVRANGEBYLEX":   true,
+		"ZPOPMIN":          true,
+		"ZPOPMAX":          true,
+		"ZREMRANGEBYRANK":  true,
+		"ZREMRANGEBYSCORE": true,
+		"ZREMRANGEBYLEX":   true,
+		"ZSCAN":            true,
+		"XADD":             true,
+		"XRANGE":           true,
+		"XREVRANGE":        true,
+		"XLEN":             true,
+		"XTRIM":            true,
+		"XDEL":             true,
+		"XGROUP":           true,
+		"XREAD":            true,
+		"XREADGROUP":       true,
+		"XACK":             true,
+		"XPENDING":         true,
+		"XCLAIM":           true,
+		"XAUTOCLAIM":       true,
+		"XINFO":            true,
+		"MULTI":            true,
+		"EXEC":             true,
+		"DISCARD":          true,
+		"WATCH":            true,
+		"UNWATCH":          true,
+		"SUBSCRIBE":        true,
+		"UNSUBSCRIBE":      true,
+		"PSUBSCRIBE":       true,
+		"PUNSUBSCRIBE":     true,
+		"PUBLISH":          true,
+		"PUBSUB":           true,
+		"SSUBSCRIBE":       true,
+		"SUNSUBSCRIBE":     true,
+		"SPUBLISH":         true,
+		"QUIT":             true,
+		"HELLO":            true,
+		"CLIENT":           true,
+	}
+
+	// checked when a command is queued by MULTI, handlers check their arguments themselves
+	arityCommand = map[string]int{
+		"SET":              -3,
+		"GET":              2,
+		"INCR":             2,
+		"DECR":             2,
+		"INCRBY":           3,
+		"DECRBY":           3,
+		"INCRBYFLOAT":      3,
+		"APPEND":           3,
+		"STRLEN":           2,
+		"GETRANGE":         4,
+		"SETRANGE":         4,
+		"GETDEL":           2,
+		"GETEX":            -2,
+		"GETSET":           3,
+		"LCS":              -3,
+		"MGET":             -2,
+		"MSET":             -3,
+		"MSETNX":           -3,
+		"DEL":              -2,
+		"UNLINK":           -2,
+		"EXISTS":           -2,
+		"TOUCH":            -2,
+		"TYPE":             2,
+		"RENAME":           3,
+		"RENAMENX":         3,
+		"COPY":             -3,
+		"MOVE":             3,
+		"SWAPDB":           3,
+		"FLUSHDB":          -1,
+		"FLUSHALL":         -1,
+		"RANDOMKEY":        1,
+		"DBSIZE":           1,
+		"EXPIRE":           -3,
+		"PEXPIRE":          -3,
+		"EXPIREAT":         -3,
+		"PEXPIREAT":        -3,
+		"TTL":              2,
+		"PTTL":             2,
+		"EXPIRETIME":       2,
+		"PEXPIRETIME":      2,
+		"PERSIST":          2,
+		"ECHO":             2,
+		"PING":             -1,
+		"CONFIG":           -2,
+		"KEYS":             2,
+		"SCAN":             -2,
+		"INFO":             -1,
+		"PSYNC":            -3,
+		"REPLCONF":         -1,
+		"WAIT":             3,
+		"SELECT":           2,
+		"LPUSH":            -3,
+		"RPUSH":            -3,
+		"LPUSHX":           -3,
+		"RPUSHX":           -3,
+		"LPOP":             -2,
+		"RPOP":             -2,
+		"LLEN":             2,
+		"LRANGE":           4,
+		"LINDEX":           3,
+		"LSET":             4,
+		"LREM":             4,
+		"LTRIM":            4,
+		"LINSERT":          5,
+		"LPOS":             -3,
+		"LMOVE":            5,
+		"RPOPLPUSH":        3,
+		"BLPOP":            -3,
+		"BRPOP":            -3,
+		"BLMOVE":           6,
+		"BRPOPLPUSH":       4,
+		"HSET":             -4,
+		"HSETNX":           4,
+		"HMSET":            -4,
+		"HGET":             3,
+		"HMGET":            -3,
+		"HDEL":             -3,
+		"HGETALL":          2,
+		"HKEYS":            2,
+		"HVALS":            2,
+		"HLEN":             2,
+		"HEXISTS":          3,
+		"HSTRLEN":          3,
+		"HINCRBY":          4,
+		"HINCRBYFLOAT":     4,
+		"HRANDFIELD":       -2,
+		"HSCAN":            -3,
+		"SADD":             -3,
+		"SREM":             -3,
+		"SMEMBERS":         2,
+		"SISMEMBER":        3,
+		"SMISMEMBER":       -3,
+		"SCARD":            2,
+		"SMOVE":            4,
+		"SPOP":             -2,
+		"SRANDMEMBER":      -2,
+		"SINTER":           -2,
+		"SUNION":           -2,
+		"SDIFF":            -2,
+		"SINTERSTORE":      -3,
+		"SUNIONSTORE":      -3,
+		"SDIFFSTORE":       -3,
+		"SINTERCARD":       -3,
+		"SSCAN":            -3,
+		"ZADD":             -4,
+		"ZINCRBY":          4,
+		"ZREM":             -3,
+		"ZCARD":            2,
+		"ZSCORE":           3,
+		"ZMSCORE":          -3,
+		"ZRANK":            -3,
+		"ZREVRANK":         -3,
+		"ZCOUNT":           4,
+		"ZLEXCOUNT":        4,
+		"ZRANGE":           -4,
+		"ZREVRANGE":        -4,
+		"ZRANGEBYSCORE":    -4,
+		"ZREVRANGEBYSCORE": -4,
+		"ZRANGEBYLEX":      -4,
+		"ZREVRANGEBYLEX":   -4,
+		"ZPOPMIN":          -2,
+		"ZPOPMAX":          -2,
+		"ZREMRANGEBYRANK":  4,
+		"ZREMRANGEBYSCORE": 4,
+		"ZREMRANGEBYLEX":   4,
+		"ZSCAN":            -3,
+		"XADD":             -5,
+		"XRANGE":           -4,
+		"XREVRANGE":        -4,
+		"XLEN":             2,
+		"XTRIM":            -4,
+		"XDEL":             -3,
+		"XGROUP":           -2,
+		"XREADGROUP":       -7,
+		"XREAD":            -4,
+		"XACK":             -4,
+		"XPENDING":         -3,
+		"XCLAIM":           -6,
+		"XAUTOCLAIM":       -6,
+		"XINFO":            -2,
+		"MULTI":            1,
+		"EXEC":             1,
+		"DISCARD":          1,
+		"WATCH":            -2,
+		"UNWATCH":          1,
+		"SUBSCRIBE":        -2,
+		"UNSUBSCRIBE":      -1,
+		"PSUBSCRIBE":       -2,
+		"PUNSUBSCRIBE":     -1,
+		"PUBLISH":          3,
+		"SSUBSCRIBE":       -2,
+		"SUNSUBSCRIBE":     -1,
+		"SPUBLISH":         3,
+		"PUBSUB":           -2,
+		"QUIT":             -1,
+		"HELLO":            -1,
+		"CLIENT":           -2,
 	}
 }
 
@@ -110,10 +703,11 @@ func ReadCommand(reader *bufio.Reader) (Command, error) {
 	} else {
 		return Command{}, ErrInvalidFormat
 	}
+	// an unknown command keeps its name, a transaction replies to it
 	cmd, err := CreateCommand(parts[0], parts[1:])
 
 	if err != nil {
-		return Command{}, err
+		return cmd, err
 	}
 
 	return cmd, nil
@@ -122,22 +716,81 @@ func ProcessCommand(request *Request) ([]byte, error) {
 	handler := request.Cmd.Handle
 	serv := request.Serv
 	cmd := request.Cmd
+	if request.Client == nil {
+		request.Client = &Client{}
+	}
+	if request.Client.subscribed() && !request.Client.resp3() && !allowedWhileSubscribed(cmd.Name) {
+		return subscriberModeError(cmd), ErrInvalidFormat
+	}
+	if request.Client.multi && !isTransactionControl(cmd.Name) {
+		return queueCommand(request)
+	}
 	if handler == nil {
 		return resp.ErrorDecoder("ERR unknown command"), ErrInvalidFormat
 	}
+	unlock := request.lockGate()
+	defer unlock()
 	out, err := handler(request)
+	// the keys the command found expired are deleted first on replicas
+	for i, store := range serv.databases() {
+		propagateExpired(serv, i, deleteExpiredKeys(store, i))
+	}
 	if err != nil {
 		return out, err
 	}
-	if serv.Role == Master && cmd.IsPropagatable && serv.ConnectedReplica != nil {
-		request.Serv.Offset += len(encodeCommand(cmd))
-		for _, replica := range *serv.ConnectedReplica {
-			replica.Buffer.Write(encodeCommand(cmd))
-			queueReplica(replica)
+	if serv.Role == Master && hasReplicas(serv) {
+		if cmd.IsPropagatable {
+			propagate(serv, request.Client.DbIndex, cmd)
 		}
+		for i := range request.AlsoPropagate {
+			propagate(serv, request.AlsoPropagate[i].Db, &request.AlsoPropagate[i])
+		}
+	}
+	for _, bk := range request.readyStreams {
+		blockedReaders.signal(bk.store, bk.key)
 	}
 	return out, nil
 }
+
+// propagate sends cmd to the replicas, preceded by a SELECT when it applies to
+// another database than the previous command. The replicas not pending yet are handed to
+// the flusher once replicationMu is released, since the flusher takes it too.
+func propagate(serv *Server, db int, cmd *Command) {
+	replicationMu.Lock()
+	var encoded []byte
+	if db != serv.replicationDb {
+		serv.replicationDb = db
+		encoded = encodeCommand(&Command{Name: "SELECT", Args: []string{strconv.Itoa(db)}})
+	}
+	encoded = append(encoded, encodeCommand(cmd)...)
+	serv.Offset += len(encoded)
+	var queued []*Replica
+	for _, replica := range *serv.ConnectedReplica {
+		replica.Buffer.Write(encoded)
+		if !replica.Pending {
+			replica.Pending = true
+			queued = append(queued, replica)
+		}
+	}
+	replicationMu.Unlock()
+	for _, replica := range queued {
+		replicasPendingWrite <- replica
+	}
+}
+
+// alsoPropagate queues a command to be sent to replicas after the current one
+func (request *Request) alsoPropagate(name string, args ...string) {
+	request.alsoPropagateTo(request.Client.DbIndex, name, args...)
+}
+
+// alsoPropagateTo queues a command applying to database db
+func (request *Request) alsoPropagateTo(db int, name string, args ...string) {
+	request.AlsoPropagate = append(request.AlsoPropagate, Command{
+		Name: name,
+		Args: args,
+		Db:   db,
+	})
+}
 func WriteCommand(writer *bufio.Writer, cmd *Command) error {
 	result := encodeCommand(cmd)
 	_, err := writer.Write(result)
@@ -206,7 +859,7 @@ func encodeCommand(cmd *Command) []byte {
 func CreateCommand(name string, args []string) (Command, error) {
 	cmdName := strings.ToUpper(name)
 	if lookUpCommands[cmdName] == nil {
-		return Command{}, errors.New("Invalid Command")
+		return Command{Name: cmdName, Args: args}, ErrInvalidCommand
 	}
 	return Command{
 		Name:           cmdName,
@@ -215,5 +868,13 @@ func CreateCommand(name string, args []string) (Command, error) {
 		SuppressReply:  suppressReplyCommand[cmdName],
 		IsWritable:     writeCommand[cmdName],
 		Handle:         lookUpCommands[cmdName],
+		Arity:          arityCommand[cmdName],
 	}, nil
 }
+
+func wrongArgsError(cmd *Command) ([]byte, error) {
+	return resp.ErrorDecoder("ERR wrong number of arguments for '" + strings.ToLower(cmd.Name) + "' command"), ErrInvalidFormat
+}
+func wrongTypeError() ([]byte, error) {
+	return resp.ErrorDecoder(WrongTypeErr), ErrWrongType
+}
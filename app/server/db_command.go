@@ -0,0 +1,175 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/engine"
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// database commands
+// Every connection works in the database it selected, 0 by default. Commands holding two
+// databases lock them in index order so that they cannot deadlock each other.
+
+// parseDbIndex parses the index of an existing database
+func parseDbIndex(serv *Server, arg string) (int, []byte) {
+	index, ok := engine.ParseInt64(arg)
+	if !ok {
+		return 0, resp.ErrorDecoder(NotIntegerErr)
+	}
+	if index < 0 || index >= int64(len(serv.databases())) {
+		return 0, resp.ErrorDecoder("ERR DB index is out of range")
+	}
+	return int(index), nil
+}
+
+// lockDatabases locks the databases i and j, which may be the same, and returns the function unlocking them
+func lockDatabases(serv *Server, i int, j int) func() {
+	dbs := serv.databases()
+	if i == j {
+		dbs[i].Mu.Lock()
+		return dbs[i].Mu.Unlock
+	}
+	first, second := dbs[min(i, j)], dbs[max(i, j)]
+	first.Mu.Lock()
+	second.Mu.Lock()
+	return func() {
+		second.Mu.Unlock()
+		first.Mu.Unlock()
+	}
+}
+
+// SELECT index
+func selectIndex(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 1 {
+		return wrongArgsError(request.Cmd)
+	}
+	index, errOut := parseDbIndex(request.Serv, args[0])
+	if errOut != nil {
+		return errOut, ErrInvalidFormat
+	}
+	request.Client.DbIndex = index
+	return resp.SimpleStringDecoder("OK"), nil
+}
+
+// MOVE key db moves key with its TTL unless db already holds it
+func moveCommand(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	key := args[0]
+	src := request.Client.DbIndex
+	dst, errOut := parseDbIndex(request.Serv, args[1])
+	if errOut != nil {
+		return errOut, ErrInvalidFormat
+	}
+	if src == dst {
+		return resp.ErrorDecoder("ERR source and destination objects are the same"), ErrInvalidFormat
+	}
+	unlock := lockDatabases(request.Serv, src, dst)
+	defer unlock()
+	srcStore, dstStore := request.Serv.databases()[src], request.Serv.databases()[dst]
+	obj := srcStore.Lookup(key)
+	if obj == nil || dstStore.Lookup(key) != nil {
+		return resp.IntegerDecoder(0), nil
+	}
+	deleteKey(request, srcStore, key)
+	(*dstStore.Dict)[key] = obj
+	dstStore.Touch(key)
+	notifyKeyspaceEvent(notifyGeneric, "move_from", key, src)
+	notifyKeyspaceEvent(notifyGeneric, "move_to", key, dst)
+	signalKeyAsReady(request, dstStore, key)
+	return resp.IntegerDecoder(1), nil
+}
+
+// SWAPDB index1 index2 swaps the keyspaces of two databases,
+// clients keep their selected index and see the other keyspace
+func swapdb(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	i, errOut := parseDbIndex(request.Serv, args[0])
+	if errOut != nil {
+		return errOut, ErrInvalidFormat
+	}
+	j, errOut := parseDbIndex(request.Serv, args[1])
+	if errOut != nil {
+		return errOut, ErrInvalidFormat
+	}
+	if i == j {
+		return resp.SimpleStringDecoder("OK"), nil
+	}
+	unlock := lockDatabases(request.Serv, i, j)
+	defer unlock()
+	a, b := request.Serv.databases()[i], request.Serv.databases()[j]
+	a.TouchExisting(b)
+	b.TouchExisting(a)
+	a.Dict, b.Dict = b.Dict, a.Dict
+	serveSwappedDatabase(request, a)
+	serveSwappedDatabase(request, b)
+	return resp.SimpleStringDecoder("OK"), nil
+}
+
+// serveSwappedDatabase serves the clients blocked on keys that store may hold now.
+// The caller must hold the store lock.
+func serveSwappedDatabase(request *Request, store *engine.DbStore) {
+	for _, key := range blockedClients.keys(store) {
+		serveBlockedClients(request, store, key)
+	}
+	for _, key := range blockedReaders.keys(store) {
+		request.signalStreamReady(store, key)
+	}
+}
+
+// parseFlushMode accepts the ASYNC and SYNC options of FLUSHDB and FLUSHALL,
+// the keyspace is always dropped at once and reclaimed by the garbage collector
+func parseFlushMode(args []string) []byte {
+	if len(args) > 1 {
+		return resp.ErrorDecoder("ERR syntax error")
+	}
+	if len(args) == 1 && !strings.EqualFold(args[0], "ASYNC") && !strings.EqualFold(args[0], "SYNC") {
+		return resp.ErrorDecoder("ERR syntax error")
+	}
+	return nil
+}
+
+// flushDatabase empties store, readers blocked on its streams are woken to see them gone.
+// The caller must hold the store lock.
+func flushDatabase(request *Request, store *engine.DbStore) {
+	store.TouchExisting(nil)
+	*store.Dict = make(map[string]engine.RedisObj)
+	for _, key := range blockedReaders.keys(store) {
+		request.signalStreamReady(store, key)
+	}
+}
+
+// FLUSHDB [ASYNC | SYNC]
+func flushdb(request *Request) ([]byte, error) {
+	if errOut := parseFlushMode(request.Cmd.Args); errOut != nil {
+		return errOut, ErrInvalidFormat
+	}
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	flushDatabase(request, store)
+	return resp.SimpleStringDecoder("OK"), nil
+}
+
+// FLUSHALL [ASYNC | SYNC] empties every database at once
+func flushall(request *Request) ([]byte, error) {
+	if errOut := parseFlushMode(request.Cmd.Args); errOut != nil {
+		return errOut, ErrInvalidFormat
+	}
+	stores := request.Serv.databases()
+	for _, store := range stores {
+		store.Mu.Lock()
+		defer store.Mu.Unlock()
+	}
+	for _, store := range stores {
+		flushDatabase(request, store)
+	}
+	return resp.SimpleStringDecoder("OK"), nil
+}
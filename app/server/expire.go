@@ -0,0 +1,106 @@
+package server
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/engine"
+)
+
+// Active expiration.
+// Expired keys are hidden by lookups but stay in the keyspace until this cycle, or the
+// command that found them, deletes them. Only the master deletes expired keys, each one
+// is propagated as DEL so that replicas never depend on their own clock.
+// Like redis, every cycle samples keys with a TTL and keeps sampling while a large part of
+// the sample was expired, within a time budget, releasing the store lock between samples.
+
+const (
+	activeExpireInterval = 100 * time.Millisecond
+	// a cycle may use up to a quarter of the interval
+	activeExpireBudget = 25 * time.Millisecond
+	// keys with a TTL checked per sample, and keys visited at most to find them
+	activeExpireKeysPerLoop = 20
+	activeExpireScanLimit   = 20 * activeExpireKeysPerLoop
+	// another sample is taken while more than this percentage of the last one was expired
+	activeExpireAcceptableStale = 10
+)
+
+// expiredKeys counts the keys deleted by the active expire cycle, reported by INFO
+var expiredKeys atomic.Int64
+
+// StartActiveExpire runs the active expire cycle of serv in the background
+func StartActiveExpire(serv *Server) {
+	go func() {
+		ticker := time.NewTicker(activeExpireInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			ActiveExpireCycle(serv)
+		}
+	}()
+}
+
+// ActiveExpireCycle deletes expired keys of every database until a sample is mostly live or
+// the time budget is spent, it returns how many keys were deleted. Replicas leave expiration
+// to their master.
+func ActiveExpireCycle(serv *Server) int {
+	start := time.Now()
+	total := 0
+	for db, store := range serv.databases() {
+		for time.Since(start) <= activeExpireBudget {
+			// a sample does not run in the middle of a transaction
+			execGate.RLock()
+			store.Mu.Lock()
+			if store.Replica {
+				store.Mu.Unlock()
+				execGate.RUnlock()
+				break
+			}
+			sampled, expired := store.ExpireSample(activeExpireKeysPerLoop, activeExpireScanLimit)
+			store.Mu.Unlock()
+			for _, key := range expired {
+				notifyKeyspaceEvent(notifyExpired, "expired", key, db)
+			}
+			propagateExpired(serv, db, expired)
+			execGate.RUnlock()
+			total += len(expired)
+			if sampled == 0 || len(expired)*100 <= sampled*activeExpireAcceptableStale {
+				break
+			}
+		}
+	}
+	expiredKeys.Add(int64(total))
+	return total
+}
+
+// deleteExpiredKeys deletes the expired keys of database db found by the lookups of the last
+// commands and returns the removed ones to be propagated as DEL: those it deleted and those
+// the commands modified, which replaced their expired value. A key another command deleted
+// in the meantime is not returned, that command is propagated instead.
+func deleteExpiredKeys(store *engine.DbStore, db int) []string {
+	expired, removed := store.TakeExpired()
+	if len(expired) == 0 && len(removed) == 0 {
+		return nil
+	}
+	store.Mu.Lock()
+	for _, key := range expired {
+		if store.DeleteIfExpired(key) {
+			removed = append(removed, key)
+		}
+	}
+	store.Mu.Unlock()
+	for _, key := range removed {
+		notifyKeyspaceEvent(notifyExpired, "expired", key, db)
+	}
+	expiredKeys.Add(int64(len(removed)))
+	return removed
+}
+
+// propagateExpired sends a DEL of each expired key of database db to the replicas
+func propagateExpired(serv *Server, db int, keys []string) {
+	if serv.Role != Master || !hasReplicas(serv) {
+		return
+	}
+	for _, key := range keys {
+		propagate(serv, db, &Command{Name: "DEL", Args: []string{key}})
+	}
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/engine"
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// key expiration commands
+// Every change of TTL is propagated as PEXPIREAT with the absolute deadline, or as DEL
+// when the deadline is already past, so replicas do not depend on their own clock.
+
+func expire(request *Request) ([]byte, error) {
+	return expireGeneric(request, time.Second, false)
+}
+func pexpire(request *Request) ([]byte, error) {
+	return expireGeneric(request, time.Millisecond, false)
+}
+func expireat(request *Request) ([]byte, error) {
+	return expireGeneric(request, time.Second, true)
+}
+func pexpireat(request *Request) ([]byte, error) {
+	return expireGeneric(request, time.Millisecond, true)
+}
+
+// expireGeneric implements EXPIRE, PEXPIRE, EXPIREAT and PEXPIREAT key time [NX | XX | GT | LT],
+// time being relative to now unless absolute is set. A key without TTL has an infinite TTL for GT and LT.
+func expireGeneric(request *Request, unit time.Duration, absolute bool) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	var nx, xx, gt, lt bool
+	for _, arg := range args[2:] {
+		switch strings.ToUpper(arg) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GT":
+			gt = true
+		case "LT":
+			lt = true
+		default:
+			return resp.ErrorDecoder("ERR Unsupported option " + arg), ErrInvalidFormat
+		}
+	}
+	if nx && (xx || gt || lt) {
+		return resp.ErrorDecoder("ERR NX and XX, GT or LT options at the same time are not compatible"), ErrInvalidFormat
+	}
+	if gt && lt {
+		return resp.ErrorDecoder("ERR GT and LT options at the same time are not compatible"), ErrInvalidFormat
+	}
+	n, ok := engine.ParseInt64(args[1])
+	if !ok {
+		return resp.ErrorDecoder(NotIntegerErr), ErrInvalidFormat
+	}
+	ms, ok := deadlineMillis(n, unit, absolute)
+	if !ok {
+		return resp.ErrorDecoder("ERR invalid expire time in '" + strings.ToLower(request.Cmd.Name) + "' command"), ErrInvalidFormat
+	}
+
+	key := args[0]
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	obj := store.Lookup(key)
+	if obj == nil {
+		return resp.IntegerDecoder(0), nil
+	}
+	current := int64(math.MaxInt64)
+	if obj.HasExpiration() {
+		current = obj.GetExpiration().UnixMilli()
+	}
+	if (nx && obj.HasExpiration()) || (xx && !obj.HasExpiration()) || (gt && ms <= current) || (lt && ms >= current) {
+		return resp.IntegerDecoder(0), nil
+	}
+	deadline := time.UnixMilli(ms)
+	if !deadline.After(time.Now()) {
+		deleteKey(request, store, key)
+		request.notify(notifyGeneric, "del", key)
+		request.alsoPropagate("DEL", key)
+		return resp.IntegerDecoder(1), nil
+	}
+	(*store.Dict)[key] = engine.WithExpiration(obj, deadline)
+	store.Touch(key)
+	request.notify(notifyGeneric, "expire", key)
+	request.alsoPropagate("PEXPIREAT", key, strconv.FormatInt(ms, 10))
+	return resp.IntegerDecoder(1), nil
+}
+
+// deadlineMillis converts n units, from now unless absolute is set, to a unix time in milliseconds.
+// ok is false when the result does not fit in an int64.
+func deadlineMillis(n int64, unit time.Duration, absolute bool) (int64, bool) {
+	factor := int64(unit / time.Millisecond)
+	if n > math.MaxInt64/factor || n < math.MinInt64/factor {
+		return 0, false
+	}
+	ms := n * factor
+	if absolute {
+		return ms, true
+	}
+	now := time.Now().UnixMilli()
+	if ms > math.MaxInt64-now {
+		return 0, false
+	}
+	return now + ms, true
+}
+
+func ttl(request *Request) ([]byte, error) {
+	return ttlGeneric(request, time.Second, false)
+}
+func pttl(request *Request) ([]byte, error) {
+	return ttlGeneric(request, time.Millisecond, false)
+}
+func expiretime(request *Request) ([]byte, error) {
+	return ttlGeneric(request, time.Second, true)
+}
+func pexpiretime(request *Request) ([]byte, error) {
+	return ttlGeneric(request, time.Millisecond, true)
+}
+
+// ttlGeneric implements TTL, PTTL, EXPIRETIME and PEXPIRETIME key:
+// -2 when the key does not exist, -1 when it has no TTL
+func ttlGeneric(request *Request, unit time.Duration, absolute bool) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 1 {
+		return wrongArgsError(request.Cmd)
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	obj := store.Lookup(args[0])
+	if obj == nil {
+		request.keyMiss(args[0])
+		return resp.IntegerDecoder(-2), nil
+	}
+	if !obj.HasExpiration() {
+		return resp.IntegerDecoder(-1), nil
+	}
+	if absolute {
+		return resp.IntegerDecoder(int(obj.GetExpiration().UnixMilli() / int64(unit/time.Millisecond))), nil
+	}
+	remaining := max(time.Until(obj.GetExpiration()), 0)
+	// TTL rounds to the closest second like redis
+	return resp.IntegerDecoder(int((remaining + unit/2) / unit)), nil
+}
+
+// PERSIST key
+func persist(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 1 {
+		return wrongArgsError(request.Cmd)
+	}
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	obj := store.Lookup(args[0])
+	if obj == nil || !obj.HasExpiration() {
+		return resp.IntegerDecoder(0), nil
+	}
+	(*store.Dict)[args[0]] = engine.WithExpiration(obj, time.Time{})
+	store.Touch(args[0])
+	request.notify(notifyGeneric, "persist", args[0])
+	return resp.IntegerDecoder(1), nil
+}
@@ -0,0 +1,430 @@
+package server
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/engine"
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// hash commands
+
+// lookupHash returns the hash stored at key, ok is false when the key does not exist
+func lookupHash(store *engine.DbStore, key string) (engine.RedisHash, bool, error) {
+	obj := store.Lookup(key)
+	if obj == nil {
+		return engine.RedisHash{}, false, nil
+	}
+	hash, isHash := obj.(engine.RedisHash)
+	if !isHash {
+		return engine.RedisHash{}, false, ErrWrongType
+	}
+	return hash, true, nil
+}
+
+// lookupOrCreateHash returns the hash stored at key, creating an empty one in the keyspace if needed
+func lookupOrCreateHash(store *engine.DbStore, key string) (engine.RedisHash, error) {
+	hash, ok, err := lookupHash(store, key)
+	if err != nil {
+		return hash, err
+	}
+	if !ok {
+		hash = engine.NewRedisHash(make(map[string]string))
+		(*store.Dict)[key] = hash
+	}
+	return hash, nil
+}
+
+// HSET key field value [field value ...]
+func hset(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 3 || len(args)%2 == 0 {
+		return wrongArgsError(request.Cmd)
+	}
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	hash, err := lookupOrCreateHash(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	added := 0
+	for i := 1; i < len(args); i += 2 {
+		if hash.Set(args[i], args[i+1]) {
+			added++
+		}
+	}
+	store.Touch(args[0])
+	request.notify(notifyHash, "hset", args[0])
+	return resp.IntegerDecoder(added), nil
+}
+
+// HMSET is the deprecated form of HSET replying OK
+func hmset(request *Request) ([]byte, error) {
+	out, err := hset(request)
+	if err != nil {
+		return out, err
+	}
+	return resp.SimpleStringDecoder("OK"), nil
+}
+
+func hsetnx(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 3 {
+		return wrongArgsError(request.Cmd)
+	}
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	hash, err := lookupOrCreateHash(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	if _, ok := hash.Data[args[1]]; ok {
+		return resp.IntegerDecoder(0), nil
+	}
+	hash.Set(args[1], args[2])
+	store.Touch(args[0])
+	request.notify(notifyHash, "hset", args[0])
+	return resp.IntegerDecoder(1), nil
+}
+
+func hget(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	hash, found, err := lookupHash(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !found {
+		request.keyMiss(args[0])
+	}
+	value, ok := hash.Data[args[1]]
+	if !ok {
+		return []byte(resp.Nil), nil
+	}
+	return resp.BulkStringDecoder(value), nil
+}
+
+func hmget(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	hash, found, err := lookupHash(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !found {
+		request.keyMiss(args[0])
+	}
+	values := make([][]byte, 0, len(args)-1)
+	for _, field := range args[1:] {
+		value, ok := hash.Data[field]
+		if !ok {
+			values = append(values, []byte(resp.Nil))
+			continue
+		}
+		values = append(values, resp.BulkStringDecoder(value))
+	}
+	return resp.RawArrayDecoder(values), nil
+}
+
+func hdel(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	key := args[0]
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	hash, ok, err := lookupHash(store, key)
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok {
+		return resp.IntegerDecoder(0), nil
+	}
+	removed := 0
+	for _, field := range args[1:] {
+		if hash.Delete(field) {
+			removed++
+		}
+	}
+	if removed > 0 {
+		store.Touch(key)
+		request.notify(notifyHash, "hdel", key)
+	}
+	if len(hash.Data) == 0 {
+		delete(*store.Dict, key)
+		request.notify(notifyGeneric, "del", key)
+	}
+	return resp.IntegerDecoder(removed), nil
+}
+
+func hgetall(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 1 {
+		return wrongArgsError(request.Cmd)
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	hash, found, err := lookupHash(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !found {
+		request.keyMiss(args[0])
+	}
+	out := make([]string, 0, 2*len(hash.Data))
+	for field, value := range hash.Data {
+		out = append(out, field, value)
+	}
+	return request.Client.mapReply(out), nil
+}
+
+func hkeys(request *Request) ([]byte, error) {
+	return hashFields(request, true)
+}
+func hvals(request *Request) ([]byte, error) {
+	return hashFields(request, false)
+}
+
+// hashFields implements HKEYS and HVALS
+func hashFields(request *Request, fields bool) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 1 {
+		return wrongArgsError(request.Cmd)
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	hash, found, err := lookupHash(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !found {
+		request.keyMiss(args[0])
+	}
+	out := make([]string, 0, len(hash.Data))
+	for field, value := range hash.Data {
+		if fields {
+			out = append(out, field)
+		} else {
+			out = append(out, value)
+		}
+	}
+	return resp.ArrayDecoder(out), nil
+}
+
+func hlen(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 1 {
+		return wrongArgsError(request.Cmd)
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	hash, found, err := lookupHash(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !found {
+		request.keyMiss(args[0])
+	}
+	return resp.IntegerDecoder(len(hash.Data)), nil
+}
+
+func hexists(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	hash, found, err := lookupHash(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !found {
+		request.keyMiss(args[0])
+	}
+	if _, ok := hash.Data[args[1]]; ok {
+		return resp.IntegerDecoder(1), nil
+	}
+	return resp.IntegerDecoder(0), nil
+}
+
+func hstrlen(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	hash, found, err := lookupHash(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !found {
+		request.keyMiss(args[0])
+	}
+	return resp.IntegerDecoder(len(hash.Data[args[1]])), nil
+}
+
+func hincrby(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 3 {
+		return wrongArgsError(request.Cmd)
+	}
+	incr, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return resp.ErrorDecoder(NotIntegerErr), ErrInvalidFormat
+	}
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	hash, err := lookupOrCreateHash(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	var current int64
+	if value, ok := hash.Data[args[1]]; ok {
+		current, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return resp.ErrorDecoder("ERR hash value is not an integer"), ErrInvalidFormat
+		}
+	}
+	if (incr > 0 && current > math.MaxInt64-incr) || (incr < 0 && current < math.MinInt64-incr) {
+		return resp.ErrorDecoder("ERR increment or decrement would overflow"), ErrInvalidFormat
+	}
+	current += incr
+	hash.Set(args[1], strconv.FormatInt(current, 10))
+	store.Touch(args[0])
+	request.notify(notifyHash, "hincrby", args[0])
+	return resp.IntegerDecoder(int(current)), nil
+}
+
+// HINCRBYFLOAT is propagated as HSET with the result so replicas don't redo float math
+func hincrbyfloat(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 3 {
+		return wrongArgsError(request.Cmd)
+	}
+	incr, err := strconv.ParseFloat(args[2], 64)
+	if err != nil || math.IsNaN(incr) || math.IsInf(incr, 0) {
+		return resp.ErrorDecoder("ERR value is not a valid float"), ErrInvalidFormat
+	}
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	hash, ok, err := lookupHash(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	var current float64
+	if value, exists := hash.Data[args[1]]; exists {
+		current, err = strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(current) || math.IsInf(current, 0) {
+			return resp.ErrorDecoder("ERR hash value is not a float"), ErrInvalidFormat
+		}
+	}
+	current += incr
+	if math.IsNaN(current) || math.IsInf(current, 0) {
+		return resp.ErrorDecoder("ERR increment would produce NaN or Infinity"), ErrInvalidFormat
+	}
+	if !ok {
+		hash, _ = lookupOrCreateHash(store, args[0])
+	}
+	value := strconv.FormatFloat(current, 'f', -1, 64)
+	hash.Set(args[1], value)
+	store.Touch(args[0])
+	request.notify(notifyHash, "hincrbyfloat", args[0])
+	request.alsoPropagate("HSET", args[0], args[1], value)
+	return resp.BulkStringDecoder(value), nil
+}
+
+// HRANDFIELD key [count [WITHVALUES]]
+func hrandfield(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 1 || len(args) > 3 {
+		return wrongArgsError(request.Cmd)
+	}
+	count := 1
+	withCount := len(args) >= 2
+	withValues := false
+	if withCount {
+		n, err := strconv.Atoi(args[1])
+		if err != nil {
+			return resp.ErrorDecoder(NotIntegerErr), ErrInvalidFormat
+		}
+		count = n
+	}
+	if len(args) == 3 {
+		if strings.ToUpper(args[2]) != "WITHVALUES" {
+			return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
+		}
+		withValues = true
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	hash, ok, err := lookupHash(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok {
+		request.keyMiss(args[0])
+		if withCount {
+			return resp.ArrayDecoder(nil), nil
+		}
+		return []byte(resp.Nil), nil
+	}
+	fields := make([]string, 0, len(hash.Data))
+	for field := range hash.Data {
+		fields = append(fields, field)
+	}
+	var picked []string
+	if count >= 0 {
+		// distinct fields
+		rand.Shuffle(len(fields), func(i, j int) { fields[i], fields[j] = fields[j], fields[i] })
+		if count > len(fields) {
+			count = len(fields)
+		}
+		picked = fields[:count]
+	} else {
+		// negative count allows repetitions
+		for i := 0; i < -count; i++ {
+			picked = append(picked, fields[rand.Intn(len(fields))])
+		}
+	}
+	if !withCount {
+		return resp.BulkStringDecoder(picked[0]), nil
+	}
+	out := make([]string, 0, 2*len(picked))
+	for _, field := range picked {
+		out = append(out, field)
+		if withValues {
+			out = append(out, hash.Data[field])
+		}
+	}
+	if withValues {
+		return request.Client.mapReply(out), nil
+	}
+	return resp.ArrayDecoder(out), nil
+}
@@ -0,0 +1,259 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/engine"
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// generic keyspace commands
+
+// deleteKey removes key from the keyspace, it returns false if the key did not exist.
+// Readers blocked on a deleted stream are woken so that XREADGROUP reports the missing group.
+// The caller must hold the store lock.
+func deleteKey(request *Request, store *engine.DbStore, key string) bool {
+	obj := store.Lookup(key)
+	delete(*store.Dict, key)
+	if obj == nil {
+		return false
+	}
+	store.Touch(key)
+	if _, ok := obj.(engine.RedisStream); ok {
+		request.signalStreamReady(store, key)
+	}
+	return true
+}
+
+// signalKeyAsReady serves the clients blocked on a key that was just written by a generic command.
+// The caller must hold the store lock.
+func signalKeyAsReady(request *Request, store *engine.DbStore, key string) {
+	switch store.Lookup(key).(type) {
+	case engine.RedisList:
+		serveBlockedClients(request, store, key)
+	case engine.RedisStream:
+		request.signalStreamReady(store, key)
+	}
+}
+
+// DEL key [key ...]
+func del(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 1 {
+		return wrongArgsError(request.Cmd)
+	}
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	deleted := 0
+	for _, key := range args {
+		if deleteKey(request, store, key) {
+			request.notify(notifyGeneric, "del", key)
+			deleted++
+		}
+	}
+	return resp.IntegerDecoder(deleted), nil
+}
+
+// UNLINK key [key ...] is DEL, values are reclaimed by the garbage collector anyway
+func unlink(request *Request) ([]byte, error) {
+	return del(request)
+}
+
+// EXISTS key [key ...], a key given several times is counted several times
+func exists(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 1 {
+		return wrongArgsError(request.Cmd)
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	count := 0
+	for _, key := range args {
+		if store.Lookup(key) != nil {
+			count++
+		} else {
+			request.keyMiss(key)
+		}
+	}
+	return resp.IntegerDecoder(count), nil
+}
+
+// TOUCH key [key ...]
+func touch(request *Request) ([]byte, error) {
+	return exists(request)
+}
+
+// TYPE key
+func typeCommand(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 1 {
+		return wrongArgsError(request.Cmd)
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	obj := store.Lookup(args[0])
+	if obj == nil {
+		request.keyMiss(args[0])
+		return resp.SimpleStringDecoder("none"), nil
+	}
+	return resp.SimpleStringDecoder(strings.ToLower(obj.Type())), nil
+}
+
+// RENAME key newkey
+func rename(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	if _, errOut := renameKey(request, args[0], args[1], false); errOut != nil {
+		return errOut, ErrInvalidFormat
+	}
+	return resp.SimpleStringDecoder("OK"), nil
+}
+
+// RENAMENX key newkey
+func renamenx(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	renamed, errOut := renameKey(request, args[0], args[1], true)
+	if errOut != nil {
+		return errOut, ErrInvalidFormat
+	}
+	if renamed {
+		return resp.IntegerDecoder(1), nil
+	}
+	return resp.IntegerDecoder(0), nil
+}
+
+// renameKey moves the value of src and its TTL to dst, unless nx is set and dst exists
+func renameKey(request *Request, src string, dst string, nx bool) (bool, []byte) {
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	obj := store.Lookup(src)
+	if obj == nil {
+		return false, resp.ErrorDecoder("ERR no such key")
+	}
+	if src == dst {
+		return !nx, nil
+	}
+	if store.Lookup(dst) != nil {
+		if nx {
+			return false, nil
+		}
+		deleteKey(request, store, dst)
+	}
+	deleteKey(request, store, src)
+	(*store.Dict)[dst] = obj
+	store.Touch(dst)
+	request.notify(notifyGeneric, "rename_from", src)
+	request.notify(notifyGeneric, "rename_to", dst)
+	signalKeyAsReady(request, store, dst)
+	return true, nil
+}
+
+// COPY source destination [DB destination-db] [REPLACE]
+func copyCommand(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	src, dst := args[0], args[1]
+	srcDb := request.Client.DbIndex
+	dstDb := srcDb
+	replace := false
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "REPLACE":
+			replace = true
+		case "DB":
+			if i+1 >= len(args) {
+				return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
+			}
+			db, errOut := parseDbIndex(request.Serv, args[i+1])
+			if errOut != nil {
+				return errOut, ErrInvalidFormat
+			}
+			dstDb = db
+			i++
+		default:
+			return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
+		}
+	}
+	if src == dst && srcDb == dstDb {
+		return resp.ErrorDecoder("ERR source and destination objects are the same"), ErrInvalidFormat
+	}
+	unlock := lockDatabases(request.Serv, srcDb, dstDb)
+	defer unlock()
+	srcStore, dstStore := request.Serv.databases()[srcDb], request.Serv.databases()[dstDb]
+	obj := srcStore.Lookup(src)
+	if obj == nil {
+		return resp.IntegerDecoder(0), nil
+	}
+	if dstStore.Lookup(dst) != nil {
+		if !replace {
+			return resp.IntegerDecoder(0), nil
+		}
+		deleteKey(request, dstStore, dst)
+	}
+	(*dstStore.Dict)[dst] = engine.CopyObject(obj)
+	dstStore.Touch(dst)
+	notifyKeyspaceEvent(notifyGeneric, "copy_to", dst, dstDb)
+	signalKeyAsReady(request, dstStore, dst)
+	return resp.IntegerDecoder(1), nil
+}
+
+// randomKeyTries is how many keys RANDOMKEY samples before walking the keyspace for a live
+// one, when they were all expired
+const randomKeyTries = 100
+
+// RANDOMKEY samples random keys of the index until one has not expired, like redis
+func randomkey(request *Request) ([]byte, error) {
+	if len(request.Cmd.Args) != 0 {
+		return wrongArgsError(request.Cmd)
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	keys := store.Keys()
+	for i := 0; i < randomKeyTries; i++ {
+		key, ok := keys.Random()
+		if !ok {
+			return []byte(resp.Nil), nil
+		}
+		if store.Lookup(key) != nil {
+			return resp.BulkStringDecoder(key), nil
+		}
+	}
+	var live string
+	for cursor := uint64(0); ; {
+		cursor = keys.Scan(cursor, randomKeyTries, func(key string) {
+			if live == "" && store.Lookup(key) != nil {
+				live = key
+			}
+		})
+		if live != "" || cursor == 0 {
+			break
+		}
+	}
+	if live == "" {
+		return []byte(resp.Nil), nil
+	}
+	return resp.BulkStringDecoder(live), nil
+}
+
+// DBSIZE counts the keys of the keyspace, including expired keys not reclaimed yet
+func dbsize(request *Request) ([]byte, error) {
+	if len(request.Cmd.Args) != 0 {
+		return wrongArgsError(request.Cmd)
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	return resp.IntegerDecoder(len(*store.Dict)), nil
+}
@@ -0,0 +1,760 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/engine"
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// list commands
+
+// lookupList returns the list stored at key, ok is false when the key does not exist
+func lookupList(store *engine.DbStore, key string) (engine.RedisList, bool, error) {
+	obj := store.Lookup(key)
+	if obj == nil {
+		return engine.RedisList{}, false, nil
+	}
+	list, isList := obj.(engine.RedisList)
+	if !isList {
+		return engine.RedisList{}, false, ErrWrongType
+	}
+	return list, true, nil
+}
+
+// storeList writes the list back after event, empty lists are removed from the keyspace
+func storeList(request *Request, store *engine.DbStore, key string, list engine.RedisList, event string) {
+	store.Touch(key)
+	request.notify(notifyList, event, key)
+	if len(list.Data) == 0 {
+		delete(*store.Dict, key)
+		request.notify(notifyGeneric, "del", key)
+		return
+	}
+	(*store.Dict)[key] = list
+}
+
+// normalizeIndex converts a negative index to an offset from the head
+func normalizeIndex(index int, length int) int {
+	if index < 0 {
+		index += length
+	}
+	return index
+}
+
+// normalizeRange clamps [start, stop] to the list bounds the way LRANGE and LTRIM do,
+// ok is false when the range is empty
+func normalizeRange(start int, stop int, length int) (int, int, bool) {
+	start = normalizeIndex(start, length)
+	stop = normalizeIndex(stop, length)
+	if start < 0 {
+		start = 0
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+	if start >= length || start > stop {
+		return 0, 0, false
+	}
+	return start, stop, true
+}
+
+// popElement removes an element from the head or tail of a non-empty list
+func popElement(list *engine.RedisList, head bool) string {
+	var value string
+	if head {
+		value = list.Data[0]
+		list.Data = list.Data[1:]
+	} else {
+		value = list.Data[len(list.Data)-1]
+		list.Data = list.Data[:len(list.Data)-1]
+	}
+	return value
+}
+
+// moveElement pops an element from src and pushes it to dst, ok is false when src does not exist
+func moveElement(request *Request, store *engine.DbStore, src string, dst string, fromHead bool, toHead bool) (string, bool, error) {
+	srcList, ok, err := lookupList(store, src)
+	if err != nil || !ok {
+		return "", false, err
+	}
+	if _, _, err = lookupList(store, dst); err != nil {
+		return "", false, err
+	}
+	value := popElement(&srcList, fromHead)
+	storeList(request, store, src, srcList, popEvent(fromHead))
+
+	// reload in case src and dst are the same list
+	dstList, _, _ := lookupList(store, dst)
+	if toHead {
+		dstList.Data = append([]string{value}, dstList.Data...)
+	} else {
+		dstList.Data = append(dstList.Data, value)
+	}
+	storeList(request, store, dst, dstList, pushEvent(toHead))
+	return value, true, nil
+}
+
+func popCommandName(head bool) string {
+	if head {
+		return "LPOP"
+	}
+	return "RPOP"
+}
+
+func popEvent(head bool) string {
+	if head {
+		return "lpop"
+	}
+	return "rpop"
+}
+
+func pushEvent(head bool) string {
+	if head {
+		return "lpush"
+	}
+	return "rpush"
+}
+
+func directionName(head bool) string {
+	if head {
+		return "LEFT"
+	}
+	return "RIGHT"
+}
+
+// parseDirection parses the LEFT | RIGHT argument of LMOVE and BLMOVE
+func parseDirection(arg string) (bool, error) {
+	switch strings.ToUpper(arg) {
+	case "LEFT":
+		return true, nil
+	case "RIGHT":
+		return false, nil
+	}
+	return false, ErrInvalidFormat
+}
+
+// serveBlockedClients hands the elements of a list that just received new elements to the clients
+// blocked on it, oldest first. The caller must hold the store lock.
+// The pops are propagated to replicas after the command that made the list ready.
+func serveBlockedClients(request *Request, store *engine.DbStore, key string) {
+	db := request.Serv.dbIndex(store)
+	ready := []string{key}
+	for len(ready) > 0 {
+		key := ready[0]
+		ready = ready[1:]
+		for {
+			list, ok, err := lookupList(store, key)
+			if err != nil || !ok {
+				break
+			}
+			waiter := blockedClients.next(store, key)
+			if waiter == nil {
+				break
+			}
+			if !waiter.move {
+				value := popElement(&list, waiter.head)
+				storeList(request, store, key, list, popEvent(waiter.head))
+				request.alsoPropagateTo(db, popCommandName(waiter.head), key)
+				waiter.result <- listResult{key: key, value: value}
+				continue
+			}
+			value, _, err := moveElement(request, store, key, waiter.dest, waiter.head, waiter.toHead)
+			if err != nil {
+				waiter.result <- listResult{err: resp.ErrorDecoder(WrongTypeErr)}
+				continue
+			}
+			request.alsoPropagateTo(db, "LMOVE", key, waiter.dest, directionName(waiter.head), directionName(waiter.toHead))
+			waiter.result <- listResult{key: key, value: value}
+			ready = append(ready, waiter.dest)
+		}
+	}
+}
+
+func lpush(request *Request) ([]byte, error) {
+	return push(request, true, false)
+}
+func rpush(request *Request) ([]byte, error) {
+	return push(request, false, false)
+}
+func lpushx(request *Request) ([]byte, error) {
+	return push(request, true, true)
+}
+func rpushx(request *Request) ([]byte, error) {
+	return push(request, false, true)
+}
+
+// push implements LPUSH, RPUSH and their X variants which only push to existing lists
+func push(request *Request, head bool, onlyExisting bool) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	key := args[0]
+	elements := args[1:]
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+
+	list, ok, err := lookupList(store, key)
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok && onlyExisting {
+		return resp.IntegerDecoder(0), nil
+	}
+	if head {
+		data := make([]string, 0, len(elements)+len(list.Data))
+		for i := len(elements) - 1; i >= 0; i-- {
+			data = append(data, elements[i])
+		}
+		list.Data = append(data, list.Data...)
+	} else {
+		list.Data = append(list.Data, elements...)
+	}
+	storeList(request, store, key, list, pushEvent(head))
+	out := resp.IntegerDecoder(len(list.Data))
+	serveBlockedClients(request, store, key)
+	return out, nil
+}
+
+func lpop(request *Request) ([]byte, error) {
+	return pop(request, true)
+}
+func rpop(request *Request) ([]byte, error) {
+	return pop(request, false)
+}
+
+// pop implements LPOP and RPOP with the optional count argument
+func pop(request *Request, head bool) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 1 && len(args) != 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	key := args[0]
+	count := 1
+	withCount := len(args) == 2
+	if withCount {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			return resp.ErrorDecoder("ERR value is out of range, must be positive"), ErrInvalidFormat
+		}
+		count = n
+	}
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+
+	list, ok, err := lookupList(store, key)
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok {
+		if withCount {
+			return []byte(resp.NilArray), nil
+		}
+		return []byte(resp.Nil), nil
+	}
+	if count == 0 {
+		// nothing is popped, watchers and subscribers are not told
+		return resp.ArrayDecoder(nil), nil
+	}
+	if count > len(list.Data) {
+		count = len(list.Data)
+	}
+	popped := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		popped = append(popped, popElement(&list, head))
+	}
+	storeList(request, store, key, list, popEvent(head))
+	if withCount {
+		return resp.ArrayDecoder(popped), nil
+	}
+	return resp.BulkStringDecoder(popped[0]), nil
+}
+
+func llen(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 1 {
+		return wrongArgsError(request.Cmd)
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	list, found, err := lookupList(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !found {
+		request.keyMiss(args[0])
+	}
+	return resp.IntegerDecoder(len(list.Data)), nil
+}
+
+func lrange(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 3 {
+		return wrongArgsError(request.Cmd)
+	}
+	start, err := strconv.Atoi(args[1])
+	if err != nil {
+		return resp.ErrorDecoder(NotIntegerErr), ErrInvalidFormat
+	}
+	stop, err := strconv.Atoi(args[2])
+	if err != nil {
+		return resp.ErrorDecoder(NotIntegerErr), ErrInvalidFormat
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	list, found, err := lookupList(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !found {
+		request.keyMiss(args[0])
+	}
+	start, stop, ok := normalizeRange(start, stop, len(list.Data))
+	if !ok {
+		return resp.ArrayDecoder(nil), nil
+	}
+	return resp.ArrayDecoder(list.Data[start : stop+1]), nil
+}
+
+func lindex(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	index, err := strconv.Atoi(args[1])
+	if err != nil {
+		return resp.ErrorDecoder(NotIntegerErr), ErrInvalidFormat
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	list, found, err := lookupList(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !found {
+		request.keyMiss(args[0])
+	}
+	index = normalizeIndex(index, len(list.Data))
+	if index < 0 || index >= len(list.Data) {
+		return []byte(resp.Nil), nil
+	}
+	return resp.BulkStringDecoder(list.Data[index]), nil
+}
+
+func lset(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 3 {
+		return wrongArgsError(request.Cmd)
+	}
+	index, err := strconv.Atoi(args[1])
+	if err != nil {
+		return resp.ErrorDecoder(NotIntegerErr), ErrInvalidFormat
+	}
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	list, ok, err := lookupList(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok {
+		return resp.ErrorDecoder("ERR no such key"), ErrInvalidFormat
+	}
+	index = normalizeIndex(index, len(list.Data))
+	if index < 0 || index >= len(list.Data) {
+		return resp.ErrorDecoder("ERR index out of range"), ErrInvalidFormat
+	}
+	list.Data[index] = args[2]
+	store.Touch(args[0])
+	request.notify(notifyList, "lset", args[0])
+	return resp.SimpleStringDecoder("OK"), nil
+}
+
+// LREM key count element
+// count > 0 removes from head to tail, count < 0 from tail to head, 0 removes all
+func lrem(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 3 {
+		return wrongArgsError(request.Cmd)
+	}
+	count, err := strconv.Atoi(args[1])
+	if err != nil {
+		return resp.ErrorDecoder(NotIntegerErr), ErrInvalidFormat
+	}
+	key := args[0]
+	element := args[2]
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	list, ok, err := lookupList(store, key)
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok {
+		return resp.IntegerDecoder(0), nil
+	}
+
+	limit := count
+	if limit < 0 {
+		limit = -limit
+	}
+	removed := 0
+	keep := make([]bool, len(list.Data))
+	for i := range keep {
+		keep[i] = true
+	}
+	for n := 0; n < len(list.Data); n++ {
+		i := n
+		if count < 0 {
+			i = len(list.Data) - 1 - n
+		}
+		if list.Data[i] == element && (limit == 0 || removed < limit) {
+			keep[i] = false
+			removed++
+		}
+	}
+	if removed == 0 {
+		return resp.IntegerDecoder(0), nil
+	}
+	data := make([]string, 0, len(list.Data)-removed)
+	for i, elem := range list.Data {
+		if keep[i] {
+			data = append(data, elem)
+		}
+	}
+	list.Data = data
+	storeList(request, store, key, list, "lrem")
+	return resp.IntegerDecoder(removed), nil
+}
+
+func ltrim(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 3 {
+		return wrongArgsError(request.Cmd)
+	}
+	start, err := strconv.Atoi(args[1])
+	if err != nil {
+		return resp.ErrorDecoder(NotIntegerErr), ErrInvalidFormat
+	}
+	stop, err := strconv.Atoi(args[2])
+	if err != nil {
+		return resp.ErrorDecoder(NotIntegerErr), ErrInvalidFormat
+	}
+	key := args[0]
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	list, ok, err := lookupList(store, key)
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok {
+		return resp.SimpleStringDecoder("OK"), nil
+	}
+	start, stop, ok = normalizeRange(start, stop, len(list.Data))
+	if !ok {
+		list.Data = nil
+	} else {
+		list.Data = list.Data[start : stop+1]
+	}
+	storeList(request, store, key, list, "ltrim")
+	return resp.SimpleStringDecoder("OK"), nil
+}
+
+// LINSERT key <BEFORE | AFTER> pivot element
+func linsert(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 4 {
+		return wrongArgsError(request.Cmd)
+	}
+	var after bool
+	switch strings.ToUpper(args[1]) {
+	case "BEFORE":
+		after = false
+	case "AFTER":
+		after = true
+	default:
+		return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
+	}
+	key := args[0]
+	pivot := args[2]
+	element := args[3]
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	list, ok, err := lookupList(store, key)
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok {
+		return resp.IntegerDecoder(0), nil
+	}
+	pos := -1
+	for i, elem := range list.Data {
+		if elem == pivot {
+			pos = i
+			break
+		}
+	}
+	if pos == -1 {
+		return resp.IntegerDecoder(-1), nil
+	}
+	if after {
+		pos++
+	}
+	data := make([]string, 0, len(list.Data)+1)
+	data = append(data, list.Data[:pos]...)
+	data = append(data, element)
+	list.Data = append(data, list.Data[pos:]...)
+	storeList(request, store, key, list, "linsert")
+	return resp.IntegerDecoder(len(list.Data)), nil
+}
+
+// LPOS key element [RANK rank] [COUNT num-matches] [MAXLEN len]
+func lpos(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	rank := 1
+	count := 0
+	maxLen := 0
+	withCount := false
+	for i := 2; i < len(args); i++ {
+		if i+1 >= len(args) {
+			return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
+		}
+		n, err := strconv.Atoi(args[i+1])
+		if err != nil {
+			return resp.ErrorDecoder(NotIntegerErr), ErrInvalidFormat
+		}
+		switch strings.ToUpper(args[i]) {
+		case "RANK":
+			if n == 0 {
+				return resp.ErrorDecoder("ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list"), ErrInvalidFormat
+			}
+			rank = n
+		case "COUNT":
+			if n < 0 {
+				return resp.ErrorDecoder("ERR COUNT can't be negative"), ErrInvalidFormat
+			}
+			count = n
+			withCount = true
+		case "MAXLEN":
+			if n < 0 {
+				return resp.ErrorDecoder("ERR MAXLEN can't be negative"), ErrInvalidFormat
+			}
+			maxLen = n
+		default:
+			return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
+		}
+		i++
+	}
+
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	list, found, err := lookupList(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !found {
+		request.keyMiss(args[0])
+	}
+
+	element := args[1]
+	skip := rank - 1
+	if rank < 0 {
+		skip = -rank - 1
+	}
+	var matches []int
+	for n := 0; n < len(list.Data); n++ {
+		if maxLen > 0 && n >= maxLen {
+			break
+		}
+		i := n
+		if rank < 0 {
+			i = len(list.Data) - 1 - n
+		}
+		if list.Data[i] != element {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		matches = append(matches, i)
+		if !withCount || (count > 0 && len(matches) == count) {
+			break
+		}
+	}
+
+	if withCount {
+		return resp.IntegerArrayDecoder(matches), nil
+	}
+	if len(matches) == 0 {
+		return []byte(resp.Nil), nil
+	}
+	return resp.IntegerDecoder(matches[0]), nil
+}
+
+// LMOVE source destination <LEFT | RIGHT> <LEFT | RIGHT>
+func lmove(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 4 {
+		return wrongArgsError(request.Cmd)
+	}
+	fromHead, err := parseDirection(args[2])
+	if err != nil {
+		return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
+	}
+	toHead, err := parseDirection(args[3])
+	if err != nil {
+		return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
+	}
+	return move(request, args[0], args[1], fromHead, toHead)
+}
+
+// RPOPLPUSH source destination
+func rpoplpush(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	return move(request, args[0], args[1], false, true)
+}
+
+func move(request *Request, src string, dst string, fromHead bool, toHead bool) ([]byte, error) {
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	value, ok, err := moveElement(request, store, src, dst, fromHead, toHead)
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok {
+		return []byte(resp.Nil), nil
+	}
+	serveBlockedClients(request, store, dst)
+	return resp.BulkStringDecoder(value), nil
+}
+
+// blocking commands
+
+func blpop(request *Request) ([]byte, error) {
+	return blockingPop(request, true)
+}
+func brpop(request *Request) ([]byte, error) {
+	return blockingPop(request, false)
+}
+
+// blockingPop implements BLPOP and BRPOP key [key ...] timeout
+// served pops are propagated as LPOP / RPOP
+func blockingPop(request *Request, head bool) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	timeout, err := parseTimeout(args[len(args)-1])
+	if err != nil {
+		return resp.ErrorDecoder(err.Error()), ErrInvalidFormat
+	}
+	keys := args[:len(args)-1]
+	store := request.db()
+	store.Mu.Lock()
+	for _, key := range keys {
+		list, ok, err := lookupList(store, key)
+		if err != nil {
+			store.Mu.Unlock()
+			return wrongTypeError()
+		}
+		if !ok {
+			continue
+		}
+		value := popElement(&list, head)
+		storeList(request, store, key, list, popEvent(head))
+		store.Mu.Unlock()
+		request.alsoPropagate(popCommandName(head), key)
+		return resp.ArrayDecoder([]string{key, value}), nil
+	}
+	waiter := newListWaiter(keys)
+	waiter.head = head
+	blockedClients.add(store, waiter)
+	store.Mu.Unlock()
+
+	res, ok := waitForList(request, store, waiter, timeout)
+	if !ok {
+		return []byte(resp.NilArray), nil
+	}
+	return resp.ArrayDecoder([]string{res.key, res.value}), nil
+}
+
+// BLMOVE source destination <LEFT | RIGHT> <LEFT | RIGHT> timeout
+func blmove(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 5 {
+		return wrongArgsError(request.Cmd)
+	}
+	fromHead, err := parseDirection(args[2])
+	if err != nil {
+		return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
+	}
+	toHead, err := parseDirection(args[3])
+	if err != nil {
+		return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
+	}
+	return blockingMove(request, args[0], args[1], fromHead, toHead, args[4])
+}
+
+// BRPOPLPUSH source destination timeout
+func brpoplpush(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 3 {
+		return wrongArgsError(request.Cmd)
+	}
+	return blockingMove(request, args[0], args[1], false, true, args[2])
+}
+
+// blockingMove implements BLMOVE and BRPOPLPUSH, served moves are propagated as LMOVE
+func blockingMove(request *Request, src string, dst string, fromHead bool, toHead bool, timeoutArg string) ([]byte, error) {
+	timeout, err := parseTimeout(timeoutArg)
+	if err != nil {
+		return resp.ErrorDecoder(err.Error()), ErrInvalidFormat
+	}
+	store := request.db()
+	store.Mu.Lock()
+	value, ok, err := moveElement(request, store, src, dst, fromHead, toHead)
+	if err != nil {
+		store.Mu.Unlock()
+		return wrongTypeError()
+	}
+	if ok {
+		request.alsoPropagate("LMOVE", src, dst, directionName(fromHead), directionName(toHead))
+		serveBlockedClients(request, store, dst)
+		store.Mu.Unlock()
+		return resp.BulkStringDecoder(value), nil
+	}
+	waiter := newListWaiter([]string{src})
+	waiter.head = fromHead
+	waiter.move = true
+	waiter.dest = dst
+	waiter.toHead = toHead
+	blockedClients.add(store, waiter)
+	store.Mu.Unlock()
+
+	res, ok := waitForList(request, store, waiter, timeout)
+	if !ok {
+		return []byte(resp.Nil), nil
+	}
+	if res.err != nil {
+		return res.err, ErrWrongType
+	}
+	return resp.BulkStringDecoder(res.value), nil
+}
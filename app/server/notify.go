@@ -0,0 +1,119 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Keyspace notifications.
+// Commands notify their modifications next to the Touch of the modified key, and read
+// commands notify the keys they miss. A notification is published as a pub/sub message to
+// __keyspace@<db>__:<key> with the event as payload (class K) and to
+// __keyevent@<db>__:<event> with the key as payload (class E), when the
+// notify-keyspace-events configuration enables its class. Notifications are off by default,
+// they then cost a single atomic load.
+
+const (
+	notifyKeyspace = 1 << iota // K
+	notifyKeyevent             // E
+	notifyGeneric              // g
+	notifyString               // $
+	notifyList                 // l
+	notifySet                  // s
+	notifyHash                 // h
+	notifyZSet                 // z
+	notifyExpired              // x
+	notifyEvicted              // e
+	notifyStream               // t
+	notifyKeyMiss              // m
+	// A is an alias for every class but the key misses
+	notifyAll = notifyGeneric | notifyString | notifyList | notifySet | notifyHash | notifyZSet |
+		notifyExpired | notifyEvicted | notifyStream
+)
+
+var ErrInvalidEventClass = errors.New("Invalid event class character. Use 'Ag$lshzxeKEtm'.")
+
+// keyspaceEvents holds the classes enabled by notify-keyspace-events
+var keyspaceEvents atomic.Int64
+
+// classLetters are the classes in the order they are reported by CONFIG GET
+var classLetters = []struct {
+	letter byte
+	class  int
+}{
+	{'g', notifyGeneric}, {'$', notifyString}, {'l', notifyList}, {'s', notifySet},
+	{'h', notifyHash}, {'z', notifyZSet}, {'x', notifyExpired}, {'e', notifyEvicted},
+	{'t', notifyStream}, {'K', notifyKeyspace}, {'E', notifyKeyevent}, {'m', notifyKeyMiss},
+}
+
+// parseKeyspaceEvents turns the class letters of notify-keyspace-events into flags
+func parseKeyspaceEvents(classes string) (int, error) {
+	flags := 0
+outer:
+	for i := 0; i < len(classes); i++ {
+		if classes[i] == 'A' {
+			flags |= notifyAll
+			continue
+		}
+		for _, cl := range classLetters {
+			if cl.letter == classes[i] {
+				flags |= cl.class
+				continue outer
+			}
+		}
+		return 0, ErrInvalidEventClass
+	}
+	return flags, nil
+}
+
+// formatKeyspaceEvents turns flags back into class letters, A standing for every class
+// it covers
+func formatKeyspaceEvents(flags int) string {
+	var sb strings.Builder
+	all := flags&notifyAll == notifyAll
+	if all {
+		sb.WriteByte('A')
+	}
+	for _, cl := range classLetters {
+		if flags&cl.class != 0 && !(all && cl.class&notifyAll != 0) {
+			sb.WriteByte(cl.letter)
+		}
+	}
+	return sb.String()
+}
+
+// setKeyspaceEvents enables the classes of notify-keyspace-events
+func setKeyspaceEvents(classes string) error {
+	flags, err := parseKeyspaceEvents(classes)
+	if err != nil {
+		return err
+	}
+	keyspaceEvents.Store(int64(flags))
+	return nil
+}
+
+// notifyKeyspaceEvent publishes event on key of database db when its class is enabled
+func notifyKeyspaceEvent(class int, event string, key string, db int) {
+	flags := int(keyspaceEvents.Load())
+	if flags&class == 0 {
+		return
+	}
+	if flags&notifyKeyspace != 0 {
+		pubSub.publish("__keyspace@"+strconv.Itoa(db)+"__:"+key, event)
+	}
+	if flags&notifyKeyevent != 0 {
+		pubSub.publish("__keyevent@"+strconv.Itoa(db)+"__:"+event, key)
+	}
+}
+
+// notify publishes event on key of the database selected by the client of request
+func (request *Request) notify(class int, event string, key string) {
+	notifyKeyspaceEvent(class, event, key, request.Client.DbIndex)
+}
+
+// keyMiss notifies that a read command found no key
+func (request *Request) keyMiss(key string) {
+	request.notify(notifyKeyMiss, "keymiss", key)
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"sync/atomic"
+
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// Protocol negotiation.
+// A connection speaks RESP2 until HELLO 3 switches it to RESP3, HELLO 2 switches it back.
+// Handlers encode their replies in RESP2 and only the replies whose shape differs in RESP3
+// ask the client for it: field/value replies become maps, set members sets, scores doubles,
+// members with their scores arrays of [member, score] pairs, and pub/sub messages and
+// (un)subscription confirmations push frames. The nils of a reply, nested in arrays or not,
+// are turned into nulls on the way out. Since push frames cannot be mistaken for replies,
+// a RESP3 client may run any command while subscribed.
+
+// serverVersion is the Redis version reported by HELLO, whose commands this server follows
+const serverVersion = "7.4.0"
+
+// clientIDs numbers the clients in the order they first need an ID
+var clientIDs atomic.Int64
+
+// protocol is the RESP version spoken by client, 2 until HELLO
+func (client *Client) protocol() int {
+	if client.proto == 0 {
+		return 2
+	}
+	return client.proto
+}
+
+// resp3 reports whether client negotiated RESP3
+func (client *Client) resp3() bool {
+	return client.proto == 3
+}
+
+// id returns the ID of client, given on first use
+func (client *Client) id() int64 {
+	if client.clientID == 0 {
+		client.clientID = clientIDs.Add(1)
+	}
+	return client.clientID
+}
+
+// mapReply encodes flat key/value pairs, as a map in RESP3 and a flat array in RESP2
+func (client *Client) mapReply(pairs []string) []byte {
+	if client.resp3() {
+		return resp.MapDecoder(pairs)
+	}
+	return resp.ArrayDecoder(pairs)
+}
+
+// rawMapReply is mapReply for already encoded keys and values
+func (client *Client) rawMapReply(pairs [][]byte) []byte {
+	if client.resp3() {
+		return resp.RawMapDecoder(pairs)
+	}
+	return resp.RawArrayDecoder(pairs)
+}
+
+// setReply encodes set members, as a set in RESP3 and an array in RESP2
+func (client *Client) setReply(members []string) []byte {
+	if client.resp3() {
+		return resp.SetDecoder(members)
+	}
+	return resp.ArrayDecoder(members)
+}
+
+// doubleReply encodes a score, as a double in RESP3 and a bulk string in RESP2
+func (client *Client) doubleReply(score float64) []byte {
+	if client.resp3() {
+		return resp.DoubleDecoder(score)
+	}
+	return resp.BulkStringDecoder(formatScore(score))
+}
+
+// textReply encodes text meant for humans, like INFO, as a verbatim string in RESP3 and a
+// bulk string in RESP2
+func (client *Client) textReply(text string) []byte {
+	if client.resp3() {
+		return resp.VerbatimStringDecoder("txt", text)
+	}
+	return resp.BulkStringDecoder(text)
+}
+
+// nullReply is the nil bulk string of the protocol of client
+func (client *Client) nullReply() []byte {
+	if client.resp3() {
+		return resp.NullDecoder()
+	}
+	return []byte(resp.Nil)
+}
+
+// protocolReply turns the nils of a reply into the nulls of RESP3
+func (client *Client) protocolReply(out []byte) []byte {
+	if client.resp3() {
+		return resp.ReplaceNils(out)
+	}
+	return out
+}
+
+// pushFrame is an out-of-band frame, like a pub/sub message, sent as a push in RESP3 and as
+// an array in RESP2. It is encoded at most once per protocol however many clients get it.
+type pushFrame struct {
+	elements     [][]byte
+	resp2, resp3 []byte
+}
+
+func newPushFrame(elements ...string) *pushFrame {
+	f := &pushFrame{}
+	for _, element := range elements {
+		f.elements = append(f.elements, resp.BulkStringDecoder(element))
+	}
+	return f
+}
+
+// encode returns the frame in the protocol of client
+func (f *pushFrame) encode(client *Client) []byte {
+	if client.resp3() {
+		if f.resp3 == nil {
+			f.resp3 = resp.PushDecoder(f.elements)
+		}
+		return f.resp3
+	}
+	if f.resp2 == nil {
+		f.resp2 = resp.RawArrayDecoder(f.elements)
+	}
+	return f.resp2
+}
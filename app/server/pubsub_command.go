@@ -0,0 +1,438 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+	"github.com/codecrafters-io/redis-starter-go/app/utils"
+)
+
+// Publish/subscribe: SUBSCRIBE, PSUBSCRIBE, their UNSUBSCRIBE, PUBLISH and PUBSUB, and
+// sharded pub/sub with SSUBSCRIBE, SUNSUBSCRIBE and SPUBLISH.
+// Shard channels are a namespace of their own: SPUBLISH only reaches the subscribers of the
+// shard channel, never those of a classic channel of the same name nor the patterns, and
+// their subscriptions are counted apart in the confirmations.
+// A client subscribed to a channel, a pattern or a shard channel is in subscriber mode,
+// where only the subscription commands, PING and QUIT are allowed, unless it speaks RESP3
+// where messages and confirmations are push frames.
+// PUBLISH does not write to the subscribers: it queues the message to the output of each
+// of them, which is written by a goroutine of its own, so a slow subscriber never blocks the
+// publisher. A subscriber that lets more than pubsubOutputLimit bytes pile up is
+// disconnected, like the pubsub client-output-buffer-limit of Redis.
+// Once a client subscribed, its replies go through the same output so they keep their
+// order with the messages. Subscriptions are registered and confirmed under the hub lock,
+// so a message is never delivered before the confirmation of its subscription.
+
+const pubsubOutputLimit = 32 * 1024 * 1024
+
+// subscriptionKind tells channels, patterns and shard channels apart
+type subscriptionKind int
+
+const (
+	channelKind subscriptionKind = iota
+	patternKind
+	shardKind
+)
+
+type pubSubHub struct {
+	mu            sync.RWMutex
+	channels      map[string]map[*Client]struct{}
+	patterns      map[string]map[*Client]struct{}
+	shardChannels map[string]map[*Client]struct{}
+}
+
+var pubSub = &pubSubHub{
+	channels:      make(map[string]map[*Client]struct{}),
+	patterns:      make(map[string]map[*Client]struct{}),
+	shardChannels: make(map[string]map[*Client]struct{}),
+}
+
+// clientOutput is the queue of the replies and messages of a subscribed client
+type clientOutput struct {
+	mu     sync.Mutex
+	ready  *sync.Cond
+	queue  [][]byte
+	size   int
+	closed bool
+	writer *bufio.Writer
+	conn   *net.Conn
+	done   chan struct{}
+}
+
+func newClientOutput(writer *bufio.Writer, conn *net.Conn) *clientOutput {
+	o := &clientOutput{writer: writer, conn: conn, done: make(chan struct{})}
+	o.ready = sync.NewCond(&o.mu)
+	go o.run()
+	return o
+}
+
+// write queues a reply of the client
+func (o *clientOutput) write(p []byte) {
+	o.enqueue(p, false)
+}
+
+// publish queues a message, the client is disconnected when its output is over the limit
+func (o *clientOutput) publish(p []byte) {
+	o.enqueue(p, true)
+}
+
+func (o *clientOutput) enqueue(p []byte, limited bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed || len(p) == 0 {
+		return
+	}
+	if limited && o.size+len(p) > pubsubOutputLimit {
+		o.closed = true
+		o.queue, o.size = nil, 0
+		if o.conn != nil {
+			(*o.conn).Close()
+		}
+		o.ready.Signal()
+		return
+	}
+	o.queue = append(o.queue, p)
+	o.size += len(p)
+	o.ready.Signal()
+}
+
+// run writes the queued output until it is closed and drained
+func (o *clientOutput) run() {
+	defer close(o.done)
+	for {
+		o.mu.Lock()
+		for len(o.queue) == 0 && !o.closed {
+			o.ready.Wait()
+		}
+		queue, closed := o.queue, o.closed
+		o.queue, o.size = nil, 0
+		o.mu.Unlock()
+		for _, p := range queue {
+			o.writer.Write(p)
+		}
+		o.writer.Flush()
+		if closed {
+			return
+		}
+	}
+}
+
+// close stops the output once what is queued was written
+func (o *clientOutput) close() {
+	o.mu.Lock()
+	o.closed = true
+	o.ready.Signal()
+	o.mu.Unlock()
+	<-o.done
+}
+
+// Reply writes the reply of a command, through the output once the client subscribed
+func (client *Client) Reply(writer *bufio.Writer, out []byte) {
+	out = client.protocolReply(out)
+	if client.output != nil {
+		client.output.write(out)
+		return
+	}
+	writer.Write(out)
+	writer.Flush()
+}
+
+// subscribed reports whether client is in subscriber mode
+func (client *Client) subscribed() bool {
+	return len(client.channels)+len(client.patterns)+len(client.shardChannels) > 0
+}
+
+// Close releases the subscriptions and the watched keys of client when its connection ends
+func (client *Client) Close() {
+	pubSub.mu.Lock()
+	for _, kind := range []subscriptionKind{channelKind, patternKind, shardKind} {
+		subscribers, own := pubSub.subscriptions(client, kind)
+		for name := range *own {
+			pubSub.remove(subscribers, name, client)
+		}
+		*own = nil
+	}
+	pubSub.mu.Unlock()
+	if client.output != nil {
+		client.output.close()
+	}
+	client.unwatchAll()
+}
+
+// isSubscriptionCommand reports whether name changes the subscriptions of the client
+func isSubscriptionCommand(name string) bool {
+	switch name {
+	case "SUBSCRIBE", "UNSUBSCRIBE", "PSUBSCRIBE", "PUNSUBSCRIBE", "SSUBSCRIBE", "SUNSUBSCRIBE":
+		return true
+	}
+	return false
+}
+
+// allowedWhileSubscribed reports whether name can run in subscriber mode
+func allowedWhileSubscribed(name string) bool {
+	return isSubscriptionCommand(name) || name == "PING" || name == "QUIT"
+}
+
+func subscriberModeError(cmd *Command) []byte {
+	return resp.ErrorDecoder("ERR Can't execute '" + strings.ToLower(cmd.Name) +
+		"': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT are allowed in this context")
+}
+
+// subscriberOutput returns the output of the client of request, created on its first
+// subscription
+func (request *Request) subscriberOutput() *clientOutput {
+	client := request.Client
+	if client.output == nil {
+		writer := request.Writer
+		if writer == nil {
+			writer = bufio.NewWriter(io.Discard)
+		}
+		client.output = newClientOutput(writer, request.Conn)
+	}
+	return client.output
+}
+
+// subscriptions returns the subscribers of the hub and the subscriptions of client of a kind
+func (h *pubSubHub) subscriptions(client *Client, kind subscriptionKind) (map[string]map[*Client]struct{}, *map[string]struct{}) {
+	switch kind {
+	case patternKind:
+		return h.patterns, &client.patterns
+	case shardKind:
+		return h.shardChannels, &client.shardChannels
+	}
+	return h.channels, &client.channels
+}
+
+// subscriptionCount is the count reported by the confirmations of a kind, shard channels are
+// counted apart from channels and patterns
+func (client *Client) subscriptionCount(kind subscriptionKind) int {
+	if kind == shardKind {
+		return len(client.shardChannels)
+	}
+	return len(client.channels) + len(client.patterns)
+}
+
+func (h *pubSubHub) remove(subscribers map[string]map[*Client]struct{}, name string, client *Client) {
+	delete(subscribers[name], client)
+	if len(subscribers[name]) == 0 {
+		delete(subscribers, name)
+	}
+}
+
+// subscribe subscribes client to names and queues a confirmation for each of them
+func (h *pubSubHub) subscribe(client *Client, names []string, kind subscriptionKind, reply string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	subscribers, own := h.subscriptions(client, kind)
+	if *own == nil {
+		*own = make(map[string]struct{})
+	}
+	for _, name := range names {
+		if _, ok := (*own)[name]; !ok {
+			(*own)[name] = struct{}{}
+			if subscribers[name] == nil {
+				subscribers[name] = make(map[*Client]struct{})
+			}
+			subscribers[name][client] = struct{}{}
+		}
+		client.output.write(subscriptionReply(client, reply, resp.BulkStringDecoder(name), client.subscriptionCount(kind)))
+	}
+}
+
+// unsubscribe unsubscribes client from names, from all its subscriptions of the kind when
+// there are none, and queues a confirmation for each of them
+func (h *pubSubHub) unsubscribe(client *Client, names []string, kind subscriptionKind, reply string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	subscribers, own := h.subscriptions(client, kind)
+	if len(names) == 0 {
+		for name := range *own {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			client.output.write(subscriptionReply(client, reply, client.nullReply(), client.subscriptionCount(kind)))
+			return
+		}
+	}
+	for _, name := range names {
+		if _, ok := (*own)[name]; ok {
+			delete(*own, name)
+			h.remove(subscribers, name, client)
+		}
+		client.output.write(subscriptionReply(client, reply, resp.BulkStringDecoder(name), client.subscriptionCount(kind)))
+	}
+}
+
+// publish queues message to the subscribers of channel and of the patterns matching it,
+// and returns how many received it
+func (h *pubSubHub) publish(channel, message string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	receivers := 0
+	if subscribers := h.channels[channel]; len(subscribers) > 0 {
+		frame := newPushFrame("message", channel, message)
+		for client := range subscribers {
+			client.output.publish(frame.encode(client))
+			receivers++
+		}
+	}
+	for pattern, subscribers := range h.patterns {
+		if !utils.StringMatch(pattern, channel, false) {
+			continue
+		}
+		frame := newPushFrame("pmessage", pattern, channel, message)
+		for client := range subscribers {
+			client.output.publish(frame.encode(client))
+			receivers++
+		}
+	}
+	return receivers
+}
+
+// spublish queues message to the subscribers of the shard channel and returns how many
+// received it
+func (h *pubSubHub) spublish(channel, message string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	subscribers := h.shardChannels[channel]
+	if len(subscribers) > 0 {
+		frame := newPushFrame("smessage", channel, message)
+		for client := range subscribers {
+			client.output.publish(frame.encode(client))
+		}
+	}
+	return len(subscribers)
+}
+
+// subscriptionReply is the confirmation of a (un)subscription, with the count of the
+// subscriptions client is left with
+func subscriptionReply(client *Client, reply string, name []byte, count int) []byte {
+	elements := [][]byte{resp.BulkStringDecoder(reply), name, resp.IntegerDecoder(count)}
+	if client.resp3() {
+		return resp.PushDecoder(elements)
+	}
+	return resp.RawArrayDecoder(elements)
+}
+
+// SUBSCRIBE channel [channel ...]
+func subscribe(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 1 {
+		return wrongArgsError(request.Cmd)
+	}
+	request.subscriberOutput()
+	pubSub.subscribe(request.Client, args, channelKind, "subscribe")
+	return nil, nil
+}
+
+// PSUBSCRIBE pattern [pattern ...]
+func psubscribe(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 1 {
+		return wrongArgsError(request.Cmd)
+	}
+	request.subscriberOutput()
+	pubSub.subscribe(request.Client, args, patternKind, "psubscribe")
+	return nil, nil
+}
+
+// UNSUBSCRIBE [channel ...]
+func unsubscribe(request *Request) ([]byte, error) {
+	request.subscriberOutput()
+	pubSub.unsubscribe(request.Client, request.Cmd.Args, channelKind, "unsubscribe")
+	return nil, nil
+}
+
+// PUNSUBSCRIBE [pattern ...]
+func punsubscribe(request *Request) ([]byte, error) {
+	request.subscriberOutput()
+	pubSub.unsubscribe(request.Client, request.Cmd.Args, patternKind, "punsubscribe")
+	return nil, nil
+}
+
+// SSUBSCRIBE shardchannel [shardchannel ...]
+func ssubscribe(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 1 {
+		return wrongArgsError(request.Cmd)
+	}
+	request.subscriberOutput()
+	pubSub.subscribe(request.Client, args, shardKind, "ssubscribe")
+	return nil, nil
+}
+
+// SUNSUBSCRIBE [shardchannel ...]
+func sunsubscribe(request *Request) ([]byte, error) {
+	request.subscriberOutput()
+	pubSub.unsubscribe(request.Client, request.Cmd.Args, shardKind, "sunsubscribe")
+	return nil, nil
+}
+
+// PUBLISH channel message
+func publish(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	return resp.IntegerDecoder(pubSub.publish(args[0], args[1])), nil
+}
+
+// SPUBLISH shardchannel message
+func spublish(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	return resp.IntegerDecoder(pubSub.spublish(args[0], args[1])), nil
+}
+
+// PUBSUB CHANNELS [pattern] | NUMSUB [channel ...] | NUMPAT | SHARDCHANNELS [pattern] |
+// SHARDNUMSUB [shardchannel ...]
+func pubsub(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 1 {
+		return wrongArgsError(request.Cmd)
+	}
+	pubSub.mu.RLock()
+	defer pubSub.mu.RUnlock()
+	switch sub := strings.ToUpper(args[0]); sub {
+	case "CHANNELS", "SHARDCHANNELS":
+		if len(args) > 2 {
+			return wrongArgsError(request.Cmd)
+		}
+		subscribers := pubSub.channels
+		if sub == "SHARDCHANNELS" {
+			subscribers = pubSub.shardChannels
+		}
+		channels := []string{}
+		for channel := range subscribers {
+			if len(args) == 1 || utils.StringMatch(args[1], channel, false) {
+				channels = append(channels, channel)
+			}
+		}
+		sort.Strings(channels)
+		return resp.ArrayDecoder(channels), nil
+	case "NUMSUB", "SHARDNUMSUB":
+		subscribers := pubSub.channels
+		if sub == "SHARDNUMSUB" {
+			subscribers = pubSub.shardChannels
+		}
+		elements := make([][]byte, 0, 2*(len(args)-1))
+		for _, channel := range args[1:] {
+			elements = append(elements, resp.BulkStringDecoder(channel), resp.IntegerDecoder(len(subscribers[channel])))
+		}
+		return resp.RawArrayDecoder(elements), nil
+	case "NUMPAT":
+		if len(args) != 1 {
+			return wrongArgsError(request.Cmd)
+		}
+		return resp.IntegerDecoder(len(pubSub.patterns)), nil
+	}
+	return resp.ErrorDecoder("ERR unknown subcommand '" + args[0] + "'. Try PUBSUB HELP."), ErrInvalidFormat
+}
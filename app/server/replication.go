@@ -8,7 +8,9 @@ import (
 	"net"
 	"strconv"
 	"strings"
+	"sync"
 
+	"github.com/codecrafters-io/redis-starter-go/app/engine"
 	"github.com/codecrafters-io/redis-starter-go/app/rdb"
 )
 
@@ -23,6 +25,11 @@ type Replica struct {
 
 var replicasPendingWrite = make(chan *Replica)
 
+// replicationMu orders the replication stream: it guards the database selected on the
+// replicas, the buffers of the replicas and the replication offset, so that a command and
+// the SELECT preceding it are never separated by another command
+var replicationMu sync.Mutex
+
 func readRDBSnapshot(reader *bufio.Reader) ([]byte, error) {
 	// Read $<len>\r\n
 	line, err := reader.ReadString('\n')
@@ -47,40 +54,69 @@ func readRDBSnapshot(reader *bufio.Reader) ([]byte, error) {
 func sendBgServerReplication(request *Request) {
 	replica := replicaById[request.ConnId]
 	writer := request.Writer
-	rdbData, _ := rdb.GenerateRDBBinary(request.Serv.Db.Dict)
+	rdbData, _ := generateSnapshot(request.Serv)
 	lengthLine := fmt.Sprintf("$%d\r\n", len(rdbData))
 	writer.Write([]byte(lengthLine)) // send bulk string header
 	writer.Write(rdbData)
 	writer.Flush()
 	close(replica.Ready)
 }
+
+// generateSnapshot encodes every database for a full resynchronization
+func generateSnapshot(serv *Server) ([]byte, error) {
+	stores := serv.databases()
+	dicts := make([]*map[string]engine.RedisObj, len(stores))
+	for i, store := range stores {
+		store.Mu.RLock()
+		defer store.Mu.RUnlock()
+		dicts[i] = store.Dict
+	}
+	return rdb.GenerateDatabasesBinary(dicts)
+}
 func StartReplicationFlusher() {
 	go func() {
 		for replica := range replicasPendingWrite {
 			<-replica.Ready
-			if replica.Buffer.Len() > 0 {
-				data := replica.Buffer.Bytes()
-				n, err := replica.Write(data)
-				if err != nil {
-					continue
-				}
-				if n < len(data) {
-					replica.Buffer.Next(n)
-				} else {
-					replica.Buffer.Reset()
-				}
-			}
-			replica.Pending = false
-
+			flushReplica(replica)
 		}
 	}()
 }
-func queueReplica(replica *Replica) {
-	if !replica.Pending {
-		replica.Pending = true
-		replicasPendingWrite <- replica
+
+// flushReplica writes the buffer of replica until it is empty, without holding
+// replicationMu while writing. A replica whose connection failed stays pending.
+func flushReplica(replica *Replica) {
+	for {
+		replicationMu.Lock()
+		if replica.Buffer.Len() == 0 {
+			replica.Pending = false
+			replicationMu.Unlock()
+			return
+		}
+		data := bytes.Clone(replica.Buffer.Bytes())
+		replicationMu.Unlock()
+		n, err := replica.Write(data)
+		replicationMu.Lock()
+		replica.Buffer.Next(n)
+		replicationMu.Unlock()
+		if err != nil {
+			return
+		}
 	}
 }
+
+// hasReplicas reports whether replicas are connected to serv
+func hasReplicas(serv *Server) bool {
+	replicationMu.Lock()
+	defer replicationMu.Unlock()
+	return serv.ConnectedReplica != nil
+}
+
+// replicationOffset returns the offset of the replication stream of serv
+func replicationOffset(serv *Server) int {
+	replicationMu.Lock()
+	defer replicationMu.Unlock()
+	return serv.Offset
+}
 func connectToMaster(serv *Server, config *Configuration) {
 	parts := strings.Split(config.MasterInfo, " ")
 	if len(parts) != 2 {
@@ -93,6 +129,11 @@ func connectToMaster(serv *Server, config *Configuration) {
 	if err != nil {
 		return
 	}
+	for _, store := range serv.databases() {
+		store.Mu.Lock()
+		store.Replica = true
+		store.Mu.Unlock()
+	}
 	serv.Role = Slave
 	var masterConn net.Conn
 	for {
@@ -108,12 +149,30 @@ func connectToMaster(serv *Server, config *Configuration) {
 	}
 	NewSlave(serv)
 }
+
+// NewMasterClient returns the connection state of a replica to its master
+func NewMasterClient() *Client {
+	return &Client{master: true}
+}
+
+// setFromMaster marks the lookups of every database as made for the master or not, the
+// caller holds the exec gate exclusively
+func setFromMaster(serv *Server, fromMaster bool) {
+	for _, store := range serv.databases() {
+		store.Mu.Lock()
+		store.FromMaster = fromMaster
+		store.Mu.Unlock()
+	}
+}
+
 func handleMasterConnection(serv *Server) {
 	master := serv.ConnectedMaster
 	conn := master.Conn
 	reader := master.Reader
 	writer := master.Writer
 	fmt.Println("i am in handle master connection")
+	// the SELECT of the master applies to the commands following it
+	client := NewMasterClient()
 	for {
 		cmd, err := ReadCommand(reader)
 		if err == io.EOF {
@@ -129,10 +188,12 @@ func handleMasterConnection(serv *Server) {
 			Reader: reader,
 			Writer: writer,
 			Cmd:    &cmd,
+			Client: client,
 		}
 		out, err := ProcessCommand(&request)
+		replicationMu.Lock()
 		serv.Offset += len(encodeCommand(&cmd))
-		fmt.Println(serv.Offset)
+		replicationMu.Unlock()
 		if err != nil {
 			fmt.Println(err)
 		}
@@ -0,0 +1,201 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/engine"
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+	"github.com/codecrafters-io/redis-starter-go/app/utils"
+)
+
+// cursor-based iteration: SCAN over the keyspace, HSCAN, SSCAN and ZSCAN over a single key.
+// Each call holds the read lock only and visits the buckets holding about COUNT elements of
+// the index kept with the keyspace or the collection, see engine.ScanIndex for the
+// guarantees of the cursor. MATCH and TYPE filter the elements once fetched, so a call
+// may return fewer elements than COUNT, or none, before the iteration is complete.
+
+type scanOptions struct {
+	pattern  string
+	count    int
+	typeName string
+	noValues bool
+}
+
+// parseCursor parses the unsigned cursor of a scan command
+func parseCursor(arg string) (uint64, []byte) {
+	cursor, err := strconv.ParseUint(arg, 10, 64)
+	if err != nil {
+		return 0, resp.ErrorDecoder("ERR invalid cursor")
+	}
+	return cursor, nil
+}
+
+// parseScanOptions parses [MATCH pattern] [COUNT count], along with [TYPE type] for SCAN
+// and [NOVALUES] for HSCAN
+func parseScanOptions(cmd string, args []string) (scanOptions, []byte) {
+	opts := scanOptions{pattern: "*", count: 10}
+	for i := 0; i < len(args); i++ {
+		option := strings.ToUpper(args[i])
+		switch {
+		case option == "NOVALUES" && cmd == "HSCAN":
+			opts.noValues = true
+			continue
+		case option != "MATCH" && option != "COUNT" && (option != "TYPE" || cmd != "SCAN"):
+			return opts, resp.ErrorDecoder("ERR syntax error")
+		case i+1 >= len(args):
+			return opts, resp.ErrorDecoder("ERR syntax error")
+		}
+		value := args[i+1]
+		i++
+		switch option {
+		case "MATCH":
+			opts.pattern = value
+		case "COUNT":
+			count, err := strconv.Atoi(value)
+			if err != nil {
+				return opts, resp.ErrorDecoder(NotIntegerErr)
+			}
+			if count < 1 {
+				return opts, resp.ErrorDecoder("ERR syntax error")
+			}
+			opts.count = count
+		case "TYPE":
+			opts.typeName = value
+		}
+	}
+	return opts, nil
+}
+
+func (opts scanOptions) match(s string) bool {
+	if opts.pattern == "*" {
+		return true
+	}
+	return utils.StringMatch(opts.pattern, s, false)
+}
+
+// scanReply is the cursor of the next call followed by the elements found
+func scanReply(next uint64, elements []string) []byte {
+	return resp.RawArrayDecoder([][]byte{
+		resp.BulkStringDecoder(strconv.FormatUint(next, 10)),
+		resp.ArrayDecoder(elements),
+	})
+}
+
+// parseScan parses the cursor at args[0] and the options following it
+func parseScan(request *Request, args []string) (uint64, scanOptions, []byte) {
+	cursor, errOut := parseCursor(args[0])
+	if errOut != nil {
+		return 0, scanOptions{}, errOut
+	}
+	opts, errOut := parseScanOptions(strings.ToUpper(request.Cmd.Name), args[1:])
+	return cursor, opts, errOut
+}
+
+// SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+func scan(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 1 {
+		return wrongArgsError(request.Cmd)
+	}
+	cursor, opts, errOut := parseScan(request, args)
+	if errOut != nil {
+		return errOut, ErrInvalidFormat
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	var keys []string
+	next := store.Keys().Scan(cursor, opts.count, func(key string) {
+		obj := store.Lookup(key)
+		if obj == nil || (opts.typeName != "" && !strings.EqualFold(obj.Type(), opts.typeName)) {
+			return
+		}
+		if opts.match(key) {
+			keys = append(keys, key)
+		}
+	})
+	return scanReply(next, keys), nil
+}
+
+// HSCAN key cursor [MATCH pattern] [COUNT count] [NOVALUES]
+func hscan(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	cursor, opts, errOut := parseScan(request, args[1:])
+	if errOut != nil {
+		return errOut, ErrInvalidFormat
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	hash, _, err := lookupHash(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	var out []string
+	next := engine.ScanIndexOf(hash.Buckets, hash.Data).Scan(cursor, opts.count, func(field string) {
+		if !opts.match(field) {
+			return
+		}
+		out = append(out, field)
+		if !opts.noValues {
+			out = append(out, hash.Data[field])
+		}
+	})
+	return scanReply(next, out), nil
+}
+
+// SSCAN key cursor [MATCH pattern] [COUNT count]
+func sscan(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	cursor, opts, errOut := parseScan(request, args[1:])
+	if errOut != nil {
+		return errOut, ErrInvalidFormat
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	set, _, err := lookupSet(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	var out []string
+	next := engine.ScanIndexOf(set.Buckets, set.Data).Scan(cursor, opts.count, func(member string) {
+		if opts.match(member) {
+			out = append(out, member)
+		}
+	})
+	return scanReply(next, out), nil
+}
+
+// ZSCAN key cursor [MATCH pattern] [COUNT count]
+func zscan(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	cursor, opts, errOut := parseScan(request, args[1:])
+	if errOut != nil {
+		return errOut, ErrInvalidFormat
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	zset, _, err := lookupZSet(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	var out []string
+	next := engine.ScanIndexOf(zset.Buckets, zset.Data).Scan(cursor, opts.count, func(member string) {
+		if opts.match(member) {
+			out = append(out, member, formatScore(zset.Data[member]))
+		}
+	})
+	return scanReply(next, out), nil
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"bufio"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -19,6 +20,9 @@ import (
 var replicaById map[string]*Replica
 var ConfigLookup map[string]string
 
+// configMu guards ConfigLookup against CONFIG SET
+var configMu sync.RWMutex
+
 const (
 	Master = "MASTER"
 	Slave  = "SLAVE"
@@ -31,12 +35,54 @@ type Request struct {
 	Writer *bufio.Writer
 	Cmd    *Command
 	ConnId string
+	// state of the connection, a request without client runs on a new one
+	Client *Client
+	// commands propagated to replicas after Cmd, e.g. the pops of clients served by a push
+	AlsoPropagate []Command
+	// stream keys whose blocked readers are woken once the command was propagated
+	readyStreams []blockKey
+	// holdsGate is set while the command holds the exec gate shared, inExec for the
+	// commands run by EXEC
+	holdsGate bool
+	inExec    bool
+}
+
+// Client is the state of a connection kept from one command to the next
+type Client struct {
+	// database selected by SELECT
+	DbIndex int
+	// multi is set between MULTI and EXEC or DISCARD, dirty once a command failed to queue
+	multi  bool
+	dirty  bool
+	queued []Command
+	// keys watched by WATCH until the next EXEC, DISCARD or UNWATCH
+	watch   *engine.Watch
+	watched []watchedKey
+	// channels, patterns and shard channels subscribed to, output set once the client
+	// subscribed
+	channels      map[string]struct{}
+	patterns      map[string]struct{}
+	shardChannels map[string]struct{}
+	output        *clientOutput
+	// quit is set by QUIT
+	quit bool
+	// proto is the RESP version negotiated by HELLO, name the one given by SETNAME and
+	// clientID the ID reported by HELLO and CLIENT ID
+	proto    int
+	name     string
+	clientID int64
+	// master is set on the connection to the master of a replica
+	master bool
 }
+
 type Configuration struct {
 	Dir        string
 	DbFilename string
 	Port       string
 	MasterInfo string
+	Databases  int
+	// NotifyKeyspaceEvents are the classes of keyspace notifications, none by default
+	NotifyKeyspaceEvents string
 }
 type Node struct {
 	ReplicationId string
@@ -54,17 +100,23 @@ func (r Replica) Write(p []byte) (n int, err error) {
 }
 
 type Server struct {
-	ReplicationId    string
+	ReplicationId string
+	// Db is the database 0, Dbs every database when there are several
 	Db               *engine.DbStore
+	Dbs              []*engine.DbStore
 	Configuration    Configuration
 	Listener         net.Listener
 	Role             string
 	Offset           int
 	ConnectedReplica *[]*Replica
 	ConnectedMaster  *Node
+	// database of the last command sent to replicas, -1 when the next one needs a SELECT
+	replicationDb int
 }
 
 func (serv Server) Run() {
+	// connections are served by this copy of the server, so is the active expire cycle
+	StartActiveExpire(&serv)
 
 	l := serv.Listener
 	defer l.Close()
@@ -82,13 +134,18 @@ func (serv Server) Run() {
 func NewServer(config Configuration) (*Server, error) {
 	replicaById = make(map[string]*Replica)
 	InitCommands()
+	if err := setKeyspaceEvents(config.NotifyKeyspaceEvents); err != nil {
+		return nil, err
+	}
 	ConfigLookup = configToMap(&config)
 	//create data store instance
 	path := config.Dir + "/" + config.DbFilename
-	dict := rdb.Encode(path)
-	db := engine.DbStore{
-		Dict: &dict,
-		Mu:   &sync.RWMutex{},
+	dbs := make([]*engine.DbStore, max(config.Databases, 1))
+	for i, dict := range rdb.EncodeDatabases(path, len(dbs)) {
+		dbs[i] = &engine.DbStore{
+			Dict: &dict,
+			Mu:   &sync.RWMutex{},
+		}
 	}
 	serverAddress := net.JoinHostPort("localhost", config.Port)
 
@@ -100,7 +157,8 @@ func NewServer(config Configuration) (*Server, error) {
 
 	serv := Server{
 		ReplicationId:    utils.GenerateID(),
-		Db:               &db,
+		Db:               dbs[0],
+		Dbs:              dbs,
 		Configuration:    config,
 		Listener:         l,
 		Role:             Master,
@@ -117,12 +175,16 @@ func NewConfiguration() Configuration {
 	dbfilename := flag.String("dbfilename", "dump.rdb", "Database filename")
 	port := flag.String("port", "6379", "Port")
 	replica := flag.String("replicaof", "nil", "Is Replica")
+	databases := flag.Int("databases", 16, "Number of databases")
+	notifyKeyspaceEvents := flag.String("notify-keyspace-events", "", "Classes of keyspace notifications")
 	flag.Parse()
 	confg := Configuration{
-		Dir:        *dir,
-		DbFilename: *dbfilename,
-		Port:       *port,
-		MasterInfo: *replica,
+		Dir:                  *dir,
+		DbFilename:           *dbfilename,
+		Port:                 *port,
+		MasterInfo:           *replica,
+		Databases:            *databases,
+		NotifyKeyspaceEvents: *notifyKeyspaceEvents,
 	}
 	return confg
 }
@@ -132,7 +194,33 @@ func configToMap(config *Configuration) map[string]string {
 		"dir":        config.Dir,
 		"dbfilename": config.DbFilename,
 		"port":       config.Port,
+		"databases":  strconv.Itoa(config.Databases),
+		// reported the way CONFIG SET stores it
+		"notify-keyspace-events": formatKeyspaceEvents(int(keyspaceEvents.Load())),
+	}
+}
+
+// databases returns every database, only Db when the server was built with a single one
+func (serv *Server) databases() []*engine.DbStore {
+	if len(serv.Dbs) == 0 {
+		return []*engine.DbStore{serv.Db}
+	}
+	return serv.Dbs
+}
+
+// dbIndex returns the index of store among the databases
+func (serv *Server) dbIndex(store *engine.DbStore) int {
+	for i, db := range serv.databases() {
+		if db == store {
+			return i
+		}
 	}
+	return 0
+}
+
+// db returns the database selected by the client of the request
+func (request *Request) db() *engine.DbStore {
+	return request.Serv.databases()[request.Client.DbIndex]
 }
 
 // kanye west reference
@@ -231,12 +319,19 @@ func handleConnection(connection *net.Conn, serv *Server) {
 	writer := bufio.NewWriter(conn)
 	//create connectionId for this conenction
 	connId := utils.GenerateID()
+	client := &Client{}
+	defer client.Close()
 
 	for {
 		cmd, err := ReadCommand(reader)
-		if err == io.EOF {
+		// the connection is closed by a subscriber output over its limit
+		if err == io.EOF || errors.Is(err, net.ErrClosed) {
 			return
 		}
+		// an unknown command is answered inside a transaction, which it aborts
+		if errors.Is(err, ErrInvalidCommand) && client.multi {
+			err = nil
+		}
 		if err != nil {
 			fmt.Println(err)
 			continue
@@ -248,12 +343,15 @@ func handleConnection(connection *net.Conn, serv *Server) {
 			Writer: writer,
 			Cmd:    &cmd,
 			ConnId: connId,
+			Client: client,
 		}
 		out, err := ProcessCommand(&request)
 		if err != nil {
 			fmt.Println(err)
 		}
-		writer.Write(out)
-		writer.Flush()
+		client.Reply(writer, out)
+		if client.quit {
+			return
+		}
 	}
 }
@@ -3,12 +3,13 @@ package server
 import (
 	"bufio"
 	"bytes"
-	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/codecrafters-io/redis-starter-go/app/resp"
+	"github.com/codecrafters-io/redis-starter-go/app/utils"
 )
 
 // Server commands
@@ -19,14 +20,128 @@ func echo(request *Request) ([]byte, error) {
 	}
 	return resp.BulkStringDecoder(args[0]), nil
 }
+
+// PING, in subscriber mode PING [message] replies in the form of a message
 func ping(request *Request) ([]byte, error) {
 	args := request.Cmd.Args
+	if request.Client != nil && request.Client.subscribed() && !request.Client.resp3() && len(args) <= 1 {
+		return resp.ArrayDecoder([]string{"pong", strings.Join(args, "")}), nil
+	}
 	if len(args) != 0 {
 		return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
 	}
 	return resp.SimpleStringDecoder("PONG"), nil
 }
 
+// QUIT, the connection is closed once the reply was written
+func quit(request *Request) ([]byte, error) {
+	request.Client.quit = true
+	return resp.SimpleStringDecoder("OK"), nil
+}
+
+// HELLO [protover [AUTH username password] [SETNAME clientname]] switches the protocol of the
+// connection and describes the server. Without a password configured, AUTH accepts any
+// password of the default user.
+func hello(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	client := request.Client
+	proto := client.protocol()
+	if len(args) > 0 {
+		version, err := strconv.Atoi(args[0])
+		if err != nil {
+			return resp.ErrorDecoder("ERR Protocol version is not an integer or out of range"), ErrInvalidFormat
+		}
+		if version != 2 && version != 3 {
+			return resp.ErrorDecoder("NOPROTO unsupported protocol version"), ErrInvalidFormat
+		}
+		proto = version
+	}
+	name, setName := "", false
+	for i := 1; i < len(args); i++ {
+		option := strings.ToUpper(args[i])
+		switch {
+		case option == "AUTH" && i+2 < len(args):
+			if args[i+1] != "default" {
+				return resp.ErrorDecoder("WRONGPASS invalid username-password pair or user is disabled."), ErrInvalidFormat
+			}
+			i += 2
+		case option == "SETNAME" && i+1 < len(args):
+			if !validClientName(args[i+1]) {
+				return clientNameError(), ErrInvalidFormat
+			}
+			name, setName = args[i+1], true
+			i++
+		default:
+			return resp.ErrorDecoder("ERR Syntax error in HELLO option '" + args[i] + "'"), ErrInvalidFormat
+		}
+	}
+	client.proto = proto
+	if setName {
+		client.name = name
+	}
+
+	role := "master"
+	if request.Serv.Role == Slave {
+		role = "replica"
+	}
+	return client.rawMapReply([][]byte{
+		resp.BulkStringDecoder("server"), resp.BulkStringDecoder("redis"),
+		resp.BulkStringDecoder("version"), resp.BulkStringDecoder(serverVersion),
+		resp.BulkStringDecoder("proto"), resp.IntegerDecoder(proto),
+		resp.BulkStringDecoder("id"), resp.IntegerDecoder(int(client.id())),
+		resp.BulkStringDecoder("mode"), resp.BulkStringDecoder("standalone"),
+		resp.BulkStringDecoder("role"), resp.BulkStringDecoder(role),
+		resp.BulkStringDecoder("modules"), resp.ArrayDecoder(nil),
+	}), nil
+}
+
+// CLIENT ID | GETNAME | SETNAME connection-name
+func clientCommand(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) == 0 {
+		return wrongArgsError(request.Cmd)
+	}
+	client := request.Client
+	switch sub := strings.ToUpper(args[0]); sub {
+	case "ID", "GETNAME":
+		if len(args) != 1 {
+			return resp.ErrorDecoder("ERR wrong number of arguments for 'client|" + strings.ToLower(sub) + "' command"), ErrInvalidFormat
+		}
+		if sub == "ID" {
+			return resp.IntegerDecoder(int(client.id())), nil
+		}
+		if client.name == "" {
+			return []byte(resp.Nil), nil
+		}
+		return resp.BulkStringDecoder(client.name), nil
+	case "SETNAME":
+		if len(args) != 2 {
+			return resp.ErrorDecoder("ERR wrong number of arguments for 'client|setname' command"), ErrInvalidFormat
+		}
+		if !validClientName(args[1]) {
+			return clientNameError(), ErrInvalidFormat
+		}
+		client.name = args[1]
+		return resp.SimpleStringDecoder("OK"), nil
+	}
+	return resp.ErrorDecoder("ERR unknown subcommand '" + args[0] + "'. Try CLIENT HELP."), ErrInvalidFormat
+}
+
+// validClientName reports whether name only holds printable characters other than space,
+// an empty name clears it
+func validClientName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] <= ' ' || name[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func clientNameError() []byte {
+	return resp.ErrorDecoder("ERR Client names cannot contain spaces, newlines or special characters.")
+}
+
 // Configuration
 func config(request *Request) ([]byte, error) {
 	args := request.Cmd.Args
@@ -37,65 +152,112 @@ func config(request *Request) ([]byte, error) {
 		if len(args) == 1 {
 			return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
 		}
+		configMu.RLock()
+		defer configMu.RUnlock()
+		// parameters are matched case-insensitively, each one reported once
+		names := make([]string, 0, len(ConfigLookup))
+		for name := range ConfigLookup {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		seen := make(map[string]bool)
 		var arr []string
-		for _, arg := range args[1:] {
-			val, ok := ConfigLookup[arg]
-			if ok {
-				arr = append(arr, arg)
-				arr = append(arr, val)
+		for _, pattern := range args[1:] {
+			for _, name := range names {
+				if !seen[name] && utils.StringMatch(pattern, name, true) {
+					seen[name] = true
+					arr = append(arr, name, ConfigLookup[name])
+				}
 			}
 		}
-		return resp.ArrayDecoder(arr), nil
+		return request.Client.mapReply(arr), nil
+	}
+	if strings.ToUpper(args[0]) == "SET" {
+		return configSet(args[1:])
 	}
 
 	return []byte(resp.Nil), nil
 }
 
-// Blocking function
+// CONFIG SET parameter value [parameter value ...], only notify-keyspace-events can be set
+func configSet(args []string) ([]byte, error) {
+	if len(args) == 0 || len(args)%2 != 0 {
+		return resp.ErrorDecoder("ERR wrong number of arguments for 'config|set' command"), ErrInvalidFormat
+	}
+	for i := 0; i < len(args); i += 2 {
+		if strings.ToLower(args[i]) != "notify-keyspace-events" {
+			return resp.ErrorDecoder("ERR Unknown option or number of arguments for CONFIG SET - '" + args[i] + "'"), ErrInvalidFormat
+		}
+	}
+	configMu.Lock()
+	defer configMu.Unlock()
+	for i := 0; i < len(args); i += 2 {
+		if err := setKeyspaceEvents(args[i+1]); err != nil {
+			return resp.ErrorDecoder("ERR CONFIG SET failed (possibly related to argument '" + args[i] + "') - " + err.Error()), ErrInvalidFormat
+		}
+		if ConfigLookup == nil {
+			ConfigLookup = make(map[string]string)
+		}
+		ConfigLookup["notify-keyspace-events"] = formatKeyspaceEvents(int(keyspaceEvents.Load()))
+	}
+	return resp.SimpleStringDecoder("OK"), nil
+}
+
+// KEYS pattern walks the whole keyspace, SCAN iterates it without holding the lock for long
 func keys(request *Request) ([]byte, error) {
 	args := request.Cmd.Args
 	if len(args) != 1 {
 		return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
 	}
-	store := request.Serv.Db
-	dict := store.Dict
-	mu := store.Mu
-	mu.Lock()
-	defer mu.Unlock()
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
 	pattern := args[0]
+	allKeys := pattern == "*"
 	var matches []string
-	for key, _ := range *dict {
-		if (*dict)[key].Value() != nil {
-			match, err := filepath.Match(pattern, key)
-			if err != nil {
-				return resp.ErrorDecoder("ERR encoding"), ErrInvalidFormat
-			}
-			if match {
-				matches = append(matches, key)
-			}
+	for key := range *store.Dict {
+		if store.Lookup(key) != nil && (allKeys || utils.StringMatch(pattern, key, false)) {
+			matches = append(matches, key)
 		}
 	}
 	return resp.ArrayDecoder(matches), nil
 }
+
+// INFO [section], only the replication and stats sections exist
 func info(request *Request) ([]byte, error) {
 	args := request.Cmd.Args
-	if len(args) != 1 {
+	if len(args) > 1 {
 		return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
 	}
-	if strings.ToUpper(args[0]) == "REPLICATION" {
+	section := "default"
+	if len(args) == 1 {
+		section = strings.ToLower(args[0])
+	}
+	all := section == "default" || section == "all" || section == "everything"
+	var out string
+	if all || section == "replication" {
+		out += replicationInfo(request.Serv)
+	}
+	if all || section == "stats" {
+		out += "# Stats" + resp.CLRF
+		out += "expired_keys:" + strconv.FormatInt(expiredKeys.Load(), 10) + resp.CLRF
+	}
+	if out == "" {
+		return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
+	}
+	return request.Client.textReply(out), nil
+}
 
-		out := "#REPLICATION" + resp.CLRF
-		if request.Serv.Role == Master {
-			out += "role:master" + resp.CLRF
-			out += "master_replid:" + request.Serv.ReplicationId + resp.CLRF
-			out += "master_repl_offset:" + strconv.Itoa(request.Serv.Offset) + resp.CLRF
-			return resp.BulkStringDecoder(out), nil
-		} else if request.Serv.Role == Slave {
-			out += "role:slave" + resp.CLRF
-			return resp.BulkStringDecoder(out), nil
-		}
+func replicationInfo(serv *Server) string {
+	out := "#REPLICATION" + resp.CLRF
+	if serv.Role == Master {
+		out += "role:master" + resp.CLRF
+		out += "master_replid:" + serv.ReplicationId + resp.CLRF
+		out += "master_repl_offset:" + strconv.Itoa(replicationOffset(serv)) + resp.CLRF
+	} else if serv.Role == Slave {
+		out += "role:slave" + resp.CLRF
 	}
-	return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
+	return out
 }
 
 func replconf(request *Request) ([]byte, error) {
@@ -106,7 +268,7 @@ func replconf(request *Request) ([]byte, error) {
 	switch strings.ToUpper(request.Cmd.Args[0]) {
 	case "GETACK":
 		out := []string{
-			"REPLCONF", "ACK", strconv.Itoa(request.Serv.Offset),
+			"REPLCONF", "ACK", strconv.Itoa(replicationOffset(request.Serv)),
 		}
 		return resp.ArrayDecoder(out), nil
 	case "ACK":
@@ -137,6 +299,11 @@ func psync(request *Request) ([]byte, error) {
 		Ready:    make(chan struct{}),
 	}
 	replicaById[replica.Node.ReplicationId] = &replica
+	replicationMu.Lock()
+	// the new replica starts in database 0, the stream selects another one before its next command
+	if request.Serv.replicationDb != 0 {
+		request.Serv.replicationDb = -1
+	}
 	if request.Serv.ConnectedReplica == nil {
 		request.Serv.ConnectedReplica = &[]*Replica{
 			&replica,
@@ -144,7 +311,9 @@ func psync(request *Request) ([]byte, error) {
 	} else {
 		*request.Serv.ConnectedReplica = append(*request.Serv.ConnectedReplica, &replica)
 	}
-	out := "FULLRESYNC" + " " + request.Serv.ReplicationId + " " + strconv.Itoa(request.Serv.Offset)
+	offset := request.Serv.Offset
+	replicationMu.Unlock()
+	out := "FULLRESYNC" + " " + request.Serv.ReplicationId + " " + strconv.Itoa(offset)
 	writer.Write(resp.SimpleStringDecoder(out))
 	writer.Flush()
 	go sendBgServerReplication(request)
@@ -166,6 +335,7 @@ func wait(request *Request) ([]byte, error) {
 	if request.Serv.ConnectedReplica == nil {
 		return resp.IntegerDecoder(0), nil
 	}
+	defer request.parkGate()()
 	cmd := Command{
 		Name:           "REPLCONF",
 		Args:           []string{"GETACK", "*"},
@@ -215,6 +385,3 @@ func wait(request *Request) ([]byte, error) {
 	}
 	return resp.IntegerDecoder(noOfAckedReplica), nil
 }
-func selectIndex(request *Request) ([]byte, error) {
-	return resp.SimpleStringDecoder("OK"), nil
-}
@@ -0,0 +1,499 @@
+package server
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/engine"
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// set commands
+
+// lookupSet returns the set stored at key, ok is false when the key does not exist
+func lookupSet(store *engine.DbStore, key string) (engine.RedisSet, bool, error) {
+	obj := store.Lookup(key)
+	if obj == nil {
+		return engine.RedisSet{}, false, nil
+	}
+	set, isSet := obj.(engine.RedisSet)
+	if !isSet {
+		return engine.RedisSet{}, false, ErrWrongType
+	}
+	return set, true, nil
+}
+
+// setMembers returns the members of a set as a slice
+func setMembers(members map[string]struct{}) []string {
+	out := make([]string, 0, len(members))
+	for member := range members {
+		out = append(out, member)
+	}
+	return out
+}
+
+// randomMembers picks count distinct members uniformly, all of them in random order when
+// count is larger than the set
+func randomMembers(members map[string]struct{}, count int) []string {
+	out := setMembers(members)
+	count = min(count, len(out))
+	// partial Fisher-Yates shuffle, map iteration order is far from uniform
+	for i := 0; i < count; i++ {
+		j := i + rand.Intn(len(out)-i)
+		out[i], out[j] = out[j], out[i]
+	}
+	return out[:count]
+}
+
+func sadd(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	key := args[0]
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	set, ok, err := lookupSet(store, key)
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok {
+		set = engine.NewRedisSet(make(map[string]struct{}))
+		(*store.Dict)[key] = set
+	}
+	added := 0
+	for _, member := range args[1:] {
+		if set.Add(member) {
+			added++
+		}
+	}
+	if added > 0 {
+		store.Touch(key)
+		request.notify(notifySet, "sadd", key)
+	}
+	return resp.IntegerDecoder(added), nil
+}
+
+func srem(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	key := args[0]
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	set, ok, err := lookupSet(store, key)
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok {
+		return resp.IntegerDecoder(0), nil
+	}
+	removed := 0
+	for _, member := range args[1:] {
+		if set.Remove(member) {
+			removed++
+		}
+	}
+	if removed > 0 {
+		store.Touch(key)
+		request.notify(notifySet, "srem", key)
+	}
+	if len(set.Data) == 0 {
+		delete(*store.Dict, key)
+		request.notify(notifyGeneric, "del", key)
+	}
+	return resp.IntegerDecoder(removed), nil
+}
+
+func smembers(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 1 {
+		return wrongArgsError(request.Cmd)
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	set, found, err := lookupSet(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !found {
+		request.keyMiss(args[0])
+	}
+	return request.Client.setReply(setMembers(set.Data)), nil
+}
+
+func sismember(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	set, found, err := lookupSet(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !found {
+		request.keyMiss(args[0])
+	}
+	if _, ok := set.Data[args[1]]; ok {
+		return resp.IntegerDecoder(1), nil
+	}
+	return resp.IntegerDecoder(0), nil
+}
+
+func smismember(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	set, found, err := lookupSet(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !found {
+		request.keyMiss(args[0])
+	}
+	out := make([]int, 0, len(args)-1)
+	for _, member := range args[1:] {
+		if _, ok := set.Data[member]; ok {
+			out = append(out, 1)
+		} else {
+			out = append(out, 0)
+		}
+	}
+	return resp.IntegerArrayDecoder(out), nil
+}
+
+func scard(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 1 {
+		return wrongArgsError(request.Cmd)
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	set, found, err := lookupSet(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !found {
+		request.keyMiss(args[0])
+	}
+	return resp.IntegerDecoder(len(set.Data)), nil
+}
+
+// SMOVE source destination member
+func smove(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 3 {
+		return wrongArgsError(request.Cmd)
+	}
+	src, dst, member := args[0], args[1], args[2]
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	srcSet, ok, err := lookupSet(store, src)
+	if err != nil {
+		return wrongTypeError()
+	}
+	dstSet, dstOk, err := lookupSet(store, dst)
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok {
+		return resp.IntegerDecoder(0), nil
+	}
+	if _, exists := srcSet.Data[member]; !exists {
+		return resp.IntegerDecoder(0), nil
+	}
+	if src == dst {
+		return resp.IntegerDecoder(1), nil
+	}
+	srcSet.Remove(member)
+	request.notify(notifySet, "srem", src)
+	if len(srcSet.Data) == 0 {
+		delete(*store.Dict, src)
+		request.notify(notifyGeneric, "del", src)
+	}
+	if !dstOk {
+		dstSet = engine.NewRedisSet(make(map[string]struct{}))
+		(*store.Dict)[dst] = dstSet
+	}
+	if dstSet.Add(member) {
+		request.notify(notifySet, "sadd", dst)
+	}
+	store.Touch(src)
+	store.Touch(dst)
+	return resp.IntegerDecoder(1), nil
+}
+
+// SPOP key [count]
+// popped members are propagated as SREM since the choice is random
+func spop(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 1 && len(args) != 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	key := args[0]
+	count := 1
+	withCount := len(args) == 2
+	if withCount {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			return resp.ErrorDecoder("ERR value is out of range, must be positive"), ErrInvalidFormat
+		}
+		count = n
+	}
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	set, ok, err := lookupSet(store, key)
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok {
+		if withCount {
+			return resp.ArrayDecoder(nil), nil
+		}
+		return []byte(resp.Nil), nil
+	}
+	popped := randomMembers(set.Data, count)
+	for _, member := range popped {
+		set.Remove(member)
+	}
+	if len(popped) > 0 {
+		store.Touch(key)
+		request.notify(notifySet, "spop", key)
+		request.alsoPropagate("SREM", append([]string{key}, popped...)...)
+	}
+	if len(set.Data) == 0 {
+		delete(*store.Dict, key)
+		request.notify(notifyGeneric, "del", key)
+	}
+	if withCount {
+		return resp.ArrayDecoder(popped), nil
+	}
+	return resp.BulkStringDecoder(popped[0]), nil
+}
+
+// SRANDMEMBER key [count]
+// a negative count may return the same member multiple times
+func srandmember(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 1 && len(args) != 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	count := 1
+	withCount := len(args) == 2
+	if withCount {
+		n, err := strconv.Atoi(args[1])
+		if err != nil {
+			return resp.ErrorDecoder(NotIntegerErr), ErrInvalidFormat
+		}
+		count = n
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	set, ok, err := lookupSet(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok {
+		request.keyMiss(args[0])
+		if withCount {
+			return resp.ArrayDecoder(nil), nil
+		}
+		return []byte(resp.Nil), nil
+	}
+	var picked []string
+	if count >= 0 {
+		picked = randomMembers(set.Data, count)
+	} else {
+		members := setMembers(set.Data)
+		for i := 0; i < -count; i++ {
+			picked = append(picked, members[rand.Intn(len(members))])
+		}
+	}
+	if !withCount {
+		return resp.BulkStringDecoder(picked[0]), nil
+	}
+	return resp.ArrayDecoder(picked), nil
+}
+
+// set algebra
+
+const (
+	setInter = iota
+	setUnion
+	setDiff
+)
+
+// combineSets computes the intersection, union or difference of the sets stored at keys,
+// missing keys are treated as empty sets
+func combineSets(request *Request, store *engine.DbStore, keys []string, op int) (map[string]struct{}, error) {
+	sets := make([]map[string]struct{}, 0, len(keys))
+	for _, key := range keys {
+		set, ok, err := lookupSet(store, key)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			request.keyMiss(key)
+		}
+		sets = append(sets, set.Data)
+	}
+	result := make(map[string]struct{})
+	switch op {
+	case setInter:
+		for member := range sets[0] {
+			inAll := true
+			for _, other := range sets[1:] {
+				if _, ok := other[member]; !ok {
+					inAll = false
+					break
+				}
+			}
+			if inAll {
+				result[member] = struct{}{}
+			}
+		}
+	case setUnion:
+		for _, set := range sets {
+			for member := range set {
+				result[member] = struct{}{}
+			}
+		}
+	case setDiff:
+		for member := range sets[0] {
+			inOther := false
+			for _, other := range sets[1:] {
+				if _, ok := other[member]; ok {
+					inOther = true
+					break
+				}
+			}
+			if !inOther {
+				result[member] = struct{}{}
+			}
+		}
+	}
+	return result, nil
+}
+
+func sinter(request *Request) ([]byte, error) {
+	return setOperation(request, setInter)
+}
+func sunion(request *Request) ([]byte, error) {
+	return setOperation(request, setUnion)
+}
+func sdiff(request *Request) ([]byte, error) {
+	return setOperation(request, setDiff)
+}
+
+func setOperation(request *Request, op int) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 1 {
+		return wrongArgsError(request.Cmd)
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	result, err := combineSets(request, store, args, op)
+	if err != nil {
+		return wrongTypeError()
+	}
+	return request.Client.setReply(setMembers(result)), nil
+}
+
+func sinterstore(request *Request) ([]byte, error) {
+	return setOperationStore(request, setInter)
+}
+func sunionstore(request *Request) ([]byte, error) {
+	return setOperationStore(request, setUnion)
+}
+func sdiffstore(request *Request) ([]byte, error) {
+	return setOperationStore(request, setDiff)
+}
+
+// setOperationStore implements the *STORE variants, destination is overwritten whatever its type
+func setOperationStore(request *Request, op int) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	dst := args[0]
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	result, err := combineSets(request, store, args[1:], op)
+	if err != nil {
+		return wrongTypeError()
+	}
+	if len(result) == 0 {
+		if store.Lookup(dst) != nil {
+			request.notify(notifyGeneric, "del", dst)
+		}
+		delete(*store.Dict, dst)
+	} else {
+		(*store.Dict)[dst] = engine.NewRedisSet(result)
+		request.notify(notifySet, strings.ToLower(request.Cmd.Name), dst)
+	}
+	store.Touch(dst)
+	return resp.IntegerDecoder(len(result)), nil
+}
+
+// SINTERCARD numkeys key [key ...] [LIMIT limit]
+func sintercard(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	numKeys, err := strconv.Atoi(args[0])
+	if err != nil {
+		return resp.ErrorDecoder(NotIntegerErr), ErrInvalidFormat
+	}
+	if numKeys <= 0 {
+		return resp.ErrorDecoder("ERR numkeys should be greater than 0"), ErrInvalidFormat
+	}
+	if numKeys > len(args)-1 {
+		return resp.ErrorDecoder("ERR Number of keys can't be greater than number of args"), ErrInvalidFormat
+	}
+	keys := args[1 : 1+numKeys]
+	limit := 0
+	rest := args[1+numKeys:]
+	for i := 0; i < len(rest); i++ {
+		if strings.ToUpper(rest[i]) != "LIMIT" || i+1 >= len(rest) {
+			return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
+		}
+		limit, err = strconv.Atoi(rest[i+1])
+		if err != nil {
+			return resp.ErrorDecoder(NotIntegerErr), ErrInvalidFormat
+		}
+		if limit < 0 {
+			return resp.ErrorDecoder("ERR LIMIT can't be negative"), ErrInvalidFormat
+		}
+		i++
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	result, err := combineSets(request, store, keys, setInter)
+	if err != nil {
+		return wrongTypeError()
+	}
+	if limit > 0 && len(result) > limit {
+		return resp.IntegerDecoder(limit), nil
+	}
+	return resp.IntegerDecoder(len(result)), nil
+}
@@ -0,0 +1,613 @@
+package server
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/engine"
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// stream commands
+
+const (
+	trimNone = iota
+	trimMaxLen
+	trimMinID
+)
+
+const (
+	InvalidStreamIDErr  = "ERR Invalid stream ID specified as stream command argument"
+	StreamIDTooSmallErr = "ERR The ID specified in XADD is equal or smaller than the target stream top item"
+	StreamIDZeroErr     = "ERR The ID specified in XADD must be greater than 0-0"
+)
+
+// approximate trimming evicts at most this many entries unless LIMIT says otherwise
+const defaultTrimLimit = 100 * engine.StreamNodeMaxEntries
+
+// lookupStream returns the stream stored at key, ok is false when the key does not exist
+func lookupStream(store *engine.DbStore, key string) (engine.RedisStream, bool, error) {
+	obj := store.Lookup(key)
+	if obj == nil {
+		return engine.RedisStream{}, false, nil
+	}
+	stream, isStream := obj.(engine.RedisStream)
+	if !isStream {
+		return engine.RedisStream{}, false, ErrWrongType
+	}
+	return stream, true, nil
+}
+
+// parseStreamID parses <ms>-<seq> or <ms>, missingSeq is used as the sequence of the latter.
+// - and + stand for the smallest and greatest IDs unless strict is set.
+func parseStreamID(arg string, missingSeq uint64, strict bool) (engine.StreamID, error) {
+	if !strict {
+		switch arg {
+		case "-":
+			return engine.StreamID{}, nil
+		case "+":
+			return engine.MaxStreamID, nil
+		}
+	}
+	msPart, seqPart, hasSeq := strings.Cut(arg, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return engine.StreamID{}, ErrInvalidFormat
+	}
+	seq := missingSeq
+	if hasSeq {
+		seq, err = strconv.ParseUint(seqPart, 10, 64)
+		if err != nil {
+			return engine.StreamID{}, ErrInvalidFormat
+		}
+	}
+	return engine.StreamID{Ms: ms, Seq: seq}, nil
+}
+
+// parseRangeID parses a bound of XRANGE, a leading ( makes the bound exclusive
+func parseRangeID(arg string, missingSeq uint64) (engine.StreamID, bool, error) {
+	if len(arg) > 1 && arg[0] == '(' {
+		id, err := parseStreamID(arg[1:], missingSeq, true)
+		return id, true, err
+	}
+	id, err := parseStreamID(arg, missingSeq, false)
+	return id, false, err
+}
+
+// nextStreamID returns the ID of an XADD using * or <ms>-*
+func nextStreamID(last engine.StreamID, ms uint64, autoMs bool) (engine.StreamID, bool) {
+	if autoMs {
+		ms = uint64(time.Now().UnixMilli())
+		if ms <= last.Ms {
+			return last.Incr()
+		}
+		return engine.StreamID{Ms: ms}, true
+	}
+	switch {
+	case ms > last.Ms:
+		return engine.StreamID{Ms: ms}, true
+	case ms == last.Ms && last.Seq < math.MaxUint64:
+		return engine.StreamID{Ms: ms, Seq: last.Seq + 1}, true
+	}
+	return engine.StreamID{}, false
+}
+
+func streamEntryReply(entry engine.StreamEntry) []byte {
+	return resp.RawArrayDecoder([][]byte{
+		resp.BulkStringDecoder(entry.ID.String()),
+		resp.ArrayDecoder(entry.Fields),
+	})
+}
+
+func streamEntriesReply(entries []engine.StreamEntry) []byte {
+	out := make([][]byte, 0, len(entries))
+	for _, entry := range entries {
+		out = append(out, streamEntryReply(entry))
+	}
+	return resp.RawArrayDecoder(out)
+}
+
+// streamTrim holds the MAXLEN | MINID [= | ~] threshold [LIMIT count] arguments of XADD and XTRIM
+type streamTrim struct {
+	strategy  int
+	approx    bool
+	maxLen    int
+	minID     engine.StreamID
+	limit     int
+	limitSet  bool
+	threshold string
+}
+
+// parseOption parses the trimming option at args[i], it returns the index of its last argument
+func (t *streamTrim) parseOption(args []string, i int) (int, []byte) {
+	switch strings.ToUpper(args[i]) {
+	case "LIMIT":
+		if i+1 >= len(args) {
+			return i, resp.ErrorDecoder("ERR syntax error")
+		}
+		limit, err := strconv.Atoi(args[i+1])
+		if err != nil {
+			return i, resp.ErrorDecoder(NotIntegerErr)
+		}
+		if limit < 0 {
+			return i, resp.ErrorDecoder("ERR The LIMIT argument must be >= 0.")
+		}
+		t.limit = limit
+		t.limitSet = true
+		return i + 1, nil
+	case "MAXLEN", "MINID":
+	default:
+		return i, resp.ErrorDecoder("ERR syntax error")
+	}
+	strategy := trimMaxLen
+	if strings.ToUpper(args[i]) == "MINID" {
+		strategy = trimMinID
+	}
+	if t.strategy != trimNone && t.strategy != strategy {
+		return i, resp.ErrorDecoder("ERR syntax error, MAXLEN and MINID options at the same time are not compatible")
+	}
+	t.strategy = strategy
+	i++
+	if i < len(args) && (args[i] == "=" || args[i] == "~") {
+		t.approx = args[i] == "~"
+		i++
+	}
+	if i >= len(args) {
+		return i, resp.ErrorDecoder("ERR syntax error")
+	}
+	t.threshold = args[i]
+	if strategy == trimMaxLen {
+		maxLen, err := strconv.Atoi(args[i])
+		if err != nil {
+			return i, resp.ErrorDecoder(NotIntegerErr)
+		}
+		if maxLen < 0 {
+			return i, resp.ErrorDecoder("ERR The MAXLEN argument must be >= 0.")
+		}
+		t.maxLen = maxLen
+		return i, nil
+	}
+	minID, err := parseStreamID(args[i], 0, true)
+	if err != nil {
+		return i, resp.ErrorDecoder(InvalidStreamIDErr)
+	}
+	t.minID = minID
+	return i, nil
+}
+
+// validate checks the combination of parsed options
+func (t *streamTrim) validate() []byte {
+	if t.limitSet && !t.approx {
+		return resp.ErrorDecoder("ERR syntax error, LIMIT cannot be used without the special ~ option")
+	}
+	if !t.limitSet {
+		t.limit = defaultTrimLimit
+	}
+	if !t.approx {
+		t.limit = 0
+	}
+	return nil
+}
+
+// apply trims the stream and returns the number of evicted entries
+func (t *streamTrim) apply(stream *engine.Stream) int {
+	switch t.strategy {
+	case trimMaxLen:
+		return stream.TrimMaxLen(t.maxLen, t.approx, t.limit)
+	case trimMinID:
+		return stream.TrimMinID(t.minID, t.approx, t.limit)
+	}
+	return 0
+}
+
+// propagateArgs returns the exact trimming arguments that reproduce the trim on replicas,
+// approximate trims are rewritten to the length or first ID they ended at
+func (t *streamTrim) propagateArgs(stream *engine.Stream) []string {
+	threshold := t.threshold
+	switch {
+	case t.strategy == trimMaxLen:
+		if t.approx {
+			threshold = strconv.Itoa(stream.Len())
+		}
+		return []string{"MAXLEN", "=", threshold}
+	case t.strategy == trimMinID:
+		if t.approx {
+			first, ok := stream.First()
+			if !ok {
+				first.ID = stream.LastID
+			}
+			threshold = first.ID.String()
+		}
+		return []string{"MINID", "=", threshold}
+	}
+	return nil
+}
+
+// XADD key [NOMKSTREAM] [MAXLEN | MINID [= | ~] threshold [LIMIT count]] * | id field value [field value ...]
+// The entry is propagated with its final ID and an exact trim so replicas end up identical.
+func xadd(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 4 {
+		return wrongArgsError(request.Cmd)
+	}
+	key := args[0]
+	var trim streamTrim
+	noMkStream := false
+	i := 1
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NOMKSTREAM":
+			noMkStream = true
+			continue
+		case "MAXLEN", "MINID", "LIMIT":
+			last, errOut := trim.parseOption(args, i)
+			if errOut != nil {
+				return errOut, ErrInvalidFormat
+			}
+			i = last
+			continue
+		}
+		break
+	}
+	if errOut := trim.validate(); errOut != nil {
+		return errOut, ErrInvalidFormat
+	}
+	if i >= len(args) || len(args[i+1:]) == 0 || len(args[i+1:])%2 != 0 {
+		return wrongArgsError(request.Cmd)
+	}
+	fields := args[i+1:]
+
+	// the ID is either *, <ms>-* or an explicit <ms>-<seq>
+	autoMs := args[i] == "*"
+	msArg, autoSeq := strings.CutSuffix(args[i], "-*")
+	var id engine.StreamID
+	var err error
+	switch {
+	case autoMs:
+		autoSeq = true
+	case autoSeq:
+		id.Ms, err = strconv.ParseUint(msArg, 10, 64)
+	default:
+		id, err = parseStreamID(args[i], 0, true)
+		if err == nil && id.IsZero() {
+			return resp.ErrorDecoder(StreamIDZeroErr), ErrInvalidFormat
+		}
+	}
+	if err != nil {
+		return resp.ErrorDecoder(InvalidStreamIDErr), ErrInvalidFormat
+	}
+
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	stream, ok, err := lookupStream(store, key)
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok {
+		if noMkStream {
+			return []byte(resp.Nil), nil
+		}
+		stream = engine.RedisStream{Data: engine.NewStream()}
+	}
+	last := stream.Data.LastID
+	if autoSeq {
+		var valid bool
+		id, valid = nextStreamID(last, id.Ms, autoMs)
+		if !valid && autoMs {
+			return resp.ErrorDecoder("ERR The stream has exhausted the last possible ID, unable to add more items"), ErrInvalidFormat
+		}
+		if !valid {
+			return resp.ErrorDecoder(StreamIDTooSmallErr), ErrInvalidFormat
+		}
+	} else if !last.Less(id) {
+		return resp.ErrorDecoder(StreamIDTooSmallErr), ErrInvalidFormat
+	}
+
+	stream.Data.Append(id, append([]string(nil), fields...))
+	(*store.Dict)[key] = stream
+	evicted := trim.apply(stream.Data)
+	store.Touch(key)
+	request.notify(notifyStream, "xadd", key)
+	if evicted > 0 {
+		request.notify(notifyStream, "xtrim", key)
+	}
+
+	propagated := []string{key}
+	propagated = append(propagated, trim.propagateArgs(stream.Data)...)
+	propagated = append(propagated, id.String())
+	request.alsoPropagate("XADD", append(propagated, fields...)...)
+	request.signalStreamReady(store, key)
+	return resp.BulkStringDecoder(id.String()), nil
+}
+
+// XLEN key
+func xlen(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 1 {
+		return wrongArgsError(request.Cmd)
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	stream, ok, err := lookupStream(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok {
+		request.keyMiss(args[0])
+		return resp.IntegerDecoder(0), nil
+	}
+	return resp.IntegerDecoder(stream.Data.Len()), nil
+}
+
+func xrange(request *Request) ([]byte, error) {
+	return streamRange(request, false)
+}
+func xrevrange(request *Request) ([]byte, error) {
+	return streamRange(request, true)
+}
+
+// streamRange implements XRANGE key start end [COUNT count] and XREVRANGE key end start [COUNT count]
+func streamRange(request *Request, rev bool) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 3 && len(args) != 5 {
+		return wrongArgsError(request.Cmd)
+	}
+	startArg, endArg := args[1], args[2]
+	if rev {
+		startArg, endArg = endArg, startArg
+	}
+	start, startEx, err := parseRangeID(startArg, 0)
+	if err != nil {
+		return resp.ErrorDecoder(InvalidStreamIDErr), ErrInvalidFormat
+	}
+	end, endEx, err := parseRangeID(endArg, math.MaxUint64)
+	if err != nil {
+		return resp.ErrorDecoder(InvalidStreamIDErr), ErrInvalidFormat
+	}
+	if startEx {
+		var ok bool
+		if start, ok = start.Incr(); !ok {
+			return resp.ErrorDecoder("ERR invalid start ID for the interval"), ErrInvalidFormat
+		}
+	}
+	if endEx {
+		var ok bool
+		if end, ok = end.Decr(); !ok {
+			return resp.ErrorDecoder("ERR invalid end ID for the interval"), ErrInvalidFormat
+		}
+	}
+	count := -1
+	if len(args) == 5 {
+		if strings.ToUpper(args[3]) != "COUNT" {
+			return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
+		}
+		count, err = strconv.Atoi(args[4])
+		if err != nil {
+			return resp.ErrorDecoder(NotIntegerErr), ErrInvalidFormat
+		}
+		if count < 0 {
+			count = 0
+		}
+	}
+
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	stream, ok, err := lookupStream(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok {
+		request.keyMiss(args[0])
+	}
+	if !ok || count == 0 {
+		return resp.ArrayDecoder(nil), nil
+	}
+	return streamEntriesReply(stream.Data.Range(start, end, count, rev)), nil
+}
+
+// XDEL key id [id ...]
+func xdel(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	ids := make([]engine.StreamID, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		id, err := parseStreamID(arg, 0, true)
+		if err != nil {
+			return resp.ErrorDecoder(InvalidStreamIDErr), ErrInvalidFormat
+		}
+		ids = append(ids, id)
+	}
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	stream, ok, err := lookupStream(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok {
+		return resp.IntegerDecoder(0), nil
+	}
+	deleted := 0
+	for _, id := range ids {
+		if stream.Data.Delete(id) {
+			deleted++
+		}
+	}
+	if deleted > 0 {
+		store.Touch(args[0])
+		request.notify(notifyStream, "xdel", args[0])
+	}
+	return resp.IntegerDecoder(deleted), nil
+}
+
+// XTRIM key MAXLEN | MINID [= | ~] threshold [LIMIT count]
+func xtrim(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 3 {
+		return wrongArgsError(request.Cmd)
+	}
+	var trim streamTrim
+	for i := 1; i < len(args); i++ {
+		last, errOut := trim.parseOption(args, i)
+		if errOut != nil {
+			return errOut, ErrInvalidFormat
+		}
+		i = last
+	}
+	if trim.strategy == trimNone {
+		return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
+	}
+	if errOut := trim.validate(); errOut != nil {
+		return errOut, ErrInvalidFormat
+	}
+	key := args[0]
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	stream, ok, err := lookupStream(store, key)
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok {
+		return resp.IntegerDecoder(0), nil
+	}
+	evicted := trim.apply(stream.Data)
+	if evicted > 0 {
+		store.Touch(key)
+		request.notify(notifyStream, "xtrim", key)
+		request.alsoPropagate("XTRIM", append([]string{key}, trim.propagateArgs(stream.Data)...)...)
+	}
+	return resp.IntegerDecoder(evicted), nil
+}
+
+// streamRead holds the arguments shared by XREAD and XREADGROUP
+type streamRead struct {
+	count   int
+	noAck   bool
+	timeout time.Duration
+	keys    []string
+	ids     []string
+}
+
+// parseStreamRead parses [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...],
+// NOACK being only accepted by XREADGROUP. timeout is negative when BLOCK is not given.
+func parseStreamRead(cmd *Command, args []string, group bool) (streamRead, []byte) {
+	read := streamRead{timeout: -1}
+	i := 0
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "COUNT":
+			if i+1 >= len(args) {
+				return read, resp.ErrorDecoder("ERR syntax error")
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				return read, resp.ErrorDecoder(NotIntegerErr)
+			}
+			read.count = max(n, 0)
+			i++
+			continue
+		case "BLOCK":
+			if i+1 >= len(args) {
+				return read, resp.ErrorDecoder("ERR syntax error")
+			}
+			timeout, err := parseTimeoutMillis(args[i+1])
+			if err != nil {
+				return read, resp.ErrorDecoder(err.Error())
+			}
+			read.timeout = timeout
+			i++
+			continue
+		case "NOACK":
+			if group {
+				read.noAck = true
+				continue
+			}
+			return read, resp.ErrorDecoder("ERR syntax error")
+		case "STREAMS":
+		default:
+			return read, resp.ErrorDecoder("ERR syntax error")
+		}
+		break
+	}
+	streams := args[min(i+1, len(args)):]
+	if i >= len(args) || len(streams) == 0 || len(streams)%2 != 0 {
+		return read, resp.ErrorDecoder("ERR Unbalanced '" + strings.ToLower(cmd.Name) + "' list of streams: for each stream key an ID or '$' must be specified.")
+	}
+	read.keys, read.ids = streams[:len(streams)/2], streams[len(streams)/2:]
+	return read, nil
+}
+
+// XREAD [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+// $ reads the entries added after the call, it is resolved before blocking.
+func xread(request *Request) ([]byte, error) {
+	read, errOut := parseStreamRead(request.Cmd, request.Cmd.Args, false)
+	if errOut != nil {
+		return errOut, ErrInvalidFormat
+	}
+	ids := make([]engine.StreamID, len(read.keys))
+	last := make([]bool, len(read.keys))
+	for n, arg := range read.ids {
+		if arg == "$" {
+			last[n] = true
+			continue
+		}
+		id, err := parseStreamID(arg, 0, true)
+		if err != nil {
+			return resp.ErrorDecoder(InvalidStreamIDErr), ErrInvalidFormat
+		}
+		ids[n] = id
+	}
+
+	store := request.db()
+	store.Mu.Lock()
+	for n, key := range read.keys {
+		stream, ok, err := lookupStream(store, key)
+		if err != nil {
+			store.Mu.Unlock()
+			return wrongTypeError()
+		}
+		if last[n] && ok {
+			ids[n] = stream.Data.LastID
+		}
+	}
+	store.Mu.Unlock()
+
+	var errType error
+	out, ok := waitForStreams(request, store, read.keys, read.timeout, func() ([]byte, bool) {
+		var replies [][]byte
+		for n, key := range read.keys {
+			stream, ok, err := lookupStream(store, key)
+			if err != nil {
+				errType = ErrWrongType
+				return resp.ErrorDecoder(WrongTypeErr), true
+			}
+			if !ok {
+				continue
+			}
+			start, ok := ids[n].Incr()
+			if !ok {
+				continue
+			}
+			entries := stream.Data.Range(start, engine.MaxStreamID, read.count, false)
+			if len(entries) > 0 {
+				replies = append(replies, streamKeyReply(key, streamEntriesReply(entries)))
+			}
+		}
+		if len(replies) == 0 {
+			return nil, false
+		}
+		return resp.RawArrayDecoder(replies), true
+	})
+	if !ok {
+		return []byte(resp.NilArray), nil
+	}
+	return out, errType
+}
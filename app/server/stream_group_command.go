@@ -0,0 +1,807 @@
+package server
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/engine"
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// stream consumer group commands
+
+const XGroupKeyErr = "ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically."
+
+func noGroupError(key string, group string) []byte {
+	return resp.ErrorDecoder("NOGROUP No such key '" + key + "' or consumer group '" + group + "'")
+}
+
+func noSuchGroupError(key string, group string) []byte {
+	return resp.ErrorDecoder("NOGROUP No such consumer group '" + group + "' for key name '" + key + "'")
+}
+
+// lookupGroup returns the stream at key and its group, errOut is set when either does not exist
+func lookupGroup(store *engine.DbStore, key string, name string) (*engine.Stream, *engine.StreamGroup, []byte) {
+	stream, ok, err := lookupStream(store, key)
+	if err != nil {
+		return nil, nil, resp.ErrorDecoder(WrongTypeErr)
+	}
+	if !ok || stream.Data.Group(name) == nil {
+		return nil, nil, noGroupError(key, name)
+	}
+	return stream.Data, stream.Data.Group(name), nil
+}
+
+// propagateClaim replicates the state of a NACK as an XCLAIM forcing the same owner, time and count
+func propagateClaim(request *Request, key string, group *engine.StreamGroup, id engine.StreamID, nack *engine.StreamNACK) {
+	request.alsoPropagate("XCLAIM", key, group.Name, nack.Consumer.Name, "0", id.String(),
+		"TIME", strconv.FormatInt(nack.DeliveryTime.UnixMilli(), 10),
+		"RETRYCOUNT", strconv.FormatUint(nack.DeliveryCount, 10),
+		"FORCE", "JUSTID", "LASTID", group.LastID.String())
+}
+
+// parseGroupID parses the last delivered ID of XGROUP CREATE and SETID, $ is the last ID of the stream
+func parseGroupID(arg string, stream *engine.Stream) (engine.StreamID, bool, error) {
+	if arg == "$" {
+		if stream == nil {
+			return engine.StreamID{}, true, nil
+		}
+		return stream.LastID, true, nil
+	}
+	id, err := parseStreamID(arg, 0, true)
+	return id, false, err
+}
+
+// parseEntriesRead parses the optional ENTRIESREAD entries-read of XGROUP CREATE and SETID
+func parseEntriesRead(args []string) (int64, bool, []byte) {
+	if len(args) == 0 {
+		return engine.InvalidEntriesRead, false, nil
+	}
+	if len(args) != 2 || strings.ToUpper(args[0]) != "ENTRIESREAD" {
+		return 0, false, resp.ErrorDecoder("ERR syntax error")
+	}
+	n, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return 0, false, resp.ErrorDecoder(NotIntegerErr)
+	}
+	if n < 0 && n != engine.InvalidEntriesRead {
+		return 0, false, resp.ErrorDecoder("ERR value for ENTRIESREAD must be positive or -1")
+	}
+	return n, true, nil
+}
+
+// XGROUP CREATE key group id | $ [MKSTREAM] [ENTRIESREAD entries-read]
+// XGROUP SETID key group id | $ [ENTRIESREAD entries-read]
+// XGROUP DESTROY key group
+// XGROUP CREATECONSUMER key group consumer
+// XGROUP DELCONSUMER key group consumer
+func xgroup(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 3 {
+		return wrongArgsError(request.Cmd)
+	}
+	sub := strings.ToUpper(args[0])
+	key, name := args[1], args[2]
+	switch sub {
+	case "CREATE", "SETID":
+		if len(args) < 4 {
+			return wrongArgsError(request.Cmd)
+		}
+	case "DESTROY":
+		if len(args) != 3 {
+			return wrongArgsError(request.Cmd)
+		}
+	case "CREATECONSUMER", "DELCONSUMER":
+		if len(args) != 4 {
+			return wrongArgsError(request.Cmd)
+		}
+	default:
+		return resp.ErrorDecoder("ERR unknown subcommand '" + args[0] + "'. Try XGROUP HELP."), ErrInvalidFormat
+	}
+	options := args[min(len(args), 4):]
+	mkStream := sub == "CREATE" && len(options) > 0 && strings.ToUpper(options[0]) == "MKSTREAM"
+	if mkStream {
+		options = options[1:]
+	}
+	var entriesRead int64
+	var entriesReadSet bool
+	if sub == "CREATE" || sub == "SETID" {
+		var errOut []byte
+		entriesRead, entriesReadSet, errOut = parseEntriesRead(options)
+		if errOut != nil {
+			return errOut, ErrInvalidFormat
+		}
+	}
+
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	stream, ok, err := lookupStream(store, key)
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok {
+		if !mkStream {
+			return resp.ErrorDecoder(XGroupKeyErr), ErrInvalidFormat
+		}
+		stream = engine.RedisStream{Data: engine.NewStream()}
+	}
+	s := stream.Data
+	switch sub {
+	case "CREATE":
+		id, last, err := parseGroupID(args[3], s)
+		if err != nil {
+			return resp.ErrorDecoder(InvalidStreamIDErr), ErrInvalidFormat
+		}
+		if last && !entriesReadSet {
+			entriesRead = int64(s.EntriesAdded)
+		}
+		if _, created := s.CreateGroup(name, id, entriesRead); !created {
+			return resp.ErrorDecoder("BUSYGROUP Consumer Group name already exists"), ErrInvalidFormat
+		}
+		(*store.Dict)[key] = stream
+		store.Touch(key)
+		request.notify(notifyStream, "xgroup-create", key)
+		return resp.SimpleStringDecoder("OK"), nil
+	case "SETID":
+		group := s.Group(name)
+		if group == nil {
+			return noSuchGroupError(key, name), ErrInvalidFormat
+		}
+		id, last, err := parseGroupID(args[3], s)
+		if err != nil {
+			return resp.ErrorDecoder(InvalidStreamIDErr), ErrInvalidFormat
+		}
+		if last && !entriesReadSet {
+			entriesRead = int64(s.EntriesAdded)
+		}
+		group.LastID = id
+		group.EntriesRead = entriesRead
+		store.Touch(key)
+		request.notify(notifyStream, "xgroup-setid", key)
+		return resp.SimpleStringDecoder("OK"), nil
+	case "DESTROY":
+		if s.DestroyGroup(name) {
+			store.Touch(key)
+			request.notify(notifyStream, "xgroup-destroy", key)
+			// readers blocked on the group get the NOGROUP error
+			request.signalStreamReady(store, key)
+			return resp.IntegerDecoder(1), nil
+		}
+		return resp.IntegerDecoder(0), nil
+	}
+	group := s.Group(name)
+	if group == nil {
+		return noSuchGroupError(key, name), ErrInvalidFormat
+	}
+	if sub == "CREATECONSUMER" {
+		if _, created := group.Consumer(args[3], true); created {
+			store.Touch(key)
+			request.notify(notifyStream, "xgroup-createconsumer", key)
+			return resp.IntegerDecoder(1), nil
+		}
+		return resp.IntegerDecoder(0), nil
+	}
+	pending, deleted := group.DeleteConsumer(args[3])
+	store.Touch(key)
+	if deleted {
+		request.notify(notifyStream, "xgroup-delconsumer", key)
+	}
+	return resp.IntegerDecoder(pending), nil
+}
+
+// XREADGROUP GROUP group consumer [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]
+// > reads entries never delivered to the group, any other ID reads the PEL of the consumer.
+// Only > reads block, the history of a consumer is returned even when empty.
+// Deliveries are propagated as XCLAIMs so replicas hold the same PEL.
+func xreadgroup(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 6 || strings.ToUpper(args[0]) != "GROUP" {
+		return wrongArgsError(request.Cmd)
+	}
+	groupName, consumerName := args[1], args[2]
+	read, errOut := parseStreamRead(request.Cmd, args[3:], true)
+	if errOut != nil {
+		return errOut, ErrInvalidFormat
+	}
+	ids := make([]engine.StreamID, len(read.ids))
+	for n, arg := range read.ids {
+		if arg == ">" {
+			continue
+		}
+		if arg == "$" {
+			return resp.ErrorDecoder("ERR The $ ID is meaningless in the context of XREADGROUP: you want to read the history of this consumer by specifying a proper ID, or use the > ID to get new messages. The $ ID would just return an empty result set."), ErrInvalidFormat
+		}
+		id, err := parseStreamID(arg, 0, true)
+		if err != nil {
+			return resp.ErrorDecoder(InvalidStreamIDErr), ErrInvalidFormat
+		}
+		ids[n] = id
+	}
+
+	store := request.db()
+	var errType error
+	out, ok := waitForStreams(request, store, read.keys, read.timeout, func() ([]byte, bool) {
+		streams := make([]*engine.Stream, len(read.keys))
+		for n, key := range read.keys {
+			stream, ok, err := lookupStream(store, key)
+			if err != nil {
+				errType = ErrWrongType
+				return resp.ErrorDecoder(WrongTypeErr), true
+			}
+			if !ok || stream.Data.Group(groupName) == nil {
+				errType = ErrInvalidFormat
+				return resp.ErrorDecoder("NOGROUP No such key '" + key + "' or consumer group '" + groupName + "' in XREADGROUP with GROUP option"), true
+			}
+			streams[n] = stream.Data
+		}
+		return readGroup(request, read, streams, groupName, consumerName, ids)
+	})
+	if !ok {
+		return []byte(resp.NilArray), nil
+	}
+	return out, errType
+}
+
+// readGroup delivers the entries of streams to the consumer, ok is false when nothing was read
+func readGroup(request *Request, read streamRead, streams []*engine.Stream, groupName string, consumerName string, ids []engine.StreamID) ([]byte, bool) {
+	now := time.Now()
+	var replies [][]byte
+	for n, key := range read.keys {
+		s := streams[n]
+		group := s.Group(groupName)
+		consumer, created := group.Consumer(consumerName, true)
+		if created {
+			request.notify(notifyStream, "xgroup-createconsumer", key)
+			request.alsoPropagate("XGROUP", "CREATECONSUMER", key, groupName, consumerName)
+		}
+		consumer.SeenTime = now
+		if read.ids[n] != ">" {
+			replies = append(replies, streamKeyReply(key, readConsumerHistory(request, key, s, group, consumer, ids[n], read.count)))
+			continue
+		}
+		start, ok := group.LastID.Incr()
+		if !ok {
+			continue
+		}
+		entries := s.Range(start, engine.MaxStreamID, read.count, false)
+		if len(entries) == 0 {
+			continue
+		}
+		consumer.ActiveTime = now
+		for _, entry := range entries {
+			s.Advance(group, entry.ID)
+			if read.noAck {
+				continue
+			}
+			nack := group.Assign(entry.ID, consumer)
+			nack.DeliveryTime = now
+			nack.DeliveryCount = 1
+			propagateClaim(request, key, group, entry.ID, nack)
+		}
+		if read.noAck {
+			request.alsoPropagate("XGROUP", "SETID", key, groupName, group.LastID.String(),
+				"ENTRIESREAD", strconv.FormatInt(group.EntriesRead, 10))
+		}
+		replies = append(replies, streamKeyReply(key, streamEntriesReply(entries)))
+	}
+	if len(replies) == 0 {
+		return nil, false
+	}
+	return resp.RawArrayDecoder(replies), true
+}
+
+// readConsumerHistory returns the pending entries of consumer after id,
+// entries deleted from the stream are returned with nil fields
+func readConsumerHistory(request *Request, key string, s *engine.Stream, group *engine.StreamGroup, consumer *engine.StreamConsumer, id engine.StreamID, count int) []byte {
+	start, ok := id.Incr()
+	if !ok {
+		return resp.ArrayDecoder(nil)
+	}
+	pending := engine.PendingIDs(consumer.Pending, start, engine.MaxStreamID)
+	if count > 0 && len(pending) > count {
+		pending = pending[:count]
+	}
+	out := make([][]byte, 0, len(pending))
+	for _, pendingID := range pending {
+		entry, ok := s.Entry(pendingID)
+		if !ok {
+			out = append(out, resp.RawArrayDecoder([][]byte{
+				resp.BulkStringDecoder(pendingID.String()),
+				[]byte(resp.NilArray),
+			}))
+			continue
+		}
+		nack := consumer.Pending[pendingID]
+		nack.DeliveryTime = time.Now()
+		nack.DeliveryCount++
+		propagateClaim(request, key, group, pendingID, nack)
+		out = append(out, streamEntryReply(entry))
+	}
+	return resp.RawArrayDecoder(out)
+}
+
+func streamKeyReply(key string, entries []byte) []byte {
+	return resp.RawArrayDecoder([][]byte{resp.BulkStringDecoder(key), entries})
+}
+
+// XACK key group id [id ...]
+func xack(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 3 {
+		return wrongArgsError(request.Cmd)
+	}
+	ids := make([]engine.StreamID, 0, len(args)-2)
+	for _, arg := range args[2:] {
+		id, err := parseStreamID(arg, 0, true)
+		if err != nil {
+			return resp.ErrorDecoder(InvalidStreamIDErr), ErrInvalidFormat
+		}
+		ids = append(ids, id)
+	}
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	stream, ok, err := lookupStream(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok || stream.Data.Group(args[1]) == nil {
+		return resp.IntegerDecoder(0), nil
+	}
+	group := stream.Data.Group(args[1])
+	acked := 0
+	for _, id := range ids {
+		if group.Ack(id) {
+			acked++
+		}
+	}
+	return resp.IntegerDecoder(acked), nil
+}
+
+// XPENDING key group [[IDLE min-idle-time] start end count [consumer]]
+func xpending(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	key, name := args[0], args[1]
+	extended := args[2:]
+	var minIdle int64
+	if len(extended) > 0 && strings.ToUpper(extended[0]) == "IDLE" {
+		if len(extended) < 2 {
+			return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
+		}
+		n, err := strconv.ParseInt(extended[1], 10, 64)
+		if err != nil {
+			return resp.ErrorDecoder(NotIntegerErr), ErrInvalidFormat
+		}
+		minIdle = n
+		extended = extended[2:]
+		if len(extended) == 0 {
+			return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
+		}
+	}
+	if len(extended) != 0 && len(extended) != 3 && len(extended) != 4 {
+		return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
+	}
+	var start, end engine.StreamID
+	count := 0
+	if len(extended) > 0 {
+		var startEx, endEx bool
+		var err error
+		if start, startEx, err = parseRangeID(extended[0], 0); err != nil {
+			return resp.ErrorDecoder(InvalidStreamIDErr), ErrInvalidFormat
+		}
+		if end, endEx, err = parseRangeID(extended[1], math.MaxUint64); err != nil {
+			return resp.ErrorDecoder(InvalidStreamIDErr), ErrInvalidFormat
+		}
+		if count, err = strconv.Atoi(extended[2]); err != nil {
+			return resp.ErrorDecoder(NotIntegerErr), ErrInvalidFormat
+		}
+		var ok bool
+		if startEx {
+			if start, ok = start.Incr(); !ok {
+				return resp.ErrorDecoder("ERR invalid start ID for the interval"), ErrInvalidFormat
+			}
+		}
+		if endEx {
+			if end, ok = end.Decr(); !ok {
+				return resp.ErrorDecoder("ERR invalid end ID for the interval"), ErrInvalidFormat
+			}
+		}
+	}
+
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	_, group, errOut := lookupGroup(store, key, name)
+	if errOut != nil {
+		return errOut, ErrInvalidFormat
+	}
+
+	if len(extended) == 0 {
+		pending := engine.PendingIDs(group.Pending, engine.StreamID{}, engine.MaxStreamID)
+		if len(pending) == 0 {
+			return resp.RawArrayDecoder([][]byte{
+				resp.IntegerDecoder(0), []byte(resp.Nil), []byte(resp.Nil), []byte(resp.NilArray),
+			}), nil
+		}
+		var consumers [][]byte
+		for _, consumerName := range group.ConsumerNames() {
+			if n := len(group.Consumers[consumerName].Pending); n > 0 {
+				consumers = append(consumers, resp.ArrayDecoder([]string{consumerName, strconv.Itoa(n)}))
+			}
+		}
+		return resp.RawArrayDecoder([][]byte{
+			resp.IntegerDecoder(len(pending)),
+			resp.BulkStringDecoder(pending[0].String()),
+			resp.BulkStringDecoder(pending[len(pending)-1].String()),
+			resp.RawArrayDecoder(consumers),
+		}), nil
+	}
+
+	pel := group.Pending
+	if len(extended) == 4 {
+		consumer := group.Consumers[extended[3]]
+		if consumer == nil {
+			return resp.ArrayDecoder(nil), nil
+		}
+		pel = consumer.Pending
+	}
+	now := time.Now()
+	out := [][]byte{}
+	for _, id := range engine.PendingIDs(pel, start, end) {
+		if len(out) >= count {
+			break
+		}
+		nack := pel[id]
+		idle := now.Sub(nack.DeliveryTime).Milliseconds()
+		if idle < minIdle {
+			continue
+		}
+		out = append(out, resp.RawArrayDecoder([][]byte{
+			resp.BulkStringDecoder(id.String()),
+			resp.BulkStringDecoder(nack.Consumer.Name),
+			resp.IntegerDecoder(int(idle)),
+			resp.IntegerDecoder(int(nack.DeliveryCount)),
+		}))
+	}
+	return resp.RawArrayDecoder(out), nil
+}
+
+// claimEntry gives the pending entry id to consumer, it returns false when the entry
+// was deleted from the stream, in which case it is also removed from the PEL
+func claimEntry(request *Request, key string, s *engine.Stream, group *engine.StreamGroup, consumer *engine.StreamConsumer, id engine.StreamID) (engine.StreamEntry, *engine.StreamNACK, bool) {
+	entry, ok := s.Entry(id)
+	if !ok {
+		group.Ack(id)
+		request.alsoPropagate("XACK", key, group.Name, id.String())
+		return entry, nil, false
+	}
+	return entry, group.Assign(id, consumer), true
+}
+
+// XCLAIM key group consumer min-idle-time id [id ...] [IDLE ms] [TIME unix-time-milliseconds]
+// [RETRYCOUNT count] [FORCE] [JUSTID] [LASTID lastid]
+func xclaim(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 5 {
+		return wrongArgsError(request.Cmd)
+	}
+	key, name, consumerName := args[0], args[1], args[2]
+	minIdle, err := strconv.ParseInt(args[3], 10, 64)
+	if err != nil {
+		return resp.ErrorDecoder("ERR Invalid min-idle-time argument for XCLAIM"), ErrInvalidFormat
+	}
+	var ids []engine.StreamID
+	i := 4
+	for ; i < len(args); i++ {
+		id, err := parseStreamID(args[i], 0, true)
+		if err != nil {
+			break
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return resp.ErrorDecoder(InvalidStreamIDErr), ErrInvalidFormat
+	}
+	now := time.Now()
+	deliveryTime := now
+	retryCount := int64(-1)
+	force, justID := false, false
+	var lastID engine.StreamID
+	for ; i < len(args); i++ {
+		option := strings.ToUpper(args[i])
+		switch option {
+		case "FORCE":
+			force = true
+			continue
+		case "JUSTID":
+			justID = true
+			continue
+		case "IDLE", "TIME", "RETRYCOUNT", "LASTID":
+			if i+1 >= len(args) {
+				return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
+			}
+		default:
+			return resp.ErrorDecoder("ERR Unrecognized XCLAIM option '" + args[i] + "'"), ErrInvalidFormat
+		}
+		i++
+		if option == "LASTID" {
+			if lastID, err = parseStreamID(args[i], 0, true); err != nil {
+				return resp.ErrorDecoder(InvalidStreamIDErr), ErrInvalidFormat
+			}
+			continue
+		}
+		n, err := strconv.ParseInt(args[i], 10, 64)
+		if err != nil {
+			return resp.ErrorDecoder("ERR Invalid " + option + " option argument for XCLAIM"), ErrInvalidFormat
+		}
+		switch option {
+		case "IDLE":
+			deliveryTime = now.Add(-time.Duration(n) * time.Millisecond)
+		case "TIME":
+			deliveryTime = time.UnixMilli(n)
+		case "RETRYCOUNT":
+			retryCount = n
+		}
+	}
+	if deliveryTime.After(now) {
+		deliveryTime = now
+	}
+
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	s, group, errOut := lookupGroup(store, key, name)
+	if errOut != nil {
+		return errOut, ErrInvalidFormat
+	}
+	if group.LastID.Less(lastID) {
+		group.LastID = lastID
+	}
+	consumer, created := group.Consumer(consumerName, true)
+	if created {
+		request.notify(notifyStream, "xgroup-createconsumer", key)
+		request.alsoPropagate("XGROUP", "CREATECONSUMER", key, name, consumerName)
+	}
+	consumer.SeenTime = now
+	var out [][]byte
+	for _, id := range ids {
+		nack := group.Pending[id]
+		if nack == nil {
+			if _, exists := s.Entry(id); !force || !exists {
+				continue
+			}
+			nack = group.Assign(id, consumer)
+			nack.DeliveryTime = now
+			nack.DeliveryCount = 1
+		}
+		if minIdle > 0 && now.Sub(nack.DeliveryTime).Milliseconds() < minIdle {
+			continue
+		}
+		entry, nack, ok := claimEntry(request, key, s, group, consumer, id)
+		if !ok {
+			continue
+		}
+		nack.DeliveryTime = deliveryTime
+		if retryCount >= 0 {
+			nack.DeliveryCount = uint64(retryCount)
+		} else if !justID {
+			nack.DeliveryCount++
+		}
+		consumer.ActiveTime = now
+		propagateClaim(request, key, group, id, nack)
+		if justID {
+			out = append(out, resp.BulkStringDecoder(id.String()))
+		} else {
+			out = append(out, streamEntryReply(entry))
+		}
+	}
+	return resp.RawArrayDecoder(out), nil
+}
+
+// XAUTOCLAIM key group consumer min-idle-time start [COUNT count] [JUSTID]
+func xautoclaim(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 5 {
+		return wrongArgsError(request.Cmd)
+	}
+	key, name, consumerName := args[0], args[1], args[2]
+	minIdle, err := strconv.ParseInt(args[3], 10, 64)
+	if err != nil {
+		return resp.ErrorDecoder("ERR Invalid min-idle-time argument for XAUTOCLAIM"), ErrInvalidFormat
+	}
+	start, startEx, err := parseRangeID(args[4], 0)
+	if err != nil {
+		return resp.ErrorDecoder(InvalidStreamIDErr), ErrInvalidFormat
+	}
+	if startEx {
+		var ok bool
+		if start, ok = start.Incr(); !ok {
+			return resp.ErrorDecoder("ERR invalid start ID for the interval"), ErrInvalidFormat
+		}
+	}
+	count := 100
+	justID := false
+	for i := 5; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "JUSTID":
+			justID = true
+		case "COUNT":
+			if i+1 >= len(args) {
+				return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				return resp.ErrorDecoder(NotIntegerErr), ErrInvalidFormat
+			}
+			if n < 1 || n > math.MaxInt32/10 {
+				return resp.ErrorDecoder("ERR COUNT must be > 0"), ErrInvalidFormat
+			}
+			count = n
+			i++
+		default:
+			return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
+		}
+	}
+
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	s, group, errOut := lookupGroup(store, key, name)
+	if errOut != nil {
+		return errOut, ErrInvalidFormat
+	}
+	consumer, created := group.Consumer(consumerName, true)
+	if created {
+		request.notify(notifyStream, "xgroup-createconsumer", key)
+		request.alsoPropagate("XGROUP", "CREATECONSUMER", key, name, consumerName)
+	}
+	now := time.Now()
+	consumer.SeenTime = now
+
+	// scan at most count*10 pending entries looking for count idle ones
+	pending := engine.PendingIDs(group.Pending, start, engine.MaxStreamID)
+	attempts := count * 10
+	next := engine.StreamID{}
+	var claimed, deleted [][]byte
+	n := 0
+	for ; n < len(pending) && attempts > 0 && count > 0; n++ {
+		attempts--
+		id := pending[n]
+		nack := group.Pending[id]
+		if minIdle > 0 && now.Sub(nack.DeliveryTime).Milliseconds() < minIdle {
+			continue
+		}
+		entry, nack, ok := claimEntry(request, key, s, group, consumer, id)
+		if !ok {
+			deleted = append(deleted, resp.BulkStringDecoder(id.String()))
+			continue
+		}
+		nack.DeliveryTime = now
+		if !justID {
+			nack.DeliveryCount++
+		}
+		consumer.ActiveTime = now
+		propagateClaim(request, key, group, id, nack)
+		if justID {
+			claimed = append(claimed, resp.BulkStringDecoder(id.String()))
+		} else {
+			claimed = append(claimed, streamEntryReply(entry))
+		}
+		count--
+	}
+	if n < len(pending) {
+		next = pending[n]
+	}
+	return resp.RawArrayDecoder([][]byte{
+		resp.BulkStringDecoder(next.String()),
+		resp.RawArrayDecoder(claimed),
+		resp.RawArrayDecoder(deleted),
+	}), nil
+}
+
+// XINFO STREAM key
+// XINFO GROUPS key
+// XINFO CONSUMERS key group
+func xinfo(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	sub := strings.ToUpper(args[0])
+	switch sub {
+	case "STREAM", "GROUPS":
+		if len(args) != 2 {
+			return wrongArgsError(request.Cmd)
+		}
+	case "CONSUMERS":
+		if len(args) != 3 {
+			return wrongArgsError(request.Cmd)
+		}
+	default:
+		return resp.ErrorDecoder("ERR unknown subcommand '" + args[0] + "'. Try XINFO HELP."), ErrInvalidFormat
+	}
+	key := args[1]
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	stream, ok, err := lookupStream(store, key)
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok {
+		return resp.ErrorDecoder("ERR no such key"), ErrInvalidFormat
+	}
+	s := stream.Data
+	now := time.Now()
+	switch sub {
+	case "STREAM":
+		first, hasFirst := s.First()
+		last, hasLast := s.Last()
+		firstReply, lastReply := []byte(resp.Nil), []byte(resp.Nil)
+		if hasFirst {
+			firstReply = streamEntryReply(first)
+		}
+		if hasLast {
+			lastReply = streamEntryReply(last)
+		}
+		return request.Client.rawMapReply([][]byte{
+			resp.BulkStringDecoder("length"), resp.IntegerDecoder(s.Len()),
+			resp.BulkStringDecoder("radix-tree-keys"), resp.IntegerDecoder(s.Nodes()),
+			resp.BulkStringDecoder("radix-tree-nodes"), resp.IntegerDecoder(s.Nodes()),
+			resp.BulkStringDecoder("last-generated-id"), resp.BulkStringDecoder(s.LastID.String()),
+			resp.BulkStringDecoder("max-deleted-entry-id"), resp.BulkStringDecoder(s.MaxDeletedID.String()),
+			resp.BulkStringDecoder("entries-added"), resp.IntegerDecoder(int(s.EntriesAdded)),
+			resp.BulkStringDecoder("recorded-first-entry-id"), resp.BulkStringDecoder(first.ID.String()),
+			resp.BulkStringDecoder("groups"), resp.IntegerDecoder(len(s.Groups)),
+			resp.BulkStringDecoder("first-entry"), firstReply,
+			resp.BulkStringDecoder("last-entry"), lastReply,
+		}), nil
+	case "GROUPS":
+		out := make([][]byte, 0, len(s.Groups))
+		for _, name := range s.GroupNames() {
+			group := s.Group(name)
+			entriesRead := []byte(resp.Nil)
+			if group.EntriesRead != engine.InvalidEntriesRead {
+				entriesRead = resp.IntegerDecoder(int(group.EntriesRead))
+			}
+			lag := []byte(resp.Nil)
+			if n, ok := s.Lag(group); ok {
+				lag = resp.IntegerDecoder(int(n))
+			}
+			out = append(out, request.Client.rawMapReply([][]byte{
+				resp.BulkStringDecoder("name"), resp.BulkStringDecoder(name),
+				resp.BulkStringDecoder("consumers"), resp.IntegerDecoder(len(group.Consumers)),
+				resp.BulkStringDecoder("pending"), resp.IntegerDecoder(len(group.Pending)),
+				resp.BulkStringDecoder("last-delivered-id"), resp.BulkStringDecoder(group.LastID.String()),
+				resp.BulkStringDecoder("entries-read"), entriesRead,
+				resp.BulkStringDecoder("lag"), lag,
+			}))
+		}
+		return resp.RawArrayDecoder(out), nil
+	}
+	group := s.Group(args[2])
+	if group == nil {
+		return noSuchGroupError(key, args[2]), ErrInvalidFormat
+	}
+	out := make([][]byte, 0, len(group.Consumers))
+	for _, name := range group.ConsumerNames() {
+		consumer := group.Consumers[name]
+		inactive := -1
+		if !consumer.ActiveTime.IsZero() {
+			inactive = int(now.Sub(consumer.ActiveTime).Milliseconds())
+		}
+		out = append(out, request.Client.rawMapReply([][]byte{
+			resp.BulkStringDecoder("name"), resp.BulkStringDecoder(name),
+			resp.BulkStringDecoder("pending"), resp.IntegerDecoder(len(consumer.Pending)),
+			resp.BulkStringDecoder("idle"), resp.IntegerDecoder(int(now.Sub(consumer.SeenTime).Milliseconds())),
+			resp.BulkStringDecoder("inactive"), resp.IntegerDecoder(inactive),
+		}))
+	}
+	return resp.RawArrayDecoder(out), nil
+}
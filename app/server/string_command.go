@@ -1,6 +1,7 @@
 package server
 
 import (
+	"math"
 	"strconv"
 	"strings"
 	"time"
@@ -10,8 +11,33 @@ import (
 )
 
 var expirationOptions = map[string]time.Duration{
-	"PX": time.Millisecond,
-	"EX": time.Second,
+	"PX":   time.Millisecond,
+	"EX":   time.Second,
+	"PXAT": time.Millisecond,
+	"EXAT": time.Second,
+}
+
+const (
+	InvalidSetExpireErr = "ERR invalid expire time in 'set' command"
+	StringTooLongErr    = "ERR string exceeds maximum allowed size (proto-max-bulk-len)"
+)
+
+// parseSetExpiration converts the argument of an EX, PX, EXAT or PXAT option to a deadline,
+// which must be positive
+func parseSetExpiration(option string, arg string) (time.Time, []byte) {
+	n, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return time.Time{}, resp.ErrorDecoder("ERR invalid " + option + " time")
+	}
+	unit := expirationOptions[option]
+	absolute := strings.HasSuffix(option, "AT")
+	if n <= 0 || n > math.MaxInt64/int64(unit) {
+		return time.Time{}, resp.ErrorDecoder(InvalidSetExpireErr)
+	}
+	if absolute {
+		return time.UnixMilli(n * int64(unit/time.Millisecond)), nil
+	}
+	return time.Now().Add(time.Duration(n) * unit), nil
 }
 
 // string command
@@ -19,6 +45,7 @@ var expirationOptions = map[string]time.Duration{
 // [NX | XX]
 // [GET]
 // [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | KEEPTTL]
+// SET is propagated with an absolute PXAT deadline, and only when the key was written
 func set(request *Request) ([]byte, error) {
 	args := request.Cmd.Args
 	if len(args) < 2 {
@@ -28,33 +55,35 @@ func set(request *Request) ([]byte, error) {
 	key := args[0]
 	value := args[1]
 
-	var ttl time.Duration
 	var expiration time.Time
+	var condition string
+	var expireOption string
 	var returnOldValue bool
 
-	// Parse optional flags
+	// Parse optional flags, NX / XX and the expiration options exclude each other
 	for i := 2; i < len(args); i++ {
 		arg := strings.ToUpper(args[i])
 		switch arg {
-		case "EX":
-			if i+1 >= len(args) {
+		case "NX", "XX":
+			if condition != "" && condition != arg {
 				return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
 			}
-			seconds, err := strconv.Atoi(args[i+1])
-			if err != nil {
-				return resp.ErrorDecoder("ERR invalid EX time"), ErrInvalidFormat
+			condition = arg
+		case "KEEPTTL":
+			if expireOption != "" && expireOption != arg {
+				return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
 			}
-			ttl = time.Second * time.Duration(seconds)
-			i++
-		case "PX":
-			if i+1 >= len(args) {
+			expireOption = arg
+		case "EX", "PX", "EXAT", "PXAT":
+			if expireOption != "" || i+1 >= len(args) {
 				return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
 			}
-			ms, err := strconv.Atoi(args[i+1])
-			if err != nil {
-				return resp.ErrorDecoder("ERR invalid PX time"), ErrInvalidFormat
+			expireOption = arg
+			var errOut []byte
+			expiration, errOut = parseSetExpiration(arg, args[i+1])
+			if errOut != nil {
+				return errOut, ErrInvalidFormat
 			}
-			ttl = time.Millisecond * time.Duration(ms)
 			i++
 		case "GET":
 			returnOldValue = true
@@ -63,36 +92,54 @@ func set(request *Request) ([]byte, error) {
 		}
 	}
 
-	if ttl > 0 {
-		expiration = time.Now().Add(ttl)
-	}
-
-	store := request.Serv.Db
+	store := request.db()
 	store.Mu.Lock()
 	defer store.Mu.Unlock()
 
-	// Retrieve old value if requested
-	var oldValue string
+	old := store.Lookup(key)
+	var reply []byte
 	if returnOldValue {
-		if val, ok := (*store.Dict)[key]; ok {
-			oldValue = val.Value().(string)
+		reply = []byte(resp.Nil)
+		if old != nil {
+			str, ok := old.(engine.RedisString)
+			if !ok {
+				return wrongTypeError()
+			}
+			reply = resp.BulkStringDecoder(str.String())
+		}
+	}
+	if (condition == "NX" && old != nil) || (condition == "XX" && old == nil) {
+		if returnOldValue {
+			return reply, nil
 		}
+		return []byte(resp.Nil), nil
+	}
+	if expireOption == "KEEPTTL" && old != nil {
+		expiration = old.GetExpiration()
 	}
 
 	// Set the new value
-	(*store.Dict)[key] = engine.RedisString{
-		Data:       value,
-		Expiration: expiration,
+	(*store.Dict)[key] = engine.NewRedisString(value, expiration)
+	store.Touch(key)
+	request.notify(notifyString, "set", key)
+
+	propagated := []string{key, value}
+	switch {
+	case expireOption == "KEEPTTL":
+		propagated = append(propagated, "KEEPTTL")
+	case !expiration.IsZero():
+		propagated = append(propagated, "PXAT", strconv.FormatInt(expiration.UnixMilli(), 10))
+		request.notify(notifyGeneric, "expire", key)
 	}
+	request.alsoPropagate("SET", propagated...)
 
 	if returnOldValue {
-		return resp.SimpleStringDecoder(oldValue), nil
+		return reply, nil
 	}
-
 	return resp.SimpleStringDecoder("OK"), nil
 }
 func get(request *Request) ([]byte, error) {
-	store := request.Serv.Db
+	store := request.db()
 	args := request.Cmd.Args
 	if len(args) != 1 {
 		return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
@@ -100,22 +147,565 @@ func get(request *Request) ([]byte, error) {
 	mu := store.Mu
 	mu.RLock()
 	defer mu.RUnlock()
-	dict := store.Dict
-	obj := (*dict)[args[0]]
+	obj := store.Lookup(args[0])
 	if obj == nil {
+		request.keyMiss(args[0])
 		return []byte(resp.Nil), nil
 	}
 	if strings.ToUpper(obj.Type()) != "STRING" {
 		return resp.ErrorDecoder("WRONGTYPE Operation against a key holding the wrong kind of value"), ErrInvalidFormat
 	}
-	x := obj.Value()
-	if x == nil {
-		return []byte(resp.Nil), nil
-	}
-	str := x.(string)
+	str := obj.(engine.RedisString).String()
 	if len(str) == 0 {
 		return resp.BulkStringDecoder(str), nil
 	}
 	return resp.SimpleStringDecoder(str), nil
 
 }
+
+// lookupString returns the string stored at key, ok is false when the key does not exist
+func lookupString(store *engine.DbStore, key string) (engine.RedisString, bool, error) {
+	obj := store.Lookup(key)
+	if obj == nil {
+		return engine.RedisString{}, false, nil
+	}
+	str, isString := obj.(engine.RedisString)
+	if !isString {
+		return engine.RedisString{}, false, ErrWrongType
+	}
+	return str, true, nil
+}
+
+// INCR key
+func incr(request *Request) ([]byte, error) {
+	if len(request.Cmd.Args) != 1 {
+		return wrongArgsError(request.Cmd)
+	}
+	return incrBy(request, 1)
+}
+
+// DECR key
+func decr(request *Request) ([]byte, error) {
+	if len(request.Cmd.Args) != 1 {
+		return wrongArgsError(request.Cmd)
+	}
+	return incrBy(request, -1)
+}
+
+// INCRBY key increment
+func incrby(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	n, ok := engine.ParseInt64(args[1])
+	if !ok {
+		return resp.ErrorDecoder(NotIntegerErr), ErrInvalidFormat
+	}
+	return incrBy(request, n)
+}
+
+// DECRBY key decrement
+func decrby(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	n, ok := engine.ParseInt64(args[1])
+	if !ok {
+		return resp.ErrorDecoder(NotIntegerErr), ErrInvalidFormat
+	}
+	if n == math.MinInt64 {
+		return resp.ErrorDecoder("ERR decrement would overflow"), ErrInvalidFormat
+	}
+	return incrBy(request, -n)
+}
+
+// incrBy adds n to the integer stored at key, a missing key counts as 0 and the TTL is kept
+func incrBy(request *Request, n int64) ([]byte, error) {
+	key := request.Cmd.Args[0]
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	str, ok, err := lookupString(store, key)
+	if err != nil {
+		return wrongTypeError()
+	}
+	var current int64
+	if ok {
+		if current, ok = str.Int64(); !ok {
+			return resp.ErrorDecoder(NotIntegerErr), ErrInvalidFormat
+		}
+	}
+	if (n > 0 && current > math.MaxInt64-n) || (n < 0 && current < math.MinInt64-n) {
+		return resp.ErrorDecoder("ERR increment or decrement would overflow"), ErrInvalidFormat
+	}
+	current += n
+	(*store.Dict)[key] = engine.RedisString{Int: current, IsInt: true, Expiration: str.Expiration}
+	store.Touch(key)
+	request.notify(notifyString, "incrby", key)
+	return resp.IntegerDecoder(int(current)), nil
+}
+
+// INCRBYFLOAT key increment
+// propagated as SET with the result and KEEPTTL so replicas don't redo float math
+func incrbyfloat(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	n, err := strconv.ParseFloat(args[1], 64)
+	if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+		return resp.ErrorDecoder("ERR value is not a valid float"), ErrInvalidFormat
+	}
+	key := args[0]
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	str, ok, err := lookupString(store, key)
+	if err != nil {
+		return wrongTypeError()
+	}
+	var current float64
+	if ok {
+		current, err = strconv.ParseFloat(str.String(), 64)
+		if err != nil || math.IsNaN(current) || math.IsInf(current, 0) {
+			return resp.ErrorDecoder("ERR value is not a valid float"), ErrInvalidFormat
+		}
+	}
+	current += n
+	if math.IsNaN(current) || math.IsInf(current, 0) {
+		return resp.ErrorDecoder("ERR increment would produce NaN or Infinity"), ErrInvalidFormat
+	}
+	value := strconv.FormatFloat(current, 'f', -1, 64)
+	(*store.Dict)[key] = engine.NewRedisString(value, str.Expiration)
+	store.Touch(key)
+	request.notify(notifyString, "incrbyfloat", key)
+	request.alsoPropagate("SET", key, value, "KEEPTTL")
+	return resp.BulkStringDecoder(value), nil
+}
+
+// APPEND key value
+func appendCommand(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	str, _, err := lookupString(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	value := str.String()
+	if len(value)+len(args[1]) > MaxBulkStringSize {
+		return resp.ErrorDecoder(StringTooLongErr), ErrInvalidFormat
+	}
+	value += args[1]
+	(*store.Dict)[args[0]] = engine.NewRedisString(value, str.Expiration)
+	store.Touch(args[0])
+	request.notify(notifyString, "append", args[0])
+	return resp.IntegerDecoder(len(value)), nil
+}
+
+// STRLEN key
+func strlen(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 1 {
+		return wrongArgsError(request.Cmd)
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	str, ok, err := lookupString(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok {
+		request.keyMiss(args[0])
+	}
+	return resp.IntegerDecoder(len(str.String())), nil
+}
+
+// GETRANGE key start end
+func getrange(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 3 {
+		return wrongArgsError(request.Cmd)
+	}
+	start, ok := engine.ParseInt64(args[1])
+	end, ok2 := engine.ParseInt64(args[2])
+	if !ok || !ok2 {
+		return resp.ErrorDecoder(NotIntegerErr), ErrInvalidFormat
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	str, ok, err := lookupString(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok {
+		request.keyMiss(args[0])
+	}
+	value := str.String()
+	n := int64(len(value))
+	if start < 0 && end < 0 && start > end {
+		return resp.BulkStringDecoder(""), nil
+	}
+	if start < 0 {
+		start = max(n+start, 0)
+	}
+	if end < 0 {
+		end = max(n+end, 0)
+	}
+	end = min(end, n-1)
+	if n == 0 || start > end {
+		return resp.BulkStringDecoder(""), nil
+	}
+	return resp.BulkStringDecoder(value[start : end+1]), nil
+}
+
+// SETRANGE key offset value, the string is padded with zero bytes up to offset
+func setrange(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 3 {
+		return wrongArgsError(request.Cmd)
+	}
+	offset, ok := engine.ParseInt64(args[1])
+	if !ok {
+		return resp.ErrorDecoder(NotIntegerErr), ErrInvalidFormat
+	}
+	if offset < 0 {
+		return resp.ErrorDecoder("ERR offset is out of range"), ErrInvalidFormat
+	}
+	patch := args[2]
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	str, _, err := lookupString(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	value := str.String()
+	if len(patch) == 0 {
+		return resp.IntegerDecoder(len(value)), nil
+	}
+	if offset+int64(len(patch)) > MaxBulkStringSize {
+		return resp.ErrorDecoder(StringTooLongErr), ErrInvalidFormat
+	}
+	buf := []byte(value)
+	if size := int(offset) + len(patch); size > len(buf) {
+		buf = append(buf, make([]byte, size-len(buf))...)
+	}
+	copy(buf[offset:], patch)
+	(*store.Dict)[args[0]] = engine.NewRedisString(string(buf), str.Expiration)
+	store.Touch(args[0])
+	request.notify(notifyString, "setrange", args[0])
+	return resp.IntegerDecoder(len(buf)), nil
+}
+
+// GETDEL key, propagated as DEL
+func getdel(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 1 {
+		return wrongArgsError(request.Cmd)
+	}
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	str, ok, err := lookupString(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok {
+		return []byte(resp.Nil), nil
+	}
+	delete(*store.Dict, args[0])
+	store.Touch(args[0])
+	request.notify(notifyGeneric, "del", args[0])
+	request.alsoPropagate("DEL", args[0])
+	return resp.BulkStringDecoder(str.String()), nil
+}
+
+// GETEX key [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | PERSIST]
+// propagated as PEXPIREAT or PERSIST
+func getex(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 1 {
+		return wrongArgsError(request.Cmd)
+	}
+	var expiration time.Time
+	option := ""
+	for i := 1; i < len(args); i++ {
+		arg := strings.ToUpper(args[i])
+		switch arg {
+		case "PERSIST":
+			if option != "" {
+				return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
+			}
+		case "EX", "PX", "EXAT", "PXAT":
+			if option != "" || i+1 >= len(args) {
+				return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
+			}
+			n, ok := engine.ParseInt64(args[i+1])
+			if !ok {
+				return resp.ErrorDecoder(NotIntegerErr), ErrInvalidFormat
+			}
+			unit := expirationOptions[arg]
+			if n <= 0 || n > math.MaxInt64/int64(unit) {
+				return resp.ErrorDecoder("ERR invalid expire time in 'getex' command"), ErrInvalidFormat
+			}
+			if strings.HasSuffix(arg, "AT") {
+				expiration = time.UnixMilli(n * int64(unit/time.Millisecond))
+			} else {
+				expiration = time.Now().Add(time.Duration(n) * unit)
+			}
+			i++
+		default:
+			return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
+		}
+		option = arg
+	}
+	key := args[0]
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	str, ok, err := lookupString(store, key)
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok {
+		return []byte(resp.Nil), nil
+	}
+	value := str.String()
+	if option != "" {
+		str.Expiration = expiration
+		(*store.Dict)[key] = str
+		store.Touch(key)
+		if expiration.IsZero() {
+			request.notify(notifyGeneric, "persist", key)
+			request.alsoPropagate("PERSIST", key)
+		} else {
+			request.notify(notifyGeneric, "expire", key)
+			request.alsoPropagate("PEXPIREAT", key, strconv.FormatInt(expiration.UnixMilli(), 10))
+		}
+	}
+	return resp.BulkStringDecoder(value), nil
+}
+
+// GETSET key value
+func getset(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	str, ok, err := lookupString(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	(*store.Dict)[args[0]] = engine.NewRedisString(args[1], time.Time{})
+	store.Touch(args[0])
+	request.notify(notifyString, "set", args[0])
+	if !ok {
+		return []byte(resp.Nil), nil
+	}
+	return resp.BulkStringDecoder(str.String()), nil
+}
+
+// LCS key1 key2 [LEN] [IDX] [MINMATCHLEN len] [WITHMATCHLEN]
+// IDX lists the matching ranges from the end of the strings, as redis does
+func lcs(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	var getLen, getIdx, withMatchLen bool
+	var minMatchLen int64
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "LEN":
+			getLen = true
+		case "IDX":
+			getIdx = true
+		case "WITHMATCHLEN":
+			withMatchLen = true
+		case "MINMATCHLEN":
+			if i+1 >= len(args) {
+				return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
+			}
+			n, ok := engine.ParseInt64(args[i+1])
+			if !ok {
+				return resp.ErrorDecoder(NotIntegerErr), ErrInvalidFormat
+			}
+			minMatchLen = max(n, 0)
+			i++
+		default:
+			return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
+		}
+	}
+	if getLen && getIdx {
+		return resp.ErrorDecoder("ERR If you want both the length and indexes, please just use IDX."), ErrInvalidFormat
+	}
+
+	store := request.db()
+	store.Mu.RLock()
+	strA, okA, errA := lookupString(store, args[0])
+	strB, okB, errB := lookupString(store, args[1])
+	if !okA && errA == nil {
+		request.keyMiss(args[0])
+	}
+	if !okB && errB == nil {
+		request.keyMiss(args[1])
+	}
+	store.Mu.RUnlock()
+	if errA != nil || errB != nil {
+		return resp.ErrorDecoder("ERR The specified keys must contain string values"), ErrInvalidFormat
+	}
+	a, b := strA.String(), strB.String()
+	if uint64(len(a)+1)*uint64(len(b)+1) > MaxBulkStringSize/4 {
+		return resp.ErrorDecoder("ERR Insufficient memory, transient memory for LCS exceeds proto-max-bulk-len"), ErrInvalidFormat
+	}
+
+	// dp[i][j] is the length of the LCS of a[:i] and b[:j]
+	width := len(b) + 1
+	dp := make([]uint32, (len(a)+1)*width)
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			if a[i-1] == b[j-1] {
+				dp[i*width+j] = dp[(i-1)*width+j-1] + 1
+			} else {
+				dp[i*width+j] = max(dp[(i-1)*width+j], dp[i*width+j-1])
+			}
+		}
+	}
+	length := int(dp[len(a)*width+len(b)])
+	if getLen {
+		return resp.IntegerDecoder(length), nil
+	}
+
+	// walk back from the end, collecting the common bytes and the ranges they form
+	common := make([]byte, length)
+	var matches [][]byte
+	idx := length
+	i, j := len(a), len(b)
+	aStart, aEnd, bStart, bEnd := -1, 0, 0, 0
+	for i > 0 && j > 0 {
+		emit := false
+		if a[i-1] == b[j-1] {
+			common[idx-1] = a[i-1]
+			if aStart == -1 {
+				aStart, aEnd, bStart, bEnd = i-1, i-1, j-1, j-1
+			} else if aStart == i && bStart == j {
+				aStart--
+				bStart--
+			} else {
+				emit = true
+			}
+			if aStart == 0 || bStart == 0 {
+				emit = true
+			}
+			idx--
+			i--
+			j--
+		} else {
+			if dp[(i-1)*width+j] > dp[i*width+j-1] {
+				i--
+			} else {
+				j--
+			}
+			emit = aStart != -1
+		}
+		if emit {
+			matchLen := aEnd - aStart + 1
+			if getIdx && (minMatchLen == 0 || int64(matchLen) >= minMatchLen) {
+				match := [][]byte{
+					resp.RawArrayDecoder([][]byte{resp.IntegerDecoder(aStart), resp.IntegerDecoder(aEnd)}),
+					resp.RawArrayDecoder([][]byte{resp.IntegerDecoder(bStart), resp.IntegerDecoder(bEnd)}),
+				}
+				if withMatchLen {
+					match = append(match, resp.IntegerDecoder(matchLen))
+				}
+				matches = append(matches, resp.RawArrayDecoder(match))
+			}
+			aStart = -1
+		}
+	}
+	if !getIdx {
+		return resp.BulkStringDecoder(string(common)), nil
+	}
+	return resp.RawArrayDecoder([][]byte{
+		resp.BulkStringDecoder("matches"),
+		resp.RawArrayDecoder(matches),
+		resp.BulkStringDecoder("len"),
+		resp.IntegerDecoder(length),
+	}), nil
+}
+
+// MGET key [key ...], keys that do not hold a string read as nil
+func mget(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 1 {
+		return wrongArgsError(request.Cmd)
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	replies := make([][]byte, len(args))
+	for i, key := range args {
+		str, ok, err := lookupString(store, key)
+		if !ok && err == nil {
+			request.keyMiss(key)
+		}
+		if err != nil || !ok {
+			replies[i] = []byte(resp.Nil)
+			continue
+		}
+		replies[i] = resp.BulkStringDecoder(str.String())
+	}
+	return resp.RawArrayDecoder(replies), nil
+}
+
+// MSET key value [key value ...]
+func mset(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 2 || len(args)%2 != 0 {
+		return wrongArgsError(request.Cmd)
+	}
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	setPairs(request, store, args)
+	return resp.SimpleStringDecoder("OK"), nil
+}
+
+// MSETNX key value [key value ...] sets nothing if any of the keys exists
+func msetnx(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 2 || len(args)%2 != 0 {
+		return wrongArgsError(request.Cmd)
+	}
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	for i := 0; i < len(args); i += 2 {
+		if store.Lookup(args[i]) != nil {
+			return resp.IntegerDecoder(0), nil
+		}
+	}
+	setPairs(request, store, args)
+	return resp.IntegerDecoder(1), nil
+}
+
+// setPairs stores every key value pair without TTL, the caller holds the store lock
+func setPairs(request *Request, store *engine.DbStore, pairs []string) {
+	for i := 0; i < len(pairs); i += 2 {
+		(*store.Dict)[pairs[i]] = engine.NewRedisString(pairs[i+1], time.Time{})
+		store.Touch(pairs[i])
+		request.notify(notifyString, "set", pairs[i])
+	}
+}
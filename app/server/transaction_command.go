@@ -0,0 +1,261 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/codecrafters-io/redis-starter-go/app/engine"
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// Transactions: MULTI, EXEC and DISCARD, with WATCH and UNWATCH.
+// Between MULTI and EXEC the commands of a client are queued instead of run. A command
+// that cannot be queued, unknown or with a wrong number of arguments, makes EXEC discard
+// the transaction. Errors raised while the queued commands run are part of the reply of
+// EXEC and do not stop the others.
+// EXEC is atomic through the exec gate: every command holds it shared while it runs and
+// EXEC holds it exclusively, so no other command runs between the queued ones. The commands
+// of the master of a replica hold it exclusively too, so that the lookups of clients still
+// hide the keys expired on the replica while those of the master find them, see
+// engine.DbStore.FromMaster. Blocking
+// commands release it while they are parked, and do not block at all inside EXEC.
+// WATCH makes the next EXEC fail with a nil reply when one of the watched keys was modified
+// or expired in the meantime, see engine.Watch.
+
+var execGate sync.RWMutex
+
+// lockGate takes the exec gate for the command of request and returns its unlock
+func (request *Request) lockGate() func() {
+	if request.Client.master {
+		execGate.Lock()
+		setFromMaster(request.Serv, true)
+		return func() {
+			setFromMaster(request.Serv, false)
+			execGate.Unlock()
+		}
+	}
+	if request.Cmd.Name == "EXEC" {
+		execGate.Lock()
+		return execGate.Unlock
+	}
+	execGate.RLock()
+	request.holdsGate = true
+	return func() {
+		request.holdsGate = false
+		execGate.RUnlock()
+	}
+}
+
+// parkGate releases the exec gate while the command is parked, the returned function
+// takes it back
+func (request *Request) parkGate() func() {
+	if !request.holdsGate {
+		return func() {}
+	}
+	execGate.RUnlock()
+	return execGate.RLock
+}
+
+// isTransactionControl reports whether name runs right away inside a transaction
+func isTransactionControl(name string) bool {
+	return name == "MULTI" || name == "EXEC" || name == "DISCARD" || name == "WATCH"
+}
+
+// checkArity reports whether cmd has as many arguments as its arity allows
+func checkArity(cmd *Command) bool {
+	n := len(cmd.Args) + 1
+	if cmd.Arity < 0 {
+		return n >= -cmd.Arity
+	}
+	return cmd.Arity == 0 || n == cmd.Arity
+}
+
+// queueCommand queues the command of request until EXEC, a command that cannot be
+// queued aborts the transaction
+func queueCommand(request *Request) ([]byte, error) {
+	client := request.Client
+	cmd := request.Cmd
+	if cmd.Handle == nil {
+		client.dirty = true
+		return resp.ErrorDecoder("ERR unknown command"), ErrInvalidFormat
+	}
+	if !checkArity(cmd) {
+		client.dirty = true
+		return wrongArgsError(cmd)
+	}
+	if isSubscriptionCommand(cmd.Name) {
+		client.dirty = true
+		return resp.ErrorDecoder("ERR Command not allowed inside a transaction"), ErrInvalidFormat
+	}
+	client.queued = append(client.queued, *cmd)
+	return resp.SimpleStringDecoder("QUEUED"), nil
+}
+
+// resetTransaction leaves the transaction of client and unwatches its keys
+func (client *Client) resetTransaction() {
+	client.multi = false
+	client.dirty = false
+	client.queued = nil
+	client.unwatchAll()
+}
+
+// watchedKey is a key watched by a client, live when it existed at WATCH time
+type watchedKey struct {
+	store *engine.DbStore
+	key   string
+	live  bool
+}
+
+// unwatchAll unregisters the keys watched by client
+func (client *Client) unwatchAll() {
+	for _, wk := range client.watched {
+		wk.store.Unwatch(wk.key, client.watch)
+	}
+	client.watch = nil
+	client.watched = nil
+}
+
+// watchFailed reports whether a watched key was modified since WATCH, or expired since
+func (client *Client) watchFailed() bool {
+	if client.watch == nil {
+		return false
+	}
+	if client.watch.Dirty() {
+		return true
+	}
+	for _, wk := range client.watched {
+		wk.store.Mu.RLock()
+		obj, exists := (*wk.store.Dict)[wk.key]
+		wk.store.Mu.RUnlock()
+		if wk.live && exists && obj.Value() == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// WATCH key [key ...]
+func watch(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 1 {
+		return wrongArgsError(request.Cmd)
+	}
+	client := request.Client
+	if client.multi {
+		return resp.ErrorDecoder("ERR WATCH inside MULTI is not allowed"), ErrInvalidFormat
+	}
+	if client.watch == nil {
+		client.watch = &engine.Watch{}
+	}
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	for _, key := range args {
+		if client.watching(store, key) {
+			continue
+		}
+		live := store.Lookup(key) != nil
+		// a key already expired is deleted before it is watched, its DEL is still propagated
+		if !live && !store.Replica && store.DeleteIfExpired(key) {
+			expiredKeys.Add(1)
+			request.notify(notifyExpired, "expired", key)
+		}
+		store.Watch(key, client.watch)
+		client.watched = append(client.watched, watchedKey{store, key, live})
+	}
+	return resp.SimpleStringDecoder("OK"), nil
+}
+
+func (client *Client) watching(store *engine.DbStore, key string) bool {
+	for _, wk := range client.watched {
+		if wk.store == store && wk.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// UNWATCH
+func unwatch(request *Request) ([]byte, error) {
+	if len(request.Cmd.Args) != 0 {
+		return wrongArgsError(request.Cmd)
+	}
+	request.Client.unwatchAll()
+	return resp.SimpleStringDecoder("OK"), nil
+}
+
+// MULTI
+func multi(request *Request) ([]byte, error) {
+	if len(request.Cmd.Args) != 0 {
+		return wrongArgsError(request.Cmd)
+	}
+	if request.Client.multi {
+		return resp.ErrorDecoder("ERR MULTI calls can not be nested"), ErrInvalidFormat
+	}
+	request.Client.multi = true
+	return resp.SimpleStringDecoder("OK"), nil
+}
+
+// DISCARD
+func discard(request *Request) ([]byte, error) {
+	if len(request.Cmd.Args) != 0 {
+		return wrongArgsError(request.Cmd)
+	}
+	if !request.Client.multi {
+		return resp.ErrorDecoder("ERR DISCARD without MULTI"), ErrInvalidFormat
+	}
+	request.Client.resetTransaction()
+	return resp.SimpleStringDecoder("OK"), nil
+}
+
+// EXEC runs the queued commands and replies with the array of their replies, or with a nil
+// array when a watched key was modified. Their propagation is sent to replicas wrapped in
+// MULTI / EXEC.
+func exec(request *Request) ([]byte, error) {
+	if len(request.Cmd.Args) != 0 {
+		return wrongArgsError(request.Cmd)
+	}
+	client := request.Client
+	if !client.multi {
+		return resp.ErrorDecoder("ERR EXEC without MULTI"), ErrInvalidFormat
+	}
+	queued, dirty, watchFailed := client.queued, client.dirty, client.watchFailed()
+	client.resetTransaction()
+	if dirty {
+		return resp.ErrorDecoder("EXECABORT Transaction discarded because of previous errors."), ErrInvalidFormat
+	}
+	if watchFailed {
+		return []byte(resp.NilArray), nil
+	}
+
+	replies := make([][]byte, 0, len(queued))
+	var propagated []Command
+	for i := range queued {
+		cmd := &queued[i]
+		sub := &Request{
+			Serv:   request.Serv,
+			Conn:   request.Conn,
+			Reader: request.Reader,
+			Writer: request.Writer,
+			Cmd:    cmd,
+			ConnId: request.ConnId,
+			Client: client,
+			inExec: true,
+		}
+		out, err := cmd.Handle(sub)
+		replies = append(replies, out)
+		if err != nil {
+			continue
+		}
+		if cmd.IsPropagatable {
+			propagated = append(propagated, Command{Name: cmd.Name, Args: cmd.Args, Db: client.DbIndex})
+		}
+		propagated = append(propagated, sub.AlsoPropagate...)
+		request.readyStreams = append(request.readyStreams, sub.readyStreams...)
+	}
+	if len(propagated) > 0 {
+		request.alsoPropagateTo(propagated[0].Db, "MULTI")
+		request.AlsoPropagate = append(request.AlsoPropagate, propagated...)
+		request.alsoPropagateTo(propagated[len(propagated)-1].Db, "EXEC")
+	}
+	return resp.RawArrayDecoder(replies), nil
+}
@@ -0,0 +1,823 @@
+package server
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/engine"
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// sorted set commands
+
+const (
+	zrangeByRank = iota
+	zrangeByScore
+	zrangeByLex
+)
+
+const (
+	NotFloatErr    = "ERR value is not a valid float"
+	MinMaxFloatErr = "ERR min or max is not a float"
+	MinMaxLexErr   = "ERR min or max not valid string range item"
+)
+
+// lookupZSet returns the sorted set stored at key, ok is false when the key does not exist
+func lookupZSet(store *engine.DbStore, key string) (engine.RedisZSet, bool, error) {
+	obj := store.Lookup(key)
+	if obj == nil {
+		return engine.RedisZSet{}, false, nil
+	}
+	zset, isZSet := obj.(engine.RedisZSet)
+	if !isZSet {
+		return engine.RedisZSet{}, false, ErrWrongType
+	}
+	return zset, true, nil
+}
+
+// parseScore parses a score, inf and -inf are accepted but NaN is not
+func parseScore(arg string) (float64, error) {
+	score, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, ErrInvalidFormat
+	}
+	return score, nil
+}
+
+func formatScore(score float64) string {
+	switch {
+	case math.IsInf(score, 1):
+		return "inf"
+	case math.IsInf(score, -1):
+		return "-inf"
+	case score == math.Trunc(score) && math.Abs(score) < 1e17:
+		return strconv.FormatFloat(score, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(score, 'g', -1, 64)
+}
+
+// parseScoreRange parses min and max of BYSCORE ranges, a leading ( makes the bound exclusive
+func parseScoreRange(min string, max string) (engine.ScoreRange, error) {
+	var r engine.ScoreRange
+	var err error
+	r.Min, r.MinEx, err = parseScoreBound(min)
+	if err != nil {
+		return r, err
+	}
+	r.Max, r.MaxEx, err = parseScoreBound(max)
+	return r, err
+}
+
+func parseScoreBound(arg string) (float64, bool, error) {
+	exclusive := strings.HasPrefix(arg, "(")
+	if exclusive {
+		arg = arg[1:]
+	}
+	score, err := parseScore(arg)
+	return score, exclusive, err
+}
+
+// parseLexRange parses min and max of BYLEX ranges: [member, (member, - or +.
+// empty is set for ranges that can't contain anything, like a + minimum
+func parseLexRange(min string, max string) (r engine.LexRange, empty bool, err error) {
+	var minKind, maxKind int
+	r.Min, r.MinEx, minKind, err = parseLexBound(min)
+	if err != nil {
+		return r, false, err
+	}
+	r.Max, r.MaxEx, maxKind, err = parseLexBound(max)
+	if err != nil {
+		return r, false, err
+	}
+	r.MinInf = minKind < 0
+	r.MaxInf = maxKind > 0
+	return r, minKind > 0 || maxKind < 0, nil
+}
+
+// parseLexBound returns kind -1 for -, 1 for + and 0 for a member bound
+func parseLexBound(arg string) (string, bool, int, error) {
+	switch {
+	case arg == "-":
+		return "", false, -1, nil
+	case arg == "+":
+		return "", false, 1, nil
+	case strings.HasPrefix(arg, "("):
+		return arg[1:], true, 0, nil
+	case strings.HasPrefix(arg, "["):
+		return arg[1:], false, 0, nil
+	}
+	return "", false, 0, ErrInvalidFormat
+}
+
+// ZADD key [NX | XX] [GT | LT] [CH] [INCR] score member [score member ...]
+func zadd(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 3 {
+		return wrongArgsError(request.Cmd)
+	}
+	key := args[0]
+	var nx, xx, gt, lt, ch, incr bool
+	i := 1
+options:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GT":
+			gt = true
+		case "LT":
+			lt = true
+		case "CH":
+			ch = true
+		case "INCR":
+			incr = true
+		default:
+			break options
+		}
+	}
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
+	}
+	if nx && xx {
+		return resp.ErrorDecoder("ERR XX and NX options at the same time are not compatible"), ErrInvalidFormat
+	}
+	if (gt && lt) || (nx && (gt || lt)) {
+		return resp.ErrorDecoder("ERR GT, LT, and/or NX options at the same time are not compatible"), ErrInvalidFormat
+	}
+	if incr && len(pairs) > 2 {
+		return resp.ErrorDecoder("ERR INCR option supports a single increment-element pair"), ErrInvalidFormat
+	}
+	scores := make([]float64, 0, len(pairs)/2)
+	for j := 0; j < len(pairs); j += 2 {
+		score, err := parseScore(pairs[j])
+		if err != nil {
+			return resp.ErrorDecoder(NotFloatErr), ErrInvalidFormat
+		}
+		scores = append(scores, score)
+	}
+
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	zset, ok, err := lookupZSet(store, key)
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok {
+		zset = engine.NewRedisZSet()
+	}
+
+	added, changed := 0, 0
+	aborted := false
+	var result float64
+	for j, score := range scores {
+		member := pairs[2*j+1]
+		old, exists := zset.Data[member]
+		if !exists {
+			if xx {
+				aborted = true
+				continue
+			}
+			zset.Add(member, score)
+			added++
+			result = score
+			continue
+		}
+		if nx {
+			aborted = true
+			continue
+		}
+		newScore := score
+		if incr {
+			newScore = old + score
+			if math.IsNaN(newScore) {
+				return resp.ErrorDecoder("ERR resulting score is not a number (NaN)"), ErrInvalidFormat
+			}
+		}
+		if (gt && newScore <= old) || (lt && newScore >= old) {
+			aborted = true
+			continue
+		}
+		if newScore != old {
+			zset.Add(member, newScore)
+			changed++
+		}
+		result = newScore
+	}
+	if zset.Len() > 0 {
+		(*store.Dict)[key] = zset
+	}
+	if added+changed > 0 {
+		store.Touch(key)
+		if incr {
+			request.notify(notifyZSet, "zincr", key)
+		} else {
+			request.notify(notifyZSet, "zadd", key)
+		}
+	}
+
+	if incr {
+		if aborted {
+			return []byte(resp.Nil), nil
+		}
+		return request.Client.doubleReply(result), nil
+	}
+	if ch {
+		return resp.IntegerDecoder(added + changed), nil
+	}
+	return resp.IntegerDecoder(added), nil
+}
+
+// ZINCRBY key increment member
+func zincrby(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 3 {
+		return wrongArgsError(request.Cmd)
+	}
+	key, member := args[0], args[2]
+	incr, err := parseScore(args[1])
+	if err != nil {
+		return resp.ErrorDecoder(NotFloatErr), ErrInvalidFormat
+	}
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	zset, ok, err := lookupZSet(store, key)
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok {
+		zset = engine.NewRedisZSet()
+	}
+	score := zset.Data[member] + incr
+	if math.IsNaN(score) {
+		return resp.ErrorDecoder("ERR resulting score is not a number (NaN)"), ErrInvalidFormat
+	}
+	zset.Add(member, score)
+	(*store.Dict)[key] = zset
+	store.Touch(key)
+	request.notify(notifyZSet, "zincr", key)
+	return request.Client.doubleReply(score), nil
+}
+
+func zrem(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	key := args[0]
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	zset, ok, err := lookupZSet(store, key)
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok {
+		return resp.IntegerDecoder(0), nil
+	}
+	removed := 0
+	for _, member := range args[1:] {
+		if zset.Remove(member) {
+			removed++
+		}
+	}
+	if removed > 0 {
+		store.Touch(key)
+		request.notify(notifyZSet, "zrem", key)
+	}
+	if zset.Len() == 0 {
+		delete(*store.Dict, key)
+		request.notify(notifyGeneric, "del", key)
+	}
+	return resp.IntegerDecoder(removed), nil
+}
+
+func zcard(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 1 {
+		return wrongArgsError(request.Cmd)
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	zset, ok, err := lookupZSet(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok {
+		request.keyMiss(args[0])
+		return resp.IntegerDecoder(0), nil
+	}
+	return resp.IntegerDecoder(zset.Len()), nil
+}
+
+func zscore(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	zset, found, err := lookupZSet(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !found {
+		request.keyMiss(args[0])
+	}
+	score, ok := zset.Data[args[1]]
+	if !ok {
+		return []byte(resp.Nil), nil
+	}
+	return request.Client.doubleReply(score), nil
+}
+
+func zmscore(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	zset, found, err := lookupZSet(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !found {
+		request.keyMiss(args[0])
+	}
+	out := make([][]byte, 0, len(args)-1)
+	for _, member := range args[1:] {
+		score, ok := zset.Data[member]
+		if !ok {
+			out = append(out, []byte(resp.Nil))
+			continue
+		}
+		out = append(out, request.Client.doubleReply(score))
+	}
+	return resp.RawArrayDecoder(out), nil
+}
+
+func zrank(request *Request) ([]byte, error) {
+	return rank(request, false)
+}
+func zrevrank(request *Request) ([]byte, error) {
+	return rank(request, true)
+}
+
+// rank implements ZRANK and ZREVRANK key member [WITHSCORE]
+func rank(request *Request, rev bool) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 2 && len(args) != 3 {
+		return wrongArgsError(request.Cmd)
+	}
+	withScore := len(args) == 3
+	if withScore && strings.ToUpper(args[2]) != "WITHSCORE" {
+		return resp.ErrorDecoder("ERR syntax error"), ErrInvalidFormat
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	zset, ok, err := lookupZSet(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok {
+		request.keyMiss(args[0])
+	}
+	var r int
+	if ok {
+		r, ok = zset.Rank(args[1])
+	}
+	if !ok {
+		if withScore {
+			return []byte(resp.NilArray), nil
+		}
+		return []byte(resp.Nil), nil
+	}
+	if rev {
+		r = zset.Len() - 1 - r
+	}
+	if withScore {
+		return resp.RawArrayDecoder([][]byte{
+			resp.IntegerDecoder(r),
+			request.Client.doubleReply(zset.Data[args[1]]),
+		}), nil
+	}
+	return resp.IntegerDecoder(r), nil
+}
+
+// ZCOUNT key min max
+func zcount(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 3 {
+		return wrongArgsError(request.Cmd)
+	}
+	r, err := parseScoreRange(args[1], args[2])
+	if err != nil {
+		return resp.ErrorDecoder(MinMaxFloatErr), ErrInvalidFormat
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	zset, ok, err := lookupZSet(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok {
+		request.keyMiss(args[0])
+		return resp.IntegerDecoder(0), nil
+	}
+	first := zset.Index.FirstInRange(r)
+	last := zset.Index.LastInRange(r)
+	if first == nil || last == nil {
+		return resp.IntegerDecoder(0), nil
+	}
+	count := zset.Index.Rank(last.Score, last.Member) - zset.Index.Rank(first.Score, first.Member) + 1
+	return resp.IntegerDecoder(max(count, 0)), nil
+}
+
+// ZLEXCOUNT key min max
+func zlexcount(request *Request) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 3 {
+		return wrongArgsError(request.Cmd)
+	}
+	r, empty, err := parseLexRange(args[1], args[2])
+	if err != nil {
+		return resp.ErrorDecoder(MinMaxLexErr), ErrInvalidFormat
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	zset, ok, err := lookupZSet(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok {
+		request.keyMiss(args[0])
+	}
+	if !ok || empty {
+		return resp.IntegerDecoder(0), nil
+	}
+	first := zset.Index.FirstInLexRange(r)
+	last := zset.Index.LastInLexRange(r)
+	if first == nil || last == nil {
+		return resp.IntegerDecoder(0), nil
+	}
+	count := zset.Index.Rank(last.Score, last.Member) - zset.Index.Rank(first.Score, first.Member) + 1
+	return resp.IntegerDecoder(max(count, 0)), nil
+}
+
+// range queries
+
+type zrangeSpec struct {
+	by         int
+	rev        bool
+	start      int
+	stop       int
+	scores     engine.ScoreRange
+	lex        engine.LexRange
+	empty      bool
+	offset     int
+	count      int
+	withScores bool
+}
+
+// parseZrange parses the unified ZRANGE syntax
+// key start stop [BYSCORE | BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+func parseZrange(args []string) (zrangeSpec, []byte) {
+	spec := zrangeSpec{by: zrangeByRank, count: -1}
+	limit := false
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "BYSCORE":
+			spec.by = zrangeByScore
+		case "BYLEX":
+			spec.by = zrangeByLex
+		case "REV":
+			spec.rev = true
+		case "WITHSCORES":
+			spec.withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return spec, resp.ErrorDecoder("ERR syntax error")
+			}
+			offset, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				return spec, resp.ErrorDecoder(NotIntegerErr)
+			}
+			count, err := strconv.Atoi(args[i+2])
+			if err != nil {
+				return spec, resp.ErrorDecoder(NotIntegerErr)
+			}
+			spec.offset, spec.count = offset, count
+			limit = true
+			i += 2
+		default:
+			return spec, resp.ErrorDecoder("ERR syntax error")
+		}
+	}
+	if limit && spec.by == zrangeByRank {
+		return spec, resp.ErrorDecoder("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+	if spec.withScores && spec.by == zrangeByLex {
+		return spec, resp.ErrorDecoder("ERR syntax error, WITHSCORES not supported in combination with BYLEX")
+	}
+
+	// with REV the range is given as max then min
+	lo, hi := args[1], args[2]
+	if spec.rev && spec.by != zrangeByRank {
+		lo, hi = hi, lo
+	}
+	switch spec.by {
+	case zrangeByRank:
+		start, err := strconv.Atoi(args[1])
+		if err != nil {
+			return spec, resp.ErrorDecoder(NotIntegerErr)
+		}
+		stop, err := strconv.Atoi(args[2])
+		if err != nil {
+			return spec, resp.ErrorDecoder(NotIntegerErr)
+		}
+		spec.start, spec.stop = start, stop
+	case zrangeByScore:
+		r, err := parseScoreRange(lo, hi)
+		if err != nil {
+			return spec, resp.ErrorDecoder(MinMaxFloatErr)
+		}
+		spec.scores = r
+	case zrangeByLex:
+		r, empty, err := parseLexRange(lo, hi)
+		if err != nil {
+			return spec, resp.ErrorDecoder(MinMaxLexErr)
+		}
+		spec.lex, spec.empty = r, empty
+	}
+	return spec, nil
+}
+
+// collectRange returns the nodes selected by spec in reply order
+func collectRange(zset engine.RedisZSet, spec zrangeSpec) []*engine.SkipListNode {
+	var nodes []*engine.SkipListNode
+	if spec.by == zrangeByRank {
+		length := zset.Len()
+		start, stop, ok := normalizeRange(spec.start, spec.stop, length)
+		if !ok {
+			return nil
+		}
+		rank := start + 1
+		if spec.rev {
+			rank = length - start
+		}
+		node := zset.Index.ByRank(rank)
+		for i := start; i <= stop && node != nil; i++ {
+			nodes = append(nodes, node)
+			if spec.rev {
+				node = node.Prev()
+			} else {
+				node = node.Next()
+			}
+		}
+		return nodes
+	}
+
+	if spec.empty || spec.offset < 0 {
+		return nil
+	}
+	var node *engine.SkipListNode
+	var contains func(node *engine.SkipListNode) bool
+	if spec.by == zrangeByScore {
+		contains = func(node *engine.SkipListNode) bool { return spec.scores.Contains(node.Score) }
+		if spec.rev {
+			node = zset.Index.LastInRange(spec.scores)
+		} else {
+			node = zset.Index.FirstInRange(spec.scores)
+		}
+	} else {
+		contains = func(node *engine.SkipListNode) bool { return spec.lex.Contains(node.Member) }
+		if spec.rev {
+			node = zset.Index.LastInLexRange(spec.lex)
+		} else {
+			node = zset.Index.FirstInLexRange(spec.lex)
+		}
+	}
+	skip := spec.offset
+	for node != nil && contains(node) {
+		if spec.count >= 0 && len(nodes) == spec.count {
+			break
+		}
+		if skip > 0 {
+			skip--
+		} else {
+			nodes = append(nodes, node)
+		}
+		if spec.rev {
+			node = node.Prev()
+		} else {
+			node = node.Next()
+		}
+	}
+	return nodes
+}
+
+// zrangeReply encodes the members of nodes, with their scores a flat array of members and
+// scores in RESP2 and an array of [member, score] pairs in RESP3
+func zrangeReply(client *Client, nodes []*engine.SkipListNode, withScores bool) []byte {
+	if withScores && client.resp3() {
+		pairs := make([][]byte, 0, len(nodes))
+		for _, node := range nodes {
+			pairs = append(pairs, scorePair(client, node))
+		}
+		return resp.RawArrayDecoder(pairs)
+	}
+	out := make([]string, 0, 2*len(nodes))
+	for _, node := range nodes {
+		out = append(out, node.Member)
+		if withScores {
+			out = append(out, formatScore(node.Score))
+		}
+	}
+	return resp.ArrayDecoder(out)
+}
+
+// scorePair encodes a member and its score
+func scorePair(client *Client, node *engine.SkipListNode) []byte {
+	return resp.RawArrayDecoder([][]byte{resp.BulkStringDecoder(node.Member), client.doubleReply(node.Score)})
+}
+
+// ZRANGE key start stop [BYSCORE | BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+func zrange(request *Request) ([]byte, error) {
+	return zrangeGeneric(request, request.Cmd.Args)
+}
+
+// the legacy range commands are rewritten to the unified ZRANGE syntax
+func zrevrange(request *Request) ([]byte, error) {
+	return zrangeLegacy(request, "REV")
+}
+func zrangebyscore(request *Request) ([]byte, error) {
+	return zrangeLegacy(request, "BYSCORE")
+}
+func zrevrangebyscore(request *Request) ([]byte, error) {
+	return zrangeLegacy(request, "BYSCORE", "REV")
+}
+func zrangebylex(request *Request) ([]byte, error) {
+	return zrangeLegacy(request, "BYLEX")
+}
+func zrevrangebylex(request *Request) ([]byte, error) {
+	return zrangeLegacy(request, "BYLEX", "REV")
+}
+
+func zrangeLegacy(request *Request, flags ...string) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) < 3 {
+		return wrongArgsError(request.Cmd)
+	}
+	unified := make([]string, 0, len(args)+len(flags))
+	unified = append(unified, args[:3]...)
+	unified = append(unified, flags...)
+	unified = append(unified, args[3:]...)
+	return zrangeGeneric(request, unified)
+}
+
+func zrangeGeneric(request *Request, args []string) ([]byte, error) {
+	if len(args) < 3 {
+		return wrongArgsError(request.Cmd)
+	}
+	spec, errOut := parseZrange(args)
+	if errOut != nil {
+		return errOut, ErrInvalidFormat
+	}
+	store := request.db()
+	store.Mu.RLock()
+	defer store.Mu.RUnlock()
+	zset, ok, err := lookupZSet(store, args[0])
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok {
+		request.keyMiss(args[0])
+		return resp.ArrayDecoder(nil), nil
+	}
+	return zrangeReply(request.Client, collectRange(zset, spec), spec.withScores), nil
+}
+
+func zpopmin(request *Request) ([]byte, error) {
+	return zpop(request, false)
+}
+func zpopmax(request *Request) ([]byte, error) {
+	return zpop(request, true)
+}
+
+// zpop implements ZPOPMIN and ZPOPMAX key [count]
+func zpop(request *Request, highest bool) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 1 && len(args) != 2 {
+		return wrongArgsError(request.Cmd)
+	}
+	key := args[0]
+	count := 1
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			return resp.ErrorDecoder("ERR value is out of range, must be positive"), ErrInvalidFormat
+		}
+		count = n
+	}
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	zset, ok, err := lookupZSet(store, key)
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok {
+		return resp.ArrayDecoder(nil), nil
+	}
+	var nodes []*engine.SkipListNode
+	for i := 0; i < count && zset.Len() > 0; i++ {
+		node := zset.Index.ByRank(1)
+		if highest {
+			node = zset.Index.ByRank(zset.Len())
+		}
+		nodes = append(nodes, node)
+		zset.Remove(node.Member)
+	}
+	if len(nodes) > 0 {
+		store.Touch(key)
+		if highest {
+			request.notify(notifyZSet, "zpopmax", key)
+		} else {
+			request.notify(notifyZSet, "zpopmin", key)
+		}
+	}
+	if zset.Len() == 0 {
+		delete(*store.Dict, key)
+		request.notify(notifyGeneric, "del", key)
+	}
+	// without a count RESP3 still gets a single flat pair
+	if len(args) == 1 && len(nodes) == 1 && request.Client.resp3() {
+		return scorePair(request.Client, nodes[0]), nil
+	}
+	return zrangeReply(request.Client, nodes, true), nil
+}
+
+func zremrangebyrank(request *Request) ([]byte, error) {
+	return zremrange(request, zrangeByRank)
+}
+func zremrangebyscore(request *Request) ([]byte, error) {
+	return zremrange(request, zrangeByScore)
+}
+func zremrangebylex(request *Request) ([]byte, error) {
+	return zremrange(request, zrangeByLex)
+}
+
+// zremrange implements ZREMRANGEBYRANK, ZREMRANGEBYSCORE and ZREMRANGEBYLEX key min max
+func zremrange(request *Request, by int) ([]byte, error) {
+	args := request.Cmd.Args
+	if len(args) != 3 {
+		return wrongArgsError(request.Cmd)
+	}
+	unified := []string{args[0], args[1], args[2]}
+	switch by {
+	case zrangeByScore:
+		unified = append(unified, "BYSCORE")
+	case zrangeByLex:
+		unified = append(unified, "BYLEX")
+	}
+	spec, errOut := parseZrange(unified)
+	if errOut != nil {
+		return errOut, ErrInvalidFormat
+	}
+	key := args[0]
+	store := request.db()
+	store.Mu.Lock()
+	defer store.Mu.Unlock()
+	zset, ok, err := lookupZSet(store, key)
+	if err != nil {
+		return wrongTypeError()
+	}
+	if !ok {
+		return resp.IntegerDecoder(0), nil
+	}
+	nodes := collectRange(zset, spec)
+	for _, node := range nodes {
+		zset.Remove(node.Member)
+	}
+	if len(nodes) > 0 {
+		store.Touch(key)
+		request.notify(notifyZSet, strings.ToLower(request.Cmd.Name), key)
+	}
+	if zset.Len() == 0 {
+		delete(*store.Dict, key)
+		request.notify(notifyGeneric, "del", key)
+	}
+	return resp.IntegerDecoder(len(nodes)), nil
+}
@@ -0,0 +1,128 @@
+package utils
+
+// Glob-style pattern matching with the semantics of stringmatchlen in redis, used by every
+// command taking a pattern:
+//
+//	*        any sequence of bytes, including none
+//	?        a single byte
+//	[abc]    one of the bytes, [a-z] a range (bounds in any order), [^a] any byte but a
+//	\x       the byte x literally, also inside brackets
+//
+// Unlike path.Match no byte is special, and malformed patterns never fail: an unterminated
+// bracket matches like a terminated one and a trailing backslash matches itself.
+
+// maxMatchNesting bounds the recursion of patterns with many stars
+const maxMatchNesting = 1000
+
+// StringMatch reports whether s matches pattern, ignoring ASCII case when nocase is set
+func StringMatch(pattern string, s string, nocase bool) bool {
+	skipLongerMatches := false
+	return stringMatch(pattern, s, nocase, &skipLongerMatches, 0)
+}
+
+// stringMatch sets skipLongerMatches when the rest of the pattern after a star matches no
+// suffix of s: stars earlier in the pattern need not try longer matches then.
+func stringMatch(pattern string, s string, nocase bool, skipLongerMatches *bool, nesting int) bool {
+	if nesting > maxMatchNesting {
+		return false
+	}
+	p, i := 0, 0
+	for p < len(pattern) && i < len(s) {
+		switch pattern[p] {
+		case '*':
+			for p+1 < len(pattern) && pattern[p+1] == '*' {
+				p++
+			}
+			if p == len(pattern)-1 {
+				return true
+			}
+			for ; i < len(s); i++ {
+				if stringMatch(pattern[p+1:], s[i:], nocase, skipLongerMatches, nesting+1) {
+					return true
+				}
+				if *skipLongerMatches {
+					return false
+				}
+			}
+			*skipLongerMatches = true
+			return false
+		case '?':
+			i++
+		case '[':
+			p++
+			not := p < len(pattern) && pattern[p] == '^'
+			if not {
+				p++
+			}
+			match := false
+			for {
+				if p+1 < len(pattern) && pattern[p] == '\\' {
+					p++
+					if pattern[p] == s[i] {
+						match = true
+					}
+				} else if p < len(pattern) && pattern[p] == ']' {
+					break
+				} else if p >= len(pattern) {
+					// unterminated bracket, step back so that the pattern ends here
+					p--
+					break
+				} else if p+2 < len(pattern) && pattern[p+1] == '-' {
+					start, end, c := pattern[p], pattern[p+2], s[i]
+					if start > end {
+						start, end = end, start
+					}
+					if nocase {
+						start, end, c = toLower(start), toLower(end), toLower(c)
+					}
+					p += 2
+					if c >= start && c <= end {
+						match = true
+					}
+				} else if equalByte(pattern[p], s[i], nocase) {
+					match = true
+				}
+				p++
+			}
+			if not {
+				match = !match
+			}
+			if !match {
+				return false
+			}
+			i++
+		case '\\':
+			if p+1 < len(pattern) {
+				p++
+			}
+			fallthrough
+		default:
+			if !equalByte(pattern[p], s[i], nocase) {
+				return false
+			}
+			i++
+		}
+		p++
+		if i == len(s) {
+			for p < len(pattern) && pattern[p] == '*' {
+				p++
+			}
+			break
+		}
+	}
+	return p == len(pattern) && i == len(s)
+}
+
+func equalByte(a byte, b byte, nocase bool) bool {
+	if nocase {
+		return toLower(a) == toLower(b)
+	}
+	return a == b
+}
+
+func toLower(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/engine"
+	"github.com/codecrafters-io/redis-starter-go/app/server"
+)
+
+// waitBlocked waits for count clients to be blocked on keys of store
+func waitBlocked(t *testing.T, store *engine.DbStore, count int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for server.BlockedClients(store) != count {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d blocked clients, got %d", count, server.BlockedClients(store))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBlockingPopServedImmediately(t *testing.T) {
+	serv := newTestServer()
+	runCases(t, serv, []commandCase{
+		{[]string{"RPUSH", "list", "a", "b"}, ":2\r\n"},
+		{[]string{"BLPOP", "missing", "list", "0"}, "*2\r\n$4\r\nlist\r\n$1\r\na\r\n"},
+		{[]string{"BRPOP", "list", "0"}, "*2\r\n$4\r\nlist\r\n$1\r\nb\r\n"},
+		{[]string{"BLPOP", "list", "-1"}, "-ERR timeout is negative\r\n"},
+		{[]string{"BLPOP", "list", "abc"}, "-ERR timeout is not a float or out of range\r\n"},
+	})
+}
+
+func TestBlockingPopTimeout(t *testing.T) {
+	serv := newTestServer()
+	start := time.Now()
+	if got := runCommand(serv, "BLPOP", "list", "0.1"); got != "*-1\r\n" {
+		t.Errorf("Expected nil array on timeout, got %q", got)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("BLPOP returned after %v, before its timeout", elapsed)
+	}
+	if got := runCommand(serv, "BLMOVE", "list", "dst", "LEFT", "RIGHT", "0.05"); got != "$-1\r\n" {
+		t.Errorf("Expected nil bulk on BLMOVE timeout, got %q", got)
+	}
+}
+
+func TestBlockingPopWakesInFIFOOrder(t *testing.T) {
+	serv := newTestServer()
+	first := make(chan string)
+	second := make(chan string)
+	go func() { first <- runCommand(serv, "BLPOP", "queue", "5") }()
+	waitBlocked(t, serv.Db, 1)
+	go func() { second <- runCommand(serv, "BRPOP", "other", "queue", "5") }()
+	waitBlocked(t, serv.Db, 2)
+
+	if got := runCommand(serv, "RPUSH", "queue", "a", "b", "c"); got != ":3\r\n" {
+		t.Errorf("Expected RPUSH to report the length before serving, got %q", got)
+	}
+	if got := <-first; got != "*2\r\n$5\r\nqueue\r\n$1\r\na\r\n" {
+		t.Errorf("Expected first client to get a, got %q", got)
+	}
+	if got := <-second; got != "*2\r\n$5\r\nqueue\r\n$1\r\nc\r\n" {
+		t.Errorf("Expected second client to get c, got %q", got)
+	}
+	if got := runCommand(serv, "LRANGE", "queue", "0", "-1"); got != "*1\r\n$1\r\nb\r\n" {
+		t.Errorf("Expected b to remain, got %q", got)
+	}
+}
+
+func TestBlockingMoveChain(t *testing.T) {
+	serv := newTestServer()
+	moved := make(chan string)
+	popped := make(chan string)
+	go func() { moved <- runCommand(serv, "BLMOVE", "src", "dst", "LEFT", "RIGHT", "5") }()
+	waitBlocked(t, serv.Db, 1)
+	go func() { popped <- runCommand(serv, "BLPOP", "dst", "5") }()
+	waitBlocked(t, serv.Db, 2)
+
+	runCommand(serv, "LPUSH", "src", "job")
+	if got := <-moved; got != "$3\r\njob\r\n" {
+		t.Errorf("Expected BLMOVE to return job, got %q", got)
+	}
+	if got := <-popped; got != "*2\r\n$3\r\ndst\r\n$3\r\njob\r\n" {
+		t.Errorf("Expected BLPOP on destination to be woken by the move, got %q", got)
+	}
+}
@@ -0,0 +1,211 @@
+package tests
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/engine"
+	"github.com/codecrafters-io/redis-starter-go/app/rdb"
+	"github.com/codecrafters-io/redis-starter-go/app/server"
+)
+
+func TestSelect(t *testing.T) {
+	serv := newTestServer(withDatabases(4))
+	client := &server.Client{}
+	runClientCases(t, serv, client, []commandCase{
+		{[]string{"SET", "k", "zero"}, "+OK\r\n"},
+		{[]string{"SELECT", "1"}, "+OK\r\n"},
+		{[]string{"GET", "k"}, "$-1\r\n"},
+		{[]string{"SET", "k", "one"}, "+OK\r\n"},
+		{[]string{"DBSIZE"}, ":1\r\n"},
+		{[]string{"SELECT", "4"}, "-ERR DB index is out of range\r\n"},
+		{[]string{"SELECT", "-1"}, "-ERR DB index is out of range\r\n"},
+		{[]string{"SELECT", "one"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"GET", "k"}, "+one\r\n"},
+		{[]string{"SELECT", "0"}, "+OK\r\n"},
+		{[]string{"GET", "k"}, "+zero\r\n"},
+	})
+	if got := runCommand(newTestServer(), "SELECT", "1"); got != "-ERR DB index is out of range\r\n" {
+		t.Errorf("Expected a single database server to refuse SELECT 1, got %q", got)
+	}
+}
+
+func TestMoveAndCopyAcrossDatabases(t *testing.T) {
+	serv := newTestServer(withDatabases(2))
+	client := &server.Client{}
+	runClientCases(t, serv, client, []commandCase{
+		{[]string{"SET", "k", "v", "EX", "100"}, "+OK\r\n"},
+		{[]string{"SET", "taken", "v0"}, "+OK\r\n"},
+		{[]string{"MOVE", "k", "0"}, "-ERR source and destination objects are the same\r\n"},
+		{[]string{"MOVE", "k", "2"}, "-ERR DB index is out of range\r\n"},
+		{[]string{"MOVE", "missing", "1"}, ":0\r\n"},
+		{[]string{"COPY", "taken", "taken", "DB", "1"}, ":1\r\n"},
+		{[]string{"MOVE", "taken", "1"}, ":0\r\n"},
+		{[]string{"MOVE", "k", "1"}, ":1\r\n"},
+		{[]string{"EXISTS", "k"}, ":0\r\n"},
+		{[]string{"SELECT", "1"}, "+OK\r\n"},
+		{[]string{"GET", "taken"}, "+v0\r\n"},
+		{[]string{"COPY", "k", "k2", "DB", "0"}, ":1\r\n"},
+	})
+	if ttl := runClientCommand(serv, client, "TTL", "k"); ttl != ":100\r\n" {
+		t.Errorf("Expected MOVE to keep the TTL, got %q", ttl)
+	}
+	if got := runCommand(serv, "EXISTS", "k2"); got != ":1\r\n" {
+		t.Errorf("Expected COPY DB 0 to write to database 0, got %q", got)
+	}
+}
+
+func TestSwapDbServesBlockedClients(t *testing.T) {
+	serv := newTestServer(withDatabases(2))
+	waiter := &server.Client{DbIndex: 1}
+	popped := make(chan string)
+	go func() { popped <- runClientCommand(serv, waiter, "BLPOP", "queue", "5") }()
+	waitBlocked(t, serv.Dbs[1], 1)
+	runCommand(serv, "RPUSH", "queue", "job")
+	runCommand(serv, "SET", "k", "zero")
+	if got := runCommand(serv, "SWAPDB", "0", "1"); got != "+OK\r\n" {
+		t.Fatalf("Expected SWAPDB to succeed, got %q", got)
+	}
+	if got := <-popped; got != "*2\r\n$5\r\nqueue\r\n$3\r\njob\r\n" {
+		t.Errorf("Expected SWAPDB to serve the client blocked in database 1, got %q", got)
+	}
+	if got := runClientCommand(serv, waiter, "GET", "k"); got != "+zero\r\n" {
+		t.Errorf("Expected database 1 to hold the keys of database 0, got %q", got)
+	}
+	if got := runCommand(serv, "DBSIZE"); got != ":0\r\n" {
+		t.Errorf("Expected database 0 to be empty, got %q", got)
+	}
+	runCases(t, serv, []commandCase{
+		{[]string{"SWAPDB", "0", "0"}, "+OK\r\n"},
+		{[]string{"SWAPDB", "0", "5"}, "-ERR DB index is out of range\r\n"},
+		{[]string{"SWAPDB", "0"}, "-ERR wrong number of arguments for 'swapdb' command\r\n"},
+	})
+}
+
+func TestFlush(t *testing.T) {
+	serv := newTestServer(withDatabases(3))
+	for _, db := range []int{0, 1, 2} {
+		client := &server.Client{DbIndex: db}
+		runClientCommand(serv, client, "SET", "a", "1")
+		runClientCommand(serv, client, "RPUSH", "b", "x")
+	}
+	client := &server.Client{DbIndex: 1}
+	runClientCases(t, serv, client, []commandCase{
+		{[]string{"FLUSHDB", "LAZY"}, "-ERR syntax error\r\n"},
+		{[]string{"FLUSHDB", "async"}, "+OK\r\n"},
+		{[]string{"DBSIZE"}, ":0\r\n"},
+	})
+	if got := runCommand(serv, "DBSIZE"); got != ":2\r\n" {
+		t.Errorf("Expected FLUSHDB to keep the other databases, got %q", got)
+	}
+	runCases(t, serv, []commandCase{
+		{[]string{"FLUSHALL", "SYNC"}, "+OK\r\n"},
+		{[]string{"DBSIZE"}, ":0\r\n"},
+	})
+	if got := runClientCommand(serv, &server.Client{DbIndex: 2}, "DBSIZE"); got != ":0\r\n" {
+		t.Errorf("Expected FLUSHALL to empty every database, got %q", got)
+	}
+}
+
+func TestPropagationSelectsDatabase(t *testing.T) {
+	serv := newTestServer(withDatabases(3))
+	serv.Role = server.Master
+	replica := &server.Replica{Pending: true}
+	serv.ConnectedReplica = &[]*server.Replica{replica}
+	client := &server.Client{}
+	runClientCommand(serv, client, "SELECT", "2")
+	runClientCommand(serv, client, "SET", "k", "v")
+	runClientCommand(serv, client, "DEL", "k")
+	runCommand(serv, "DEL", "other")
+	want := "*2\r\n$6\r\nSELECT\r\n$1\r\n2\r\n" +
+		"*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$1\r\nv\r\n" +
+		"*2\r\n$3\r\nDEL\r\n$1\r\nk\r\n" +
+		"*2\r\n$6\r\nSELECT\r\n$1\r\n0\r\n" +
+		"*2\r\n$3\r\nDEL\r\n$5\r\nother\r\n"
+	if got := replica.Buffer.String(); got != want {
+		t.Errorf("Expected SELECT before commands of another database, got %q", got)
+	}
+}
+
+func TestConcurrentPropagationKeepsSelects(t *testing.T) {
+	serv := newTestServer(withDatabases(3))
+	serv.Role = server.Master
+	replica := &server.Replica{Pending: true}
+	serv.ConnectedReplica = &[]*server.Replica{replica}
+	var wg sync.WaitGroup
+	for db := 0; db < 3; db++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client := &server.Client{}
+			runClientCommand(serv, client, "SELECT", strconv.Itoa(db))
+			for i := 0; i < 200; i++ {
+				runClientCommand(serv, client, "SET", "db"+strconv.Itoa(db)+":"+strconv.Itoa(i), "v")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if serv.Offset != replica.Buffer.Len() {
+		t.Errorf("Expected the offset to count the %d bytes sent, got %d", replica.Buffer.Len(), serv.Offset)
+	}
+	// every SET follows the SELECT of its database
+	reader := bufio.NewReaderSize(&replica.Buffer, replica.Buffer.Len())
+	db, sets := "0", 0
+	for {
+		cmd, err := server.ReadCommand(reader)
+		if err != nil {
+			break
+		}
+		switch cmd.Name {
+		case "SELECT":
+			db = cmd.Args[0]
+		case "SET":
+			sets++
+			if !strings.HasPrefix(cmd.Args[0], "db"+db+":") {
+				t.Fatalf("Expected %s to be sent to database %s", cmd.Args[0], db)
+			}
+		}
+	}
+	if sets != 600 {
+		t.Errorf("Expected 600 SET, got %d", sets)
+	}
+}
+
+func TestRDBDatabases(t *testing.T) {
+	streamOnly := engine.RedisStream{Data: engine.NewStream()}
+	streamOnly.Data.Append(engine.StreamID{Ms: 1}, []string{"f", "v"})
+	dicts := []*map[string]engine.RedisObj{
+		{"zero": engine.NewRedisString("0", time.Time{})},
+		{"s": streamOnly},
+		{},
+		{"three": engine.NewRedisString("3", time.Time{}), "s3": streamOnly},
+	}
+	data, err := rdb.GenerateDatabasesBinary(dicts)
+	if err != nil {
+		t.Fatalf("GenerateDatabasesBinary failed: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "dump.rdb")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded := rdb.EncodeDatabases(path, 4)
+	if len(loaded[0]) != 1 || len(loaded[1]) != 1 || len(loaded[2]) != 0 || len(loaded[3]) != 2 {
+		t.Fatalf("Expected every database to keep its keys, got %v", loaded)
+	}
+	if _, ok := loaded[1]["s"].(engine.RedisStream); !ok {
+		t.Errorf("Expected database 1 to hold the stream, got %v", loaded[1])
+	}
+	if str, ok := loaded[3]["three"].(engine.RedisString); !ok || str.String() != "3" {
+		t.Errorf("Expected database 3 to hold its string, got %v", loaded[3])
+	}
+	if fewer := rdb.EncodeDatabases(path, 2); len(fewer) != 2 || len(fewer[1]) != 1 {
+		t.Errorf("Expected databases past the count to be dropped, got %v", fewer)
+	}
+}
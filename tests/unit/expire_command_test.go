@@ -0,0 +1,228 @@
+package tests
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/server"
+)
+
+func TestExpireCommands(t *testing.T) {
+	serv := newTestServer()
+	runCommand(serv, "SET", "k", "v")
+	runCommand(serv, "RPUSH", "list", "x")
+	runCases(t, serv, []commandCase{
+		{[]string{"TTL", "missing"}, ":-2\r\n"},
+		{[]string{"TTL", "k"}, ":-1\r\n"},
+		{[]string{"EXPIRETIME", "k"}, ":-1\r\n"},
+		{[]string{"EXPIRE", "missing", "10"}, ":0\r\n"},
+		{[]string{"EXPIRE", "k", "100", "XX"}, ":0\r\n"},
+		{[]string{"EXPIRE", "k", "100", "GT"}, ":0\r\n"},
+		{[]string{"EXPIRE", "k", "100", "NX"}, ":1\r\n"},
+		{[]string{"TTL", "k"}, ":100\r\n"},
+		{[]string{"EXPIRE", "k", "200", "NX"}, ":0\r\n"},
+		{[]string{"EXPIRE", "k", "50", "GT"}, ":0\r\n"},
+		{[]string{"EXPIRE", "k", "200", "GT"}, ":1\r\n"},
+		{[]string{"EXPIRE", "k", "300", "LT"}, ":0\r\n"},
+		{[]string{"PEXPIRE", "k", "150000", "LT", "XX"}, ":1\r\n"},
+		{[]string{"TTL", "k"}, ":150\r\n"},
+		{[]string{"PERSIST", "k"}, ":1\r\n"},
+		{[]string{"PERSIST", "k"}, ":0\r\n"},
+		{[]string{"EXPIRE", "k", "10", "LT"}, ":1\r\n"},
+		{[]string{"EXPIREAT", "list", "99999999999"}, ":1\r\n"},
+		{[]string{"EXPIRETIME", "list"}, ":99999999999\r\n"},
+		{[]string{"PEXPIRETIME", "list"}, ":99999999999000\r\n"},
+		{[]string{"EXPIRE", "k", "10", "NX", "XX"}, "-ERR NX and XX, GT or LT options at the same time are not compatible\r\n"},
+		{[]string{"EXPIRE", "k", "10", "GT", "LT"}, "-ERR GT and LT options at the same time are not compatible\r\n"},
+		{[]string{"EXPIRE", "k", "10", "SOON"}, "-ERR Unsupported option SOON\r\n"},
+		{[]string{"EXPIRE", "k", "ten"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"EXPIRE", "k", "9223372036854775807"}, "-ERR invalid expire time in 'expire' command\r\n"},
+		{[]string{"EXPIRE", "k", "-1"}, ":1\r\n"},
+		{[]string{"EXISTS", "k"}, ":0\r\n"},
+		{[]string{"TTL", "k"}, ":-2\r\n"},
+	})
+}
+
+func TestExpirePropagatesAbsoluteTime(t *testing.T) {
+	serv := newTestServer()
+	runCommand(serv, "SET", "k", "v")
+	propagated := func(args ...string) []server.Command {
+		cmd, _ := server.CreateCommand(args[0], args[1:])
+		request := &server.Request{Serv: serv, Cmd: &cmd}
+		server.ProcessCommand(request)
+		if cmd.IsPropagatable {
+			t.Errorf("Expected %s to be propagated as rewritten", args[0])
+		}
+		return request.AlsoPropagate
+	}
+
+	before := time.Now().Add(100 * time.Second).UnixMilli()
+	got := propagated("EXPIRE", "k", "100")
+	if len(got) != 1 || got[0].Name != "PEXPIREAT" || got[0].Args[0] != "k" {
+		t.Fatalf("Expected EXPIRE to be propagated as PEXPIREAT, got %v", got)
+	}
+	if ms, _ := strconv.ParseInt(got[0].Args[1], 10, 64); ms < before || ms > before+1000 {
+		t.Errorf("Expected a deadline about 100s from now, got %d", ms)
+	}
+	if got := propagated("EXPIRE", "k", "100", "NX"); len(got) != 0 {
+		t.Errorf("Expected a skipped EXPIRE not to be propagated, got %v", got)
+	}
+	if got := propagated("PEXPIREAT", "k", "1"); len(got) != 1 || got[0].Name != "DEL" {
+		t.Errorf("Expected a deadline in the past to be propagated as DEL, got %v", got)
+	}
+}
+
+func TestActiveExpireCycle(t *testing.T) {
+	serv := newTestServer()
+	for i := 0; i < 200; i++ {
+		runCommand(serv, "SET", "volatile"+strconv.Itoa(i), "v", "PX", "1")
+	}
+	for i := 0; i < 10; i++ {
+		runCommand(serv, "SET", "persistent"+strconv.Itoa(i), "v")
+	}
+	runCommand(serv, "SET", "later", "v", "EX", "100")
+	time.Sleep(5 * time.Millisecond)
+
+	before := runCommand(serv, "INFO", "stats")
+	// mostly expired samples keep the cycle going until the keyspace is clean
+	if deleted := server.ActiveExpireCycle(serv); deleted != 200 {
+		t.Errorf("Expected the cycle to delete the 200 expired keys, deleted %d", deleted)
+	}
+	if got := runCommand(serv, "DBSIZE"); got != ":11\r\n" {
+		t.Errorf("Expected only live keys to remain, got %q", got)
+	}
+	after := runCommand(serv, "INFO", "stats")
+	if before == after || !strings.Contains(after, "expired_keys:") {
+		t.Errorf("Expected INFO stats to report the deleted keys, got %q then %q", before, after)
+	}
+	serv.Role = server.Master
+	if got := runCommand(serv, "INFO"); !strings.Contains(got, "role:master") || !strings.Contains(got, "expired_keys:") {
+		t.Errorf("Expected INFO to report every section, got %q", got)
+	}
+	if got := runCommand(serv, "INFO", "bogus"); got != "-ERR syntax error\r\n" {
+		t.Errorf("Expected an unknown section to be rejected, got %q", got)
+	}
+}
+
+func TestExpireSample(t *testing.T) {
+	serv := newTestServer()
+	runCommand(serv, "SET", "gone", "v", "PX", "1")
+	runCommand(serv, "SET", "live", "v", "EX", "100")
+	runCommand(serv, "SET", "plain", "v")
+	time.Sleep(5 * time.Millisecond)
+	sampled, expired := serv.Db.ExpireSample(20, 400)
+	if sampled != 2 || len(expired) != 1 || expired[0] != "gone" {
+		t.Errorf("Expected 2 volatile keys sampled and gone expired, got %d and %v", sampled, expired)
+	}
+	if _, ok := (*serv.Db.Dict)["gone"]; ok {
+		t.Error("Expected the expired key to be deleted")
+	}
+}
+
+func TestMasterPropagatesExpiredKeys(t *testing.T) {
+	serv := newTestServer()
+	serv.Role = server.Master
+	replica := &server.Replica{Pending: true}
+	serv.ConnectedReplica = &[]*server.Replica{replica}
+	runCommand(serv, "RPUSH", "list", "old")
+	runCommand(serv, "PEXPIRE", "list", "1")
+	runCommand(serv, "SET", "active", "v", "PX", "1")
+	time.Sleep(5 * time.Millisecond)
+	replica.Buffer.Reset()
+
+	runCommand(serv, "RPUSH", "list", "new")
+	want := "*2\r\n$3\r\nDEL\r\n$4\r\nlist\r\n*3\r\n$5\r\nRPUSH\r\n$4\r\nlist\r\n$3\r\nnew\r\n"
+	if got := replica.Buffer.String(); got != want {
+		t.Errorf("Expected the lazily expired key to be deleted before the command, got %q", got)
+	}
+	replica.Buffer.Reset()
+	if got := runCommand(serv, "GET", "active"); got != "$-1\r\n" {
+		t.Errorf("Expected the expired key to be hidden, got %q", got)
+	}
+	if _, ok := (*serv.Db.Dict)["active"]; ok {
+		t.Error("Expected the master to delete the key found expired by a read")
+	}
+	if got := replica.Buffer.String(); got != "*2\r\n$3\r\nDEL\r\n$6\r\nactive\r\n" {
+		t.Errorf("Expected a read of an expired key to propagate DEL, got %q", got)
+	}
+}
+
+func TestMasterPropagatesRemovedExpiredKeysOnly(t *testing.T) {
+	serv := newTestServer()
+	serv.Role = server.Master
+	replica := &server.Replica{Pending: true}
+	serv.ConnectedReplica = &[]*server.Replica{replica}
+	runCommand(serv, "SET", "a", "v", "PX", "1")
+	runCommand(serv, "SET", "b", "v", "PX", "1")
+	time.Sleep(5 * time.Millisecond)
+	replica.Buffer.Reset()
+
+	// a key the command deletes itself is not deleted twice
+	runCommand(serv, "DEL", "a")
+	if got := replica.Buffer.String(); got != "*2\r\n$3\r\nDEL\r\n$1\r\na\r\n" {
+		t.Errorf("Expected the DEL of the command only, got %q", got)
+	}
+	replica.Buffer.Reset()
+
+	// a key found expired by a read, then written by another command before the read
+	// deleted it, is deleted before the write
+	serv.Db.Mu.RLock()
+	serv.Db.Lookup("b")
+	serv.Db.Mu.RUnlock()
+	runCommand(serv, "SET", "b", "new")
+	want := "*2\r\n$3\r\nDEL\r\n$1\r\nb\r\n*3\r\n$3\r\nSET\r\n$1\r\nb\r\n$3\r\nnew\r\n"
+	if got := replica.Buffer.String(); got != want {
+		t.Errorf("Expected DEL before the write, got %q", got)
+	}
+	replica.Buffer.Reset()
+	runCommand(serv, "GET", "b")
+	if got := replica.Buffer.String(); got != "" {
+		t.Errorf("Expected nothing propagated for a live key, got %q", got)
+	}
+}
+
+func TestReplicaDoesNotExpireKeys(t *testing.T) {
+	serv := newTestServer()
+	serv.Db.Replica = true
+	runCommand(serv, "SET", "k", "v", "PX", "1")
+	time.Sleep(5 * time.Millisecond)
+	if got := runCommand(serv, "EXISTS", "k"); got != ":0\r\n" {
+		t.Errorf("Expected the replica to hide the expired key, got %q", got)
+	}
+	if deleted := server.ActiveExpireCycle(serv); deleted != 0 {
+		t.Errorf("Expected the replica not to expire keys, deleted %d", deleted)
+	}
+	if _, ok := (*serv.Db.Dict)["k"]; !ok {
+		t.Error("Expected the replica to keep the key until the master deletes it")
+	}
+	runCommand(serv, "DEL", "k")
+	if got := runCommand(serv, "DBSIZE"); got != ":0\r\n" {
+		t.Errorf("Expected the DEL of the master to delete the key, got %q", got)
+	}
+}
+
+func TestReplicaAppliesMasterCommandsToExpiredKeys(t *testing.T) {
+	serv := newTestServer()
+	serv.Db.Replica = true
+	master := server.NewMasterClient()
+	runClientCommand(serv, master, "SET", "k", "v", "PX", "1")
+	runClientCommand(serv, master, "RPUSH", "l", "a")
+	runClientCommand(serv, master, "PEXPIRE", "l", "1")
+	time.Sleep(5 * time.Millisecond)
+
+	// the master still considers the keys live, its commands find them
+	runClientCases(t, serv, master, []commandCase{
+		{[]string{"APPEND", "k", "w"}, ":2\r\n"},
+		{[]string{"RPUSH", "l", "b"}, ":2\r\n"},
+	})
+	runCases(t, serv, []commandCase{
+		{[]string{"GET", "k"}, "$-1\r\n"},
+		{[]string{"LLEN", "l"}, ":0\r\n"},
+	})
+	runClientCases(t, serv, master, []commandCase{
+		{[]string{"DEL", "k", "l"}, ":2\r\n"},
+		{[]string{"DBSIZE"}, ":0\r\n"},
+	})
+}
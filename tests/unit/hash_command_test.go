@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/engine"
+	"github.com/codecrafters-io/redis-starter-go/app/rdb"
+)
+
+func TestHashCommands(t *testing.T) {
+	serv := newTestServer()
+	runCases(t, serv, []commandCase{
+		{[]string{"HSET", "user", "name", "ann", "age", "30"}, ":2\r\n"},
+		{[]string{"HSET", "user", "name", "bob"}, ":0\r\n"},
+		{[]string{"HMSET", "user", "city", "cairo"}, "+OK\r\n"},
+		{[]string{"HSETNX", "user", "city", "giza"}, ":0\r\n"},
+		{[]string{"HGET", "user", "name"}, "$3\r\nbob\r\n"},
+		{[]string{"HGET", "user", "missing"}, "$-1\r\n"},
+		{[]string{"HMGET", "user", "age", "missing"}, "*2\r\n$2\r\n30\r\n$-1\r\n"},
+		{[]string{"HLEN", "user"}, ":3\r\n"},
+		{[]string{"HEXISTS", "user", "age"}, ":1\r\n"},
+		{[]string{"HSTRLEN", "user", "city"}, ":5\r\n"},
+		{[]string{"HSET", "user", "odd"}, "-ERR wrong number of arguments for 'hset' command\r\n"},
+		{[]string{"HDEL", "user", "name", "age", "missing"}, ":2\r\n"},
+		{[]string{"HGETALL", "user"}, "*2\r\n$4\r\ncity\r\n$5\r\ncairo\r\n"},
+		{[]string{"HDEL", "user", "city"}, ":1\r\n"},
+		{[]string{"HLEN", "user"}, ":0\r\n"},
+	})
+	if _, ok := (*serv.Db.Dict)["user"]; ok {
+		t.Error("Expected empty hash to be deleted")
+	}
+}
+
+func TestHashIncrements(t *testing.T) {
+	serv := newTestServer()
+	runCases(t, serv, []commandCase{
+		{[]string{"HINCRBY", "h", "n", "5"}, ":5\r\n"},
+		{[]string{"HINCRBY", "h", "n", "-7"}, ":-2\r\n"},
+		{[]string{"HINCRBY", "h", "n", "x"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"HSET", "h", "s", "abc", "big", "9223372036854775807"}, ":2\r\n"},
+		{[]string{"HINCRBY", "h", "s", "1"}, "-ERR hash value is not an integer\r\n"},
+		{[]string{"HINCRBY", "h", "big", "1"}, "-ERR increment or decrement would overflow\r\n"},
+		{[]string{"HINCRBYFLOAT", "h", "f", "10.5"}, "$4\r\n10.5\r\n"},
+		{[]string{"HINCRBYFLOAT", "h", "f", "0.1"}, "$4\r\n10.6\r\n"},
+		{[]string{"HINCRBYFLOAT", "h", "n", "2.5e2"}, "$3\r\n248\r\n"},
+		{[]string{"HINCRBYFLOAT", "h", "s", "1"}, "-ERR hash value is not a float\r\n"},
+	})
+}
+
+func TestHashScan(t *testing.T) {
+	serv := newTestServer()
+	runCommand(serv, "HSET", "h", "a1", "1", "a2", "2", "b1", "3")
+	pairs := scanAll(t, serv, "HSCAN", "h", "COUNT", "1")
+	fields := map[string]string{}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		fields[pairs[i]] = pairs[i+1]
+	}
+	if len(fields) != 3 || fields["a1"] != "1" || fields["a2"] != "2" || fields["b1"] != "3" {
+		t.Errorf("Expected every field with its value, got %v", pairs)
+	}
+	if got := sortedSet(scanAll(t, serv, "HSCAN", "h", "MATCH", "a*", "NOVALUES")); !slices.Equal(got, []string{"a1", "a2"}) {
+		t.Errorf("Expected the matching fields only, got %v", got)
+	}
+}
+
+func TestHashRDBRoundTrip(t *testing.T) {
+	dict := map[string]engine.RedisObj{
+		"user": engine.RedisHash{Data: map[string]string{"name": "ann", "age": "30"}},
+		"tmp": engine.RedisHash{
+			Data:       map[string]string{"k": "v"},
+			Expiration: time.Now().Add(time.Hour),
+		},
+	}
+	path := filepath.Join(t.TempDir(), "dump.rdb")
+	if err := rdb.GenerateRDBFile(&dict, path); err != nil {
+		t.Fatalf("GenerateRDBFile failed: %v", err)
+	}
+	loaded := rdb.Encode(path)
+	user, ok := loaded["user"].(engine.RedisHash)
+	if !ok {
+		t.Fatalf("Expected user to load as a hash, got %T", loaded["user"])
+	}
+	if user.Data["name"] != "ann" || user.Data["age"] != "30" || len(user.Data) != 2 {
+		t.Errorf("Unexpected hash contents %v", user.Data)
+	}
+	tmp, ok := loaded["tmp"].(engine.RedisHash)
+	if !ok || !tmp.HasExpiration() {
+		t.Errorf("Expected tmp to keep its expiration, got %v", loaded["tmp"])
+	}
+}
@@ -0,0 +1,155 @@
+package tests
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/engine"
+	"github.com/codecrafters-io/redis-starter-go/app/server"
+)
+
+func TestKeyCommands(t *testing.T) {
+	serv := newTestServer()
+	runCommand(serv, "MSET", "a", "1", "b", "2")
+	runCommand(serv, "RPUSH", "list", "x", "y")
+	runCommand(serv, "HSET", "hash", "f", "v")
+	runCommand(serv, "SADD", "set", "m")
+	runCommand(serv, "ZADD", "zset", "1", "m")
+	runCommand(serv, "XADD", "stream", "1-0", "f", "v")
+	runCases(t, serv, []commandCase{
+		{[]string{"TYPE", "a"}, "+string\r\n"},
+		{[]string{"TYPE", "list"}, "+list\r\n"},
+		{[]string{"TYPE", "hash"}, "+hash\r\n"},
+		{[]string{"TYPE", "set"}, "+set\r\n"},
+		{[]string{"TYPE", "zset"}, "+zset\r\n"},
+		{[]string{"TYPE", "stream"}, "+stream\r\n"},
+		{[]string{"TYPE", "missing"}, "+none\r\n"},
+		{[]string{"EXISTS", "a", "a", "missing"}, ":2\r\n"},
+		{[]string{"TOUCH", "a", "list", "missing"}, ":2\r\n"},
+		{[]string{"DBSIZE"}, ":7\r\n"},
+		{[]string{"DEL", "a", "missing", "set"}, ":2\r\n"},
+		{[]string{"UNLINK", "zset"}, ":1\r\n"},
+		{[]string{"EXISTS", "a", "set", "zset"}, ":0\r\n"},
+		{[]string{"RENAME", "missing", "x"}, "-ERR no such key\r\n"},
+		{[]string{"RENAME", "b", "c"}, "+OK\r\n"},
+		{[]string{"GET", "c"}, "+2\r\n"},
+		{[]string{"EXISTS", "b"}, ":0\r\n"},
+		{[]string{"RENAME", "c", "c"}, "+OK\r\n"},
+		{[]string{"RENAMENX", "c", "list"}, ":0\r\n"},
+		{[]string{"RENAMENX", "c", "d"}, ":1\r\n"},
+		{[]string{"RENAME", "d", "list"}, "+OK\r\n"},
+		{[]string{"TYPE", "list"}, "+string\r\n"},
+		{[]string{"DBSIZE"}, ":3\r\n"},
+		{[]string{"DEL"}, "-ERR wrong number of arguments for 'del' command\r\n"},
+	})
+}
+
+func TestRenameKeepsTTL(t *testing.T) {
+	serv := newTestServer()
+	runCommand(serv, "SET", "src", "v", "EX", "100")
+	runCommand(serv, "RENAME", "src", "dst")
+	if obj := serv.Db.Lookup("dst"); obj == nil || !obj.HasExpiration() {
+		t.Errorf("Expected RENAME to move the TTL, got %+v", obj)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	serv := newTestServer(groupStream)
+	runCommand(serv, "RPUSH", "list", "x")
+	runCommand(serv, "SET", "str", "v", "EX", "100")
+	runCommand(serv, "XREADGROUP", "GROUP", "g", "alice", "COUNT", "1", "STREAMS", "s", ">")
+	runCases(t, serv, []commandCase{
+		{[]string{"COPY", "list", "copy"}, ":1\r\n"},
+		{[]string{"RPUSH", "copy", "y"}, ":2\r\n"},
+		{[]string{"LRANGE", "list", "0", "-1"}, "*1\r\n$1\r\nx\r\n"},
+		{[]string{"COPY", "str", "copy"}, ":0\r\n"},
+		{[]string{"COPY", "str", "copy", "REPLACE"}, ":1\r\n"},
+		{[]string{"TYPE", "copy"}, "+string\r\n"},
+		{[]string{"COPY", "missing", "copy", "REPLACE"}, ":0\r\n"},
+		{[]string{"COPY", "str", "str"}, "-ERR source and destination objects are the same\r\n"},
+		{[]string{"COPY", "str", "other", "DB", "0"}, ":1\r\n"},
+		{[]string{"COPY", "str", "other", "DB", "x"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"COPY", "str", "other", "BOGUS"}, "-ERR syntax error\r\n"},
+		{[]string{"COPY", "s", "s2"}, ":1\r\n"},
+		{[]string{"XACK", "s2", "g", "1-0"}, ":1\r\n"},
+		{[]string{"XPENDING", "s", "g"}, "*4\r\n:1\r\n$3\r\n1-0\r\n$3\r\n1-0\r\n*1\r\n*2\r\n$5\r\nalice\r\n$1\r\n1\r\n"},
+	})
+	if obj := serv.Db.Lookup("copy"); !obj.HasExpiration() {
+		t.Error("Expected COPY to copy the TTL")
+	}
+	s2 := serv.Db.Lookup("s2").(engine.RedisStream).Data
+	if s2.Len() != 2 || s2.Group("g").Consumers["alice"] == nil {
+		t.Errorf("Expected the copied stream to keep its entries and consumers, got %+v", s2)
+	}
+}
+
+func TestRandomKey(t *testing.T) {
+	serv := newTestServer()
+	if got := runCommand(serv, "RANDOMKEY"); got != "$-1\r\n" {
+		t.Errorf("Expected nil on an empty keyspace, got %q", got)
+	}
+	runCommand(serv, "SET", "gone", "v", "PX", "1")
+	runCommand(serv, "SET", "k", "v")
+	time.Sleep(5 * time.Millisecond)
+	for i := 0; i < 10; i++ {
+		if got := runCommand(serv, "RANDOMKEY"); got != "$1\r\nk\r\n" {
+			t.Fatalf("Expected RANDOMKEY to skip expired keys, got %q", got)
+		}
+	}
+}
+
+func TestRandomKeySamples(t *testing.T) {
+	serv := newTestServer()
+	for i := 0; i < 1000; i++ {
+		runCommand(serv, "SET", "gone:"+strconv.Itoa(i), "v", "PX", "1")
+	}
+	runCommand(serv, "SET", "live", "v")
+	time.Sleep(5 * time.Millisecond)
+	// the samples are mostly expired keys, the walk that follows finds the live one
+	if got := runCommand(serv, "RANDOMKEY"); got != "$4\r\nlive\r\n" {
+		t.Fatalf("Expected the only live key, got %q", got)
+	}
+
+	for i := 0; i < 20; i++ {
+		runCommand(serv, "SET", "k:"+strconv.Itoa(i), "v")
+	}
+	seen := map[string]bool{}
+	for i := 0; i < 2000; i++ {
+		seen[runCommand(serv, "RANDOMKEY")] = true
+	}
+	if len(seen) != 21 {
+		t.Errorf("Expected every live key to be returned, got %d keys", len(seen))
+	}
+}
+
+func TestRenameWakesBlockedClients(t *testing.T) {
+	serv := newTestServer()
+	popped := make(chan string)
+	go func() { popped <- runCommand(serv, "BLPOP", "queue", "5") }()
+	waitBlocked(t, serv.Db, 1)
+	runCommand(serv, "RPUSH", "staging", "job")
+	runCommand(serv, "RENAME", "staging", "queue")
+	if got := <-popped; got != "*2\r\n$5\r\nqueue\r\n$3\r\njob\r\n" {
+		t.Errorf("Expected RENAME to serve the blocked client, got %q", got)
+	}
+}
+
+func TestPatternCommands(t *testing.T) {
+	serv := newTestServer()
+	runCommand(serv, "MSET", "a/b", "1", "a*b", "2", "[x]", "3")
+	if got := runCommand(serv, "KEYS", "a?b"); got != "*2\r\n$3\r\na/b\r\n$3\r\na*b\r\n" && got != "*2\r\n$3\r\na*b\r\n$3\r\na/b\r\n" {
+		t.Errorf("Expected ? to match any byte, / included, got %q", got)
+	}
+	runCases(t, serv, []commandCase{
+		{[]string{"KEYS", `a\*b`}, "*1\r\n$3\r\na*b\r\n"},
+		{[]string{"KEYS", `\[x\]`}, "*1\r\n$3\r\n[x]\r\n"},
+		{[]string{"KEYS", "[x"}, "*0\r\n"},
+		{[]string{"SCAN", "0", "MATCH", "a/*"}, "*2\r\n$1\r\n0\r\n*1\r\n$3\r\na/b\r\n"},
+	})
+	server.ConfigLookup = map[string]string{"dir": "/tmp", "dbfilename": "dump.rdb", "port": "6379"}
+	runCases(t, serv, []commandCase{
+		{[]string{"CONFIG", "GET", "DIR"}, "*2\r\n$3\r\ndir\r\n$4\r\n/tmp\r\n"},
+		{[]string{"CONFIG", "GET", "d*", "dir"}, "*4\r\n$10\r\ndbfilename\r\n$8\r\ndump.rdb\r\n$3\r\ndir\r\n$4\r\n/tmp\r\n"},
+	})
+}
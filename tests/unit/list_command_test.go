@@ -0,0 +1,222 @@
+package tests
+
+import (
+	"bytes"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/engine"
+	"github.com/codecrafters-io/redis-starter-go/app/rdb"
+	"github.com/codecrafters-io/redis-starter-go/app/server"
+)
+
+// testOption sets up the server returned by newTestServer
+type testOption func(*server.Server)
+
+// withDatabases gives the server count databases instead of one
+func withDatabases(count int) testOption {
+	return func(serv *server.Server) {
+		serv.Dbs = []*engine.DbStore{serv.Db}
+		for i := 1; i < count; i++ {
+			dict := make(map[string]engine.RedisObj)
+			serv.Dbs = append(serv.Dbs, &engine.DbStore{Dict: &dict, Mu: &sync.RWMutex{}})
+		}
+	}
+}
+
+// withCommands runs commands on the server before the test
+func withCommands(commands ...[]string) testOption {
+	return func(serv *server.Server) {
+		for _, args := range commands {
+			runCommand(serv, args...)
+		}
+	}
+}
+
+func newTestServer(options ...testOption) *server.Server {
+	server.InitCommands()
+	dict := make(map[string]engine.RedisObj)
+	serv := &server.Server{
+		Db: &engine.DbStore{
+			Dict: &dict,
+			Mu:   &sync.RWMutex{},
+		},
+	}
+	for _, option := range options {
+		option(serv)
+	}
+	return serv
+}
+
+func runCommand(serv *server.Server, args ...string) string {
+	return runClientCommand(serv, nil, args...)
+}
+
+// runClientCommand runs a command on the connection state of client, a new one when nil
+func runClientCommand(serv *server.Server, client *server.Client, args ...string) string {
+	cmd, err := server.CreateCommand(args[0], args[1:])
+	if err != nil {
+		return err.Error()
+	}
+	request := &server.Request{
+		Serv:   serv,
+		Cmd:    &cmd,
+		Client: client,
+	}
+	out, _ := server.ProcessCommand(request)
+	return string(out)
+}
+
+type commandCase struct {
+	args     []string
+	expected string
+}
+
+func runCases(t *testing.T, serv *server.Server, cases []commandCase) {
+	t.Helper()
+	runClientCases(t, serv, nil, cases)
+}
+
+func runClientCases(t *testing.T, serv *server.Server, client *server.Client, cases []commandCase) {
+	t.Helper()
+	for _, tc := range cases {
+		if got := runClientCommand(serv, client, tc.args...); got != tc.expected {
+			t.Errorf("%v: expected %q, got %q", tc.args, tc.expected, got)
+		}
+	}
+}
+
+func TestListPushPop(t *testing.T) {
+	serv := newTestServer()
+	runCases(t, serv, []commandCase{
+		{[]string{"RPUSH", "list", "a", "b", "c"}, ":3\r\n"},
+		{[]string{"LPUSH", "list", "x", "y"}, ":5\r\n"},
+		{[]string{"LRANGE", "list", "0", "-1"}, "*5\r\n$1\r\ny\r\n$1\r\nx\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+		{[]string{"LPOP", "list"}, "$1\r\ny\r\n"},
+		{[]string{"RPOP", "list", "2"}, "*2\r\n$1\r\nc\r\n$1\r\nb\r\n"},
+		{[]string{"LLEN", "list"}, ":2\r\n"},
+		{[]string{"LPUSHX", "missing", "a"}, ":0\r\n"},
+		{[]string{"LPOP", "missing"}, "$-1\r\n"},
+		{[]string{"LPOP", "missing", "2"}, "*-1\r\n"},
+		{[]string{"RPOP", "list", "5"}, "*2\r\n$1\r\na\r\n$1\r\nx\r\n"},
+		{[]string{"LLEN", "list"}, ":0\r\n"},
+	})
+	if _, ok := (*serv.Db.Dict)["list"]; ok {
+		t.Error("Expected empty list to be deleted")
+	}
+}
+
+func TestListIndexing(t *testing.T) {
+	serv := newTestServer()
+	runCases(t, serv, []commandCase{
+		{[]string{"RPUSH", "list", "a", "b", "c", "d"}, ":4\r\n"},
+		{[]string{"LRANGE", "list", "-2", "100"}, "*2\r\n$1\r\nc\r\n$1\r\nd\r\n"},
+		{[]string{"LRANGE", "list", "3", "1"}, "*0\r\n"},
+		{[]string{"LINDEX", "list", "-1"}, "$1\r\nd\r\n"},
+		{[]string{"LINDEX", "list", "10"}, "$-1\r\n"},
+		{[]string{"LSET", "list", "-4", "z"}, "+OK\r\n"},
+		{[]string{"LSET", "list", "4", "z"}, "-ERR index out of range\r\n"},
+		{[]string{"LSET", "missing", "0", "z"}, "-ERR no such key\r\n"},
+		{[]string{"LTRIM", "list", "1", "-2"}, "+OK\r\n"},
+		{[]string{"LRANGE", "list", "0", "-1"}, "*2\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+		{[]string{"LTRIM", "list", "5", "10"}, "+OK\r\n"},
+		{[]string{"LLEN", "list"}, ":0\r\n"},
+	})
+}
+
+func TestListRemInsertPos(t *testing.T) {
+	serv := newTestServer()
+	runCases(t, serv, []commandCase{
+		{[]string{"RPUSH", "list", "a", "b", "a", "c", "a"}, ":5\r\n"},
+		{[]string{"LREM", "list", "-2", "a"}, ":2\r\n"},
+		{[]string{"LRANGE", "list", "0", "-1"}, "*3\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+		{[]string{"LINSERT", "list", "BEFORE", "b", "x"}, ":4\r\n"},
+		{[]string{"LINSERT", "list", "AFTER", "c", "y"}, ":5\r\n"},
+		{[]string{"LINSERT", "list", "AFTER", "nope", "y"}, ":-1\r\n"},
+		{[]string{"LINSERT", "missing", "AFTER", "c", "y"}, ":0\r\n"},
+		{[]string{"RPUSH", "list", "a"}, ":6\r\n"},
+		{[]string{"LPOS", "list", "a"}, ":0\r\n"},
+		{[]string{"LPOS", "list", "a", "RANK", "-1"}, ":5\r\n"},
+		{[]string{"LPOS", "list", "a", "COUNT", "0"}, "*2\r\n:0\r\n:5\r\n"},
+		{[]string{"LPOS", "list", "a", "COUNT", "0", "MAXLEN", "3"}, "*1\r\n:0\r\n"},
+		{[]string{"LPOS", "list", "nope"}, "$-1\r\n"},
+		{[]string{"LPOS", "list", "a", "RANK", "0"}, "-ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list\r\n"},
+		{[]string{"LREM", "list", "0", "a"}, ":2\r\n"},
+	})
+}
+
+func TestListWrongType(t *testing.T) {
+	serv := newTestServer()
+	runCommand(serv, "SET", "str", "value")
+	wrongType := "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"
+	runCases(t, serv, []commandCase{
+		{[]string{"LPUSH", "str", "a"}, wrongType},
+		{[]string{"LRANGE", "str", "0", "-1"}, wrongType},
+		{[]string{"LPOP", "str"}, wrongType},
+	})
+	runCommand(serv, "RPUSH", "list", "a")
+	if got := runCommand(serv, "GET", "list"); got != wrongType {
+		t.Errorf("Expected WRONGTYPE from GET on a list, got %q", got)
+	}
+}
+
+func TestListPopZero(t *testing.T) {
+	serv := newTestServer()
+	sub := newSubscriberConn(t)
+	setKeyspaceEvents(t, serv, "KA")
+	sub.run(serv, "PSUBSCRIBE", "__keyspace@0__:pz:*")
+	sub.out.expect(t, "*3\r\n$10\r\npsubscribe\r\n$19\r\n__keyspace@0__:pz:*\r\n:1\r\n")
+	runCommand(serv, "RPUSH", "pz:list", "a")
+	sub.out.expect(t, pmessage("__keyspace@0__:pz:*", "__keyspace@0__:pz:list", "rpush"))
+
+	// popping no element neither aborts a watching transaction nor notifies
+	client := &server.Client{}
+	runClientCases(t, serv, client, []commandCase{
+		{[]string{"WATCH", "pz:list"}, "+OK\r\n"},
+	})
+	runCases(t, serv, []commandCase{
+		{[]string{"LPOP", "pz:list", "0"}, "*0\r\n"},
+		{[]string{"RPOP", "pz:list", "0"}, "*0\r\n"},
+	})
+	runClientCases(t, serv, client, []commandCase{
+		{[]string{"MULTI"}, "+OK\r\n"},
+		{[]string{"LLEN", "pz:list"}, "+QUEUED\r\n"},
+		{[]string{"EXEC"}, "*1\r\n:1\r\n"},
+	})
+	runCommand(serv, "PUBLISH", "__keyspace@0__:pz:end", "end")
+	sub.out.expect(t, pmessage("__keyspace@0__:pz:*", "__keyspace@0__:pz:end", "end"))
+}
+
+func TestListRDBRoundTrip(t *testing.T) {
+	dict := map[string]engine.RedisObj{
+		"queue": engine.RedisList{Data: []string{"a", "b", "a"}},
+		"tmp": engine.RedisList{
+			Data:       []string{"x"},
+			Expiration: time.Now().Add(time.Hour),
+		},
+	}
+	data, err := rdb.GenerateRDBBinary(&dict)
+	if err != nil {
+		t.Fatalf("GenerateRDBBinary failed: %v", err)
+	}
+	// SELECTDB 0, RESIZEDB of 2 keys, 1 of them expiring
+	if !bytes.Contains(data, []byte{0xfe, 0x00, 0xfb, 0x02, 0x01}) {
+		t.Errorf("Expected a RESIZEDB of 2 keys with 1 expiring, got %x", data)
+	}
+	path := filepath.Join(t.TempDir(), "dump.rdb")
+	if err := rdb.GenerateRDBFile(&dict, path); err != nil {
+		t.Fatalf("GenerateRDBFile failed: %v", err)
+	}
+	loaded := rdb.Encode(path)
+	queue, ok := loaded["queue"].(engine.RedisList)
+	if !ok || !slices.Equal(queue.Data, []string{"a", "b", "a"}) {
+		t.Errorf("Expected queue to load as the list a b a, got %v", loaded["queue"])
+	}
+	tmp, ok := loaded["tmp"].(engine.RedisList)
+	if !ok || !tmp.HasExpiration() {
+		t.Errorf("Expected tmp to keep its expiration, got %v", loaded["tmp"])
+	}
+}
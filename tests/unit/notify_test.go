@@ -0,0 +1,147 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+	"github.com/codecrafters-io/redis-starter-go/app/server"
+)
+
+// setKeyspaceEvents enables notify-keyspace-events for the test and disables it after
+func setKeyspaceEvents(t *testing.T, serv *server.Server, classes string) {
+	t.Helper()
+	if got := runCommand(serv, "CONFIG", "SET", "notify-keyspace-events", classes); got != "+OK\r\n" {
+		t.Fatalf("CONFIG SET notify-keyspace-events %q: got %q", classes, got)
+	}
+	t.Cleanup(func() { runCommand(serv, "CONFIG", "SET", "notify-keyspace-events", "") })
+}
+
+func pmessage(pattern, channel, payload string) string {
+	return string(resp.ArrayDecoder([]string{"pmessage", pattern, channel, payload}))
+}
+
+func message(channel, payload string) string {
+	return string(resp.ArrayDecoder([]string{"message", channel, payload}))
+}
+
+func TestNotifyKeyspaceEventsConfig(t *testing.T) {
+	serv := newTestServer()
+	t.Cleanup(func() { runCommand(serv, "CONFIG", "SET", "notify-keyspace-events", "") })
+	runCases(t, serv, []commandCase{
+		{[]string{"CONFIG", "SET", "notify-keyspace-events", "KEA"}, "+OK\r\n"},
+		{[]string{"CONFIG", "GET", "notify-keyspace-events"}, "*2\r\n$22\r\nnotify-keyspace-events\r\n$3\r\nAKE\r\n"},
+		{[]string{"CONFIG", "SET", "notify-keyspace-events", "Elg"}, "+OK\r\n"},
+		{[]string{"CONFIG", "GET", "notify-keyspace-events"}, "*2\r\n$22\r\nnotify-keyspace-events\r\n$3\r\nglE\r\n"},
+		{[]string{"CONFIG", "SET", "notify-keyspace-events", "g$lshzxetKm"}, "+OK\r\n"},
+		{[]string{"CONFIG", "GET", "notify-keyspace-events"}, "*2\r\n$22\r\nnotify-keyspace-events\r\n$3\r\nAKm\r\n"},
+		{[]string{"CONFIG", "SET", "notify-keyspace-events", "KQ"},
+			"-ERR CONFIG SET failed (possibly related to argument 'notify-keyspace-events') - Invalid event class character. Use 'Ag$lshzxeKEtm'.\r\n"},
+		{[]string{"CONFIG", "GET", "notify-keyspace-events"}, "*2\r\n$22\r\nnotify-keyspace-events\r\n$3\r\nAKm\r\n"},
+		{[]string{"CONFIG", "SET", "maxmemory", "1mb"}, "-ERR Unknown option or number of arguments for CONFIG SET - 'maxmemory'\r\n"},
+		{[]string{"CONFIG", "SET", "notify-keyspace-events"}, "-ERR wrong number of arguments for 'config|set' command\r\n"},
+		{[]string{"CONFIG", "SET", "notify-keyspace-events", ""}, "+OK\r\n"},
+		{[]string{"CONFIG", "GET", "notify-keyspace-events"}, "*2\r\n$22\r\nnotify-keyspace-events\r\n$0\r\n\r\n"},
+	})
+}
+
+func TestKeyspaceNotifications(t *testing.T) {
+	serv := newTestServer()
+	sub := newSubscriberConn(t)
+	setKeyspaceEvents(t, serv, "KA")
+
+	const pattern = "__keyspace@0__:nt:*"
+	sub.run(serv, "PSUBSCRIBE", pattern)
+	sub.out.expect(t, "*3\r\n$10\r\npsubscribe\r\n$19\r\n"+pattern+"\r\n:1\r\n")
+
+	runCommand(serv, "SET", "nt:s", "v", "EX", "100")
+	runCommand(serv, "INCR", "nt:n")
+	runCommand(serv, "PERSIST", "nt:s")
+	runCommand(serv, "RENAME", "nt:s", "nt:r")
+	runCommand(serv, "DEL", "nt:r", "nt:missing")
+	runCommand(serv, "RPUSH", "nt:l", "a", "b")
+	runCommand(serv, "LPOP", "nt:l", "2")
+	runCommand(serv, "HSET", "nt:h", "f", "v")
+	runCommand(serv, "SADD", "nt:set", "m")
+	runCommand(serv, "SADD", "nt:set", "m")
+	runCommand(serv, "ZADD", "nt:z", "1", "m")
+	runCommand(serv, "XADD", "nt:x", "*", "f", "v")
+	runCommand(serv, "GET", "nt:missing")
+
+	events := []struct{ key, event string }{
+		{"nt:s", "set"}, {"nt:s", "expire"}, {"nt:n", "incrby"}, {"nt:s", "persist"},
+		{"nt:s", "rename_from"}, {"nt:r", "rename_to"}, {"nt:r", "del"},
+		{"nt:l", "rpush"}, {"nt:l", "lpop"}, {"nt:l", "del"},
+		{"nt:h", "hset"}, {"nt:set", "sadd"}, {"nt:z", "zadd"}, {"nt:x", "xadd"},
+	}
+	want := ""
+	for _, e := range events {
+		want += pmessage(pattern, "__keyspace@0__:"+e.key, e.event)
+	}
+	sub.out.expect(t, want)
+
+	// SADD of an existing member and GET of a missing key notified nothing
+	runCommand(serv, "PUBLISH", "__keyspace@0__:nt:end", "end")
+	sub.out.expect(t, pmessage(pattern, "__keyspace@0__:nt:end", "end"))
+}
+
+func TestKeyeventNotifications(t *testing.T) {
+	serv := newTestServer()
+	sub := newSubscriberConn(t)
+	setKeyspaceEvents(t, serv, "E$")
+
+	sub.run(serv, "SUBSCRIBE", "__keyevent@0__:set", "__keyevent@0__:del")
+	sub.out.expect(t, "*3\r\n$9\r\nsubscribe\r\n$18\r\n__keyevent@0__:set\r\n:1\r\n"+
+		"*3\r\n$9\r\nsubscribe\r\n$18\r\n__keyevent@0__:del\r\n:2\r\n")
+	sub.run(serv, "PSUBSCRIBE", "__keyspace@0__:nt:*")
+	sub.out.expect(t, "*3\r\n$10\r\npsubscribe\r\n$19\r\n__keyspace@0__:nt:*\r\n:3\r\n")
+
+	// generic events and keyspace channels are not enabled
+	runCommand(serv, "SET", "nt:a", "v")
+	runCommand(serv, "DEL", "nt:a")
+	runCommand(serv, "MSET", "nt:b", "1", "nt:c", "2")
+	sub.out.expect(t, message("__keyevent@0__:set", "nt:a")+
+		message("__keyevent@0__:set", "nt:b")+message("__keyevent@0__:set", "nt:c"))
+
+	setKeyspaceEvents(t, serv, "Eg")
+	runCommand(serv, "DEL", "nt:b")
+	sub.out.expect(t, message("__keyevent@0__:del", "nt:b"))
+}
+
+func TestKeyMissNotifications(t *testing.T) {
+	serv := newTestServer()
+	sub := newSubscriberConn(t)
+	setKeyspaceEvents(t, serv, "Em")
+
+	sub.run(serv, "SUBSCRIBE", "__keyevent@0__:keymiss")
+	sub.out.expect(t, "*3\r\n$9\r\nsubscribe\r\n$22\r\n__keyevent@0__:keymiss\r\n:1\r\n")
+
+	runCommand(serv, "SET", "nt:a", "v")
+	runCommand(serv, "GET", "nt:a")
+	runCommand(serv, "GET", "nt:missing")
+	runCommand(serv, "MGET", "nt:a", "nt:m1", "nt:m2")
+	runCommand(serv, "LRANGE", "nt:list", "0", "-1")
+	runCommand(serv, "HGET", "nt:hash", "f")
+	sub.out.expect(t, message("__keyevent@0__:keymiss", "nt:missing")+
+		message("__keyevent@0__:keymiss", "nt:m1")+message("__keyevent@0__:keymiss", "nt:m2")+
+		message("__keyevent@0__:keymiss", "nt:list")+message("__keyevent@0__:keymiss", "nt:hash"))
+}
+
+func TestExpiredNotifications(t *testing.T) {
+	serv := newTestServer()
+	sub := newSubscriberConn(t)
+	setKeyspaceEvents(t, serv, "Ex")
+
+	sub.run(serv, "SUBSCRIBE", "__keyevent@0__:expired")
+	sub.out.expect(t, "*3\r\n$9\r\nsubscribe\r\n$22\r\n__keyevent@0__:expired\r\n:1\r\n")
+
+	runCommand(serv, "SET", "nt:active", "v", "PX", "1")
+	runCommand(serv, "SET", "nt:lazy", "v", "PX", "1")
+	time.Sleep(5 * time.Millisecond)
+
+	// a lookup deletes the key it finds expired
+	runCommand(serv, "GET", "nt:lazy")
+	sub.out.expect(t, message("__keyevent@0__:expired", "nt:lazy"))
+	server.ActiveExpireCycle(serv)
+	sub.out.expect(t, message("__keyevent@0__:expired", "nt:active"))
+}
@@ -0,0 +1,206 @@
+package tests
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// take returns what the connection received so far, and consumes it
+func (o *connOutput) take() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	out := o.buf.String()
+	o.buf.Reset()
+	return out
+}
+
+// helloReply is the reply of HELLO on a master, a map in RESP3 and a flat array in RESP2
+func helloReply(proto int, id int) string {
+	fields := [][]byte{
+		resp.BulkStringDecoder("server"), resp.BulkStringDecoder("redis"),
+		resp.BulkStringDecoder("version"), resp.BulkStringDecoder("7.4.0"),
+		resp.BulkStringDecoder("proto"), resp.IntegerDecoder(proto),
+		resp.BulkStringDecoder("id"), resp.IntegerDecoder(id),
+		resp.BulkStringDecoder("mode"), resp.BulkStringDecoder("standalone"),
+		resp.BulkStringDecoder("role"), resp.BulkStringDecoder("master"),
+		resp.BulkStringDecoder("modules"), resp.ArrayDecoder(nil),
+	}
+	if proto == 3 {
+		return string(resp.RawMapDecoder(fields))
+	}
+	return string(resp.RawArrayDecoder(fields))
+}
+
+func TestHello(t *testing.T) {
+	serv := newTestServer()
+	conn := newSubscriberConn(t)
+
+	conn.run(serv, "CLIENT", "ID")
+	reply := conn.out.take()
+	id, err := strconv.Atoi(reply[1 : len(reply)-2])
+	if err != nil {
+		t.Fatalf("CLIENT ID: got %q", reply)
+	}
+
+	cases := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"HELLO"}, helloReply(2, id)},
+		{[]string{"HELLO", "4"}, "-NOPROTO unsupported protocol version\r\n"},
+		{[]string{"HELLO", "three"}, "-ERR Protocol version is not an integer or out of range\r\n"},
+		{[]string{"HELLO", "3", "AUTH", "default"}, "-ERR Syntax error in HELLO option 'AUTH'\r\n"},
+		{[]string{"HELLO", "3", "AUTH", "bob", "secret"}, "-WRONGPASS invalid username-password pair or user is disabled.\r\n"},
+		{[]string{"HELLO", "3", "SETNAME", "my app"}, "-ERR Client names cannot contain spaces, newlines or special characters.\r\n"},
+		// a failed HELLO changes nothing
+		{[]string{"HGETALL", "missing"}, "*0\r\n"},
+		{[]string{"CLIENT", "GETNAME"}, "$-1\r\n"},
+
+		{[]string{"HELLO", "3", "AUTH", "default", "secret", "SETNAME", "app"}, helloReply(3, id)},
+		{[]string{"CLIENT", "GETNAME"}, "$3\r\napp\r\n"},
+		{[]string{"HSET", "h", "f", "v"}, ":1\r\n"},
+		{[]string{"HGETALL", "h"}, "%1\r\n$1\r\nf\r\n$1\r\nv\r\n"},
+		{[]string{"HGETALL", "missing"}, "%0\r\n"},
+		{[]string{"CONFIG", "SET", "notify-keyspace-events", ""}, "+OK\r\n"},
+		{[]string{"CONFIG", "GET", "notify-keyspace-*"}, "%1\r\n$22\r\nnotify-keyspace-events\r\n$0\r\n\r\n"},
+		{[]string{"GET", "missing"}, "_\r\n"},
+		{[]string{"CLIENT", "SETNAME", ""}, "+OK\r\n"},
+		{[]string{"CLIENT", "GETNAME"}, "_\r\n"},
+		{[]string{"CLIENT", "KILL"}, "-ERR unknown subcommand 'KILL'. Try CLIENT HELP.\r\n"},
+
+		{[]string{"HELLO", "2"}, helloReply(2, id)},
+		{[]string{"HGETALL", "h"}, "*2\r\n$1\r\nf\r\n$1\r\nv\r\n"},
+		{[]string{"GET", "missing"}, "$-1\r\n"},
+	}
+	for _, c := range cases {
+		conn.run(serv, c.args...)
+		if got := conn.out.take(); got != c.expected {
+			t.Errorf("%v: expected %q, got %q", c.args, c.expected, got)
+		}
+	}
+}
+
+func TestResp3PubSub(t *testing.T) {
+	serv := newTestServer()
+	sub3 := newSubscriberConn(t)
+	sub2 := newSubscriberConn(t)
+
+	sub3.run(serv, "HELLO", "3")
+	sub3.out.take()
+	sub3.run(serv, "SUBSCRIBE", "p3:news")
+	sub3.out.expect(t, ">3\r\n$9\r\nsubscribe\r\n$7\r\np3:news\r\n:1\r\n")
+	sub3.run(serv, "PSUBSCRIBE", "p3:*")
+	sub3.out.expect(t, ">3\r\n$10\r\npsubscribe\r\n$4\r\np3:*\r\n:2\r\n")
+	sub2.run(serv, "SUBSCRIBE", "p3:news")
+	sub2.out.expect(t, "*3\r\n$9\r\nsubscribe\r\n$7\r\np3:news\r\n:1\r\n")
+
+	// each subscriber gets the message in its own protocol
+	runCommand(serv, "PUBLISH", "p3:news", "hi")
+	sub3.out.expect(t, ">3\r\n$7\r\nmessage\r\n$7\r\np3:news\r\n$2\r\nhi\r\n"+
+		">4\r\n$8\r\npmessage\r\n$4\r\np3:*\r\n$7\r\np3:news\r\n$2\r\nhi\r\n")
+	sub2.out.expect(t, "*3\r\n$7\r\nmessage\r\n$7\r\np3:news\r\n$2\r\nhi\r\n")
+
+	// a RESP3 subscriber runs any command
+	sub3.run(serv, "GET", "p3:missing")
+	sub3.out.expect(t, "_\r\n")
+	sub3.run(serv, "PING")
+	sub3.out.expect(t, "+PONG\r\n")
+	sub2.run(serv, "GET", "p3:missing")
+	sub2.out.expect(t, "-ERR Can't execute 'get': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT are allowed in this context\r\n")
+
+	sub3.run(serv, "UNSUBSCRIBE")
+	sub3.out.expect(t, ">3\r\n$11\r\nunsubscribe\r\n$7\r\np3:news\r\n:1\r\n")
+	sub3.run(serv, "UNSUBSCRIBE")
+	sub3.out.expect(t, ">3\r\n$11\r\nunsubscribe\r\n_\r\n:1\r\n")
+}
+
+func TestResp3ReplyTypes(t *testing.T) {
+	serv := newTestServer()
+	conn := newSubscriberConn(t)
+	conn.run(serv, "HELLO", "3")
+	conn.out.take()
+
+	cases := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"SADD", "s", "a"}, ":1\r\n"},
+		{[]string{"SMEMBERS", "s"}, "~1\r\n$1\r\na\r\n"},
+		{[]string{"SINTER", "s"}, "~1\r\n$1\r\na\r\n"},
+		{[]string{"SUNION", "s", "missing"}, "~1\r\n$1\r\na\r\n"},
+		{[]string{"SDIFF", "s", "s"}, "~0\r\n"},
+		{[]string{"ZADD", "z", "1.5", "m"}, ":1\r\n"},
+		{[]string{"ZSCORE", "z", "m"}, ",1.5\r\n"},
+		{[]string{"ZINCRBY", "z", "1", "m"}, ",2.5\r\n"},
+		{[]string{"ZADD", "z", "INCR", "1", "m"}, ",3.5\r\n"},
+		{[]string{"ZADD", "z", "NX", "INCR", "1", "m"}, "_\r\n"},
+		{[]string{"ZMSCORE", "z", "m", "x"}, "*2\r\n,3.5\r\n_\r\n"},
+		{[]string{"ZADD", "z", "1", "n"}, ":1\r\n"},
+		{[]string{"ZRANGE", "z", "0", "-1", "WITHSCORES"}, "*2\r\n*2\r\n$1\r\nn\r\n,1\r\n*2\r\n$1\r\nm\r\n,3.5\r\n"},
+		{[]string{"ZRANGE", "z", "0", "-1"}, "*2\r\n$1\r\nn\r\n$1\r\nm\r\n"},
+		{[]string{"ZRANGEBYSCORE", "z", "2", "+inf", "WITHSCORES"}, "*1\r\n*2\r\n$1\r\nm\r\n,3.5\r\n"},
+		{[]string{"ZRANK", "z", "m", "WITHSCORE"}, "*2\r\n:1\r\n,3.5\r\n"},
+		{[]string{"ZREVRANK", "z", "m", "WITHSCORE"}, "*2\r\n:0\r\n,3.5\r\n"},
+		{[]string{"ZADD", "p", "1", "a", "2", "b", "3", "c"}, ":3\r\n"},
+		{[]string{"ZPOPMIN", "p"}, "*2\r\n$1\r\na\r\n,1\r\n"},
+		{[]string{"ZPOPMAX", "p", "1"}, "*1\r\n*2\r\n$1\r\nc\r\n,3\r\n"},
+		{[]string{"ZPOPMIN", "p", "5"}, "*1\r\n*2\r\n$1\r\nb\r\n,2\r\n"},
+		{[]string{"ZPOPMIN", "p"}, "*0\r\n"},
+		{[]string{"HSET", "h", "f", "v"}, ":1\r\n"},
+		{[]string{"HRANDFIELD", "h", "1", "WITHVALUES"}, "%1\r\n$1\r\nf\r\n$1\r\nv\r\n"},
+		{[]string{"HRANDFIELD", "h", "1"}, "*1\r\n$1\r\nf\r\n"},
+		{[]string{"HMGET", "h", "f", "x"}, "*2\r\n$1\r\nv\r\n_\r\n"},
+		{[]string{"SET", "k", "v"}, "+OK\r\n"},
+		{[]string{"MGET", "k", "missing"}, "*2\r\n$1\r\nv\r\n_\r\n"},
+		{[]string{"MULTI"}, "+OK\r\n"},
+		{[]string{"GET", "missing"}, "+QUEUED\r\n"},
+		{[]string{"MGET", "missing"}, "+QUEUED\r\n"},
+		{[]string{"EXEC"}, "*2\r\n_\r\n*1\r\n_\r\n"},
+		{[]string{"XADD", "x", "1-1", "f", "v"}, "$3\r\n1-1\r\n"},
+		{[]string{"XGROUP", "CREATE", "x", "g", "$"}, "+OK\r\n"},
+		{[]string{"XGROUP", "CREATECONSUMER", "x", "g", "c"}, ":1\r\n"},
+		{[]string{"XINFO", "GROUPS", "x"}, "*1\r\n%6\r\n$4\r\nname\r\n$1\r\ng\r\n$9\r\nconsumers\r\n:1\r\n$7\r\npending\r\n:0\r\n" +
+			"$17\r\nlast-delivered-id\r\n$3\r\n1-1\r\n$12\r\nentries-read\r\n:1\r\n$3\r\nlag\r\n:0\r\n"},
+	}
+	for _, c := range cases {
+		conn.run(serv, c.args...)
+		if got := conn.out.take(); got != c.expected {
+			t.Errorf("%v: expected %q, got %q", c.args, c.expected, got)
+		}
+	}
+	conn.run(serv, "XINFO", "STREAM", "x")
+	if got := conn.out.take(); !strings.HasPrefix(got, "%10\r\n$6\r\nlength\r\n:1\r\n") {
+		t.Errorf("Expected XINFO STREAM to reply with a map, got %q", got)
+	}
+	conn.run(serv, "XINFO", "CONSUMERS", "x", "g")
+	if got := conn.out.take(); !strings.HasPrefix(got, "*1\r\n%4\r\n$4\r\nname\r\n$1\r\nc\r\n") {
+		t.Errorf("Expected XINFO CONSUMERS to reply with maps, got %q", got)
+	}
+	conn.run(serv, "INFO", "stats")
+	if got := conn.out.take(); !strings.HasPrefix(got, "=") || !strings.Contains(got, "\r\ntxt:# Stats") {
+		t.Errorf("Expected INFO to reply with a verbatim string, got %q", got)
+	}
+
+	// RESP2 keeps the shapes of before
+	conn.run(serv, "HELLO", "2")
+	conn.out.take()
+	for _, c := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"SMEMBERS", "s"}, "*1\r\n$1\r\na\r\n"},
+		{[]string{"ZSCORE", "z", "m"}, "$3\r\n3.5\r\n"},
+		{[]string{"ZRANGE", "z", "0", "-1", "WITHSCORES"}, "*4\r\n$1\r\nn\r\n$1\r\n1\r\n$1\r\nm\r\n$3\r\n3.5\r\n"},
+		{[]string{"ZRANK", "z", "m", "WITHSCORE"}, "*2\r\n:1\r\n$3\r\n3.5\r\n"},
+		{[]string{"HRANDFIELD", "h", "1", "WITHVALUES"}, "*2\r\n$1\r\nf\r\n$1\r\nv\r\n"},
+		{[]string{"MGET", "k", "missing"}, "*2\r\n$1\r\nv\r\n$-1\r\n"},
+	} {
+		conn.run(serv, c.args...)
+		if got := conn.out.take(); got != c.expected {
+			t.Errorf("%v: expected %q, got %q", c.args, c.expected, got)
+		}
+	}
+}
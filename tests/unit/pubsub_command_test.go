@@ -0,0 +1,250 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/server"
+)
+
+// connOutput collects what is written to a connection by its subscriber output
+type connOutput struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (o *connOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.Write(p)
+}
+
+// expect waits for the connection to receive want, and consumes it
+func (o *connOutput) expect(t *testing.T, want string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		o.mu.Lock()
+		got := o.buf.String()
+		if len(got) >= len(want) || time.Now().After(deadline) {
+			o.buf.Next(len(want))
+			o.mu.Unlock()
+			if !strings.HasPrefix(got, want) {
+				t.Fatalf("expected output %q, got %q", want, got)
+			}
+			return
+		}
+		o.mu.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// subscriberConn is a client whose replies are written to its output, as on a connection
+type subscriberConn struct {
+	client *server.Client
+	writer *bufio.Writer
+	out    *connOutput
+}
+
+func newSubscriberConn(t *testing.T) *subscriberConn {
+	out := &connOutput{}
+	conn := &subscriberConn{client: &server.Client{}, writer: bufio.NewWriter(out), out: out}
+	t.Cleanup(conn.client.Close)
+	return conn
+}
+
+// run runs a command and writes its reply the way the connection does
+func (c *subscriberConn) run(serv *server.Server, args ...string) {
+	cmd, _ := server.CreateCommand(args[0], args[1:])
+	request := &server.Request{Serv: serv, Cmd: &cmd, Client: c.client, Writer: c.writer}
+	out, _ := server.ProcessCommand(request)
+	c.client.Reply(c.writer, out)
+}
+
+func TestPubSub(t *testing.T) {
+	serv := newTestServer()
+	sub := newSubscriberConn(t)
+
+	sub.run(serv, "SUBSCRIBE", "ps:news", "ps:sport")
+	sub.out.expect(t, "*3\r\n$9\r\nsubscribe\r\n$7\r\nps:news\r\n:1\r\n"+
+		"*3\r\n$9\r\nsubscribe\r\n$8\r\nps:sport\r\n:2\r\n")
+	sub.run(serv, "PSUBSCRIBE", "ps:n*")
+	sub.out.expect(t, "*3\r\n$10\r\npsubscribe\r\n$5\r\nps:n*\r\n:3\r\n")
+
+	runCases(t, serv, []commandCase{
+		{[]string{"PUBLISH", "ps:news", "hello"}, ":2\r\n"},
+		{[]string{"PUBLISH", "ps:sport", "goal"}, ":1\r\n"},
+		{[]string{"PUBLISH", "ps:weather", "rain"}, ":0\r\n"},
+		{[]string{"PUBSUB", "CHANNELS", "ps:*"}, "*2\r\n$7\r\nps:news\r\n$8\r\nps:sport\r\n"},
+		{[]string{"PUBSUB", "NUMSUB", "ps:news", "ps:none"}, "*4\r\n$7\r\nps:news\r\n:1\r\n$7\r\nps:none\r\n:0\r\n"},
+		{[]string{"PUBSUB", "HELP"}, "-ERR unknown subcommand 'HELP'. Try PUBSUB HELP.\r\n"},
+	})
+	sub.out.expect(t, "*3\r\n$7\r\nmessage\r\n$7\r\nps:news\r\n$5\r\nhello\r\n"+
+		"*4\r\n$8\r\npmessage\r\n$5\r\nps:n*\r\n$7\r\nps:news\r\n$5\r\nhello\r\n"+
+		"*3\r\n$7\r\nmessage\r\n$8\r\nps:sport\r\n$4\r\ngoal\r\n")
+
+	// subscriber mode
+	sub.run(serv, "GET", "k")
+	sub.out.expect(t, "-ERR Can't execute 'get': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT are allowed in this context\r\n")
+	sub.run(serv, "PING")
+	sub.out.expect(t, "*2\r\n$4\r\npong\r\n$0\r\n\r\n")
+	sub.run(serv, "PING", "hi")
+	sub.out.expect(t, "*2\r\n$4\r\npong\r\n$2\r\nhi\r\n")
+
+	sub.run(serv, "UNSUBSCRIBE")
+	sub.out.expect(t, "*3\r\n$11\r\nunsubscribe\r\n$7\r\nps:news\r\n:2\r\n"+
+		"*3\r\n$11\r\nunsubscribe\r\n$8\r\nps:sport\r\n:1\r\n")
+	sub.run(serv, "PUNSUBSCRIBE", "ps:n*")
+	sub.out.expect(t, "*3\r\n$12\r\npunsubscribe\r\n$5\r\nps:n*\r\n:0\r\n")
+	sub.run(serv, "UNSUBSCRIBE")
+	sub.out.expect(t, "*3\r\n$11\r\nunsubscribe\r\n$-1\r\n:0\r\n")
+
+	// out of subscriber mode, replies keep going through the output
+	sub.run(serv, "PING")
+	sub.out.expect(t, "+PONG\r\n")
+	runCases(t, serv, []commandCase{
+		{[]string{"PUBLISH", "ps:news", "hello"}, ":0\r\n"},
+		{[]string{"PUBSUB", "CHANNELS", "ps:*"}, "*0\r\n"},
+	})
+}
+
+func TestShardedPubSub(t *testing.T) {
+	serv := newTestServer()
+	sub := newSubscriberConn(t)
+
+	sub.run(serv, "SSUBSCRIBE", "ps:orders", "ps:users")
+	sub.out.expect(t, "*3\r\n$10\r\nssubscribe\r\n$9\r\nps:orders\r\n:1\r\n"+
+		"*3\r\n$10\r\nssubscribe\r\n$8\r\nps:users\r\n:2\r\n")
+	// shard channels are counted apart from channels and patterns
+	sub.run(serv, "SUBSCRIBE", "ps:orders")
+	sub.out.expect(t, "*3\r\n$9\r\nsubscribe\r\n$9\r\nps:orders\r\n:1\r\n")
+	sub.run(serv, "PSUBSCRIBE", "ps:*")
+	sub.out.expect(t, "*3\r\n$10\r\npsubscribe\r\n$4\r\nps:*\r\n:2\r\n")
+
+	runCases(t, serv, []commandCase{
+		{[]string{"SPUBLISH", "ps:orders", "created"}, ":1\r\n"},
+		{[]string{"SPUBLISH", "ps:none", "lost"}, ":0\r\n"},
+		{[]string{"PUBSUB", "SHARDCHANNELS"}, "*2\r\n$9\r\nps:orders\r\n$8\r\nps:users\r\n"},
+		{[]string{"PUBSUB", "SHARDCHANNELS", "ps:u*"}, "*1\r\n$8\r\nps:users\r\n"},
+		{[]string{"PUBSUB", "SHARDNUMSUB", "ps:orders", "ps:none"}, "*4\r\n$9\r\nps:orders\r\n:1\r\n$7\r\nps:none\r\n:0\r\n"},
+		{[]string{"PUBSUB", "CHANNELS", "ps:*"}, "*1\r\n$9\r\nps:orders\r\n"},
+	})
+	// neither the classic channel nor the pattern receive shard messages
+	sub.out.expect(t, "*3\r\n$8\r\nsmessage\r\n$9\r\nps:orders\r\n$7\r\ncreated\r\n")
+	sub.run(serv, "SET", "k", "v")
+	sub.out.expect(t, "-ERR Can't execute 'set': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT are allowed in this context\r\n")
+
+	sub.run(serv, "UNSUBSCRIBE")
+	sub.out.expect(t, "*3\r\n$11\r\nunsubscribe\r\n$9\r\nps:orders\r\n:1\r\n")
+	sub.run(serv, "PUNSUBSCRIBE")
+	sub.out.expect(t, "*3\r\n$12\r\npunsubscribe\r\n$4\r\nps:*\r\n:0\r\n")
+	// still in subscriber mode through the shard channels
+	sub.run(serv, "PING")
+	sub.out.expect(t, "*2\r\n$4\r\npong\r\n$0\r\n\r\n")
+	sub.run(serv, "SUNSUBSCRIBE", "ps:users", "ps:none")
+	sub.out.expect(t, "*3\r\n$12\r\nsunsubscribe\r\n$8\r\nps:users\r\n:1\r\n"+
+		"*3\r\n$12\r\nsunsubscribe\r\n$7\r\nps:none\r\n:1\r\n")
+	sub.run(serv, "SUNSUBSCRIBE")
+	sub.out.expect(t, "*3\r\n$12\r\nsunsubscribe\r\n$9\r\nps:orders\r\n:0\r\n")
+	sub.run(serv, "SUNSUBSCRIBE")
+	sub.out.expect(t, "*3\r\n$12\r\nsunsubscribe\r\n$-1\r\n:0\r\n")
+	sub.run(serv, "PING")
+	sub.out.expect(t, "+PONG\r\n")
+}
+
+func TestPubSubClose(t *testing.T) {
+	serv := newTestServer()
+	sub := newSubscriberConn(t)
+	sub.run(serv, "SUBSCRIBE", "ps:closed")
+	sub.run(serv, "PSUBSCRIBE", "ps:closed*")
+	sub.run(serv, "SSUBSCRIBE", "ps:closed")
+	sub.out.expect(t, "*3\r\n$9\r\nsubscribe\r\n$9\r\nps:closed\r\n:1\r\n"+
+		"*3\r\n$10\r\npsubscribe\r\n$10\r\nps:closed*\r\n:2\r\n"+
+		"*3\r\n$10\r\nssubscribe\r\n$9\r\nps:closed\r\n:1\r\n")
+	runCases(t, serv, []commandCase{
+		{[]string{"PUBLISH", "ps:closed", "x"}, ":2\r\n"},
+		{[]string{"SPUBLISH", "ps:closed", "x"}, ":1\r\n"},
+	})
+
+	sub.client.Close()
+	runCases(t, serv, []commandCase{
+		{[]string{"PUBLISH", "ps:closed", "x"}, ":0\r\n"},
+		{[]string{"SPUBLISH", "ps:closed", "x"}, ":0\r\n"},
+		{[]string{"PUBSUB", "NUMSUB", "ps:closed"}, "*2\r\n$9\r\nps:closed\r\n:0\r\n"},
+		{[]string{"PUBSUB", "SHARDNUMSUB", "ps:closed"}, "*2\r\n$9\r\nps:closed\r\n:0\r\n"},
+	})
+}
+
+func TestSlowSubscriberIsDisconnected(t *testing.T) {
+	serv := newTestServer()
+	// nothing reads the other end, writes to the connection block
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	client := &server.Client{}
+	defer client.Close()
+	cmd, _ := server.CreateCommand("SUBSCRIBE", []string{"ps:slow"})
+	server.ProcessCommand(&server.Request{Serv: serv, Cmd: &cmd, Client: client, Conn: &conn, Writer: bufio.NewWriter(conn)})
+	// once the confirmation is read, the output blocks on its next write for good
+	confirmation := "*3\r\n$9\r\nsubscribe\r\n$7\r\nps:slow\r\n:1\r\n"
+	buf := make([]byte, len(confirmation))
+	peer.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.ReadFull(peer, buf); err != nil || string(buf) != confirmation {
+		t.Fatalf("expected the confirmation %q, got %q (%v)", confirmation, buf, err)
+	}
+
+	// the blocked write holds at most the limit, and the queue behind it passes the limit
+	// before 80 MB were published
+	message := strings.Repeat("x", 1024*1024)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 80; i++ {
+			runCommand(serv, "PUBLISH", "ps:slow", message)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("PUBLISH blocked on a slow subscriber")
+	}
+	conn.SetWriteDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Write([]byte("x")); !errors.Is(err, io.ErrClosedPipe) {
+		t.Error("expected the slow subscriber to be disconnected")
+	}
+}
+
+func TestPubSubInTransaction(t *testing.T) {
+	serv := newTestServer()
+	client := &server.Client{}
+	runClientCases(t, serv, client, []commandCase{
+		{[]string{"MULTI"}, "+OK\r\n"},
+		{[]string{"SUBSCRIBE", "ps:multi"}, "-ERR Command not allowed inside a transaction\r\n"},
+		{[]string{"SSUBSCRIBE", "ps:multi"}, "-ERR Command not allowed inside a transaction\r\n"},
+		{[]string{"PUBLISH", "ps:multi", "x"}, "+QUEUED\r\n"},
+		{[]string{"EXEC"}, "-EXECABORT Transaction discarded because of previous errors.\r\n"},
+	})
+}
+
+func TestPublishIsPropagated(t *testing.T) {
+	serv := newTestServer()
+	replica := &server.Replica{Pending: true}
+	serv.ConnectedReplica = &[]*server.Replica{replica}
+	serv.Role = server.Master
+
+	runCases(t, serv, []commandCase{
+		{[]string{"PUBLISH", "ps:replicated", "x"}, ":0\r\n"},
+		{[]string{"SPUBLISH", "ps:replicated", "y"}, ":0\r\n"},
+	})
+	want := "*3\r\n$7\r\nPUBLISH\r\n$13\r\nps:replicated\r\n$1\r\nx\r\n" +
+		"*3\r\n$8\r\nSPUBLISH\r\n$13\r\nps:replicated\r\n$1\r\ny\r\n"
+	if got := replica.Buffer.String(); !strings.HasSuffix(got, want) {
+		t.Errorf("expected PUBLISH and SPUBLISH to be propagated, got %q", got)
+	}
+}
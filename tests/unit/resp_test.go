@@ -1,6 +1,8 @@
 package tests
 
 import (
+	"math"
+	"math/big"
 	"testing"
 
 	"github.com/codecrafters-io/redis-starter-go/app/resp"
@@ -115,6 +117,39 @@ func TestArrayDecoder(t *testing.T) {
 	}
 }
 
+func TestRESP3Decoders(t *testing.T) {
+	bigNum, _ := new(big.Int).SetString("3492890328409238509324850943850943825024385", 10)
+	pair := [][]byte{resp.BulkStringDecoder("key"), resp.IntegerDecoder(1)}
+	tests := []struct {
+		name     string
+		result   []byte
+		expected string
+	}{
+		{"Null", resp.NullDecoder(), "_\r\n"},
+		{"True", resp.BooleanDecoder(true), "#t\r\n"},
+		{"False", resp.BooleanDecoder(false), "#f\r\n"},
+		{"Double", resp.DoubleDecoder(3.25), ",3.25\r\n"},
+		{"Integral double", resp.DoubleDecoder(10), ",10\r\n"},
+		{"Infinite double", resp.DoubleDecoder(math.Inf(-1)), ",-inf\r\n"},
+		{"Big number", resp.BigNumberDecoder(bigNum), "(3492890328409238509324850943850943825024385\r\n"},
+		{"Verbatim string", resp.VerbatimStringDecoder("txt", "Some string"), "=15\r\ntxt:Some string\r\n"},
+		{"Map", resp.MapDecoder([]string{"a", "1", "b", "2"}), "%2\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\nb\r\n$1\r\n2\r\n"},
+		{"Empty map", resp.MapDecoder(nil), "%0\r\n"},
+		{"Raw map", resp.RawMapDecoder(pair), "%1\r\n$3\r\nkey\r\n:1\r\n"},
+		{"Set", resp.SetDecoder([]string{"x"}), "~1\r\n$1\r\nx\r\n"},
+		{"Attribute", resp.AttributeDecoder(pair), "|1\r\n$3\r\nkey\r\n:1\r\n"},
+		{"Push", resp.PushDecoder(pair), ">2\r\n$3\r\nkey\r\n:1\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if string(tt.result) != tt.expected {
+				t.Errorf("got %q, want %q", tt.result, tt.expected)
+			}
+		})
+	}
+}
+
 // Benchmarks
 func BenchmarkSimpleStringDecoder(b *testing.B) {
 	for i := 0; i < b.N; i++ {
@@ -158,3 +193,26 @@ func BenchmarkArrayDecoderLarge(b *testing.B) {
 		resp.ArrayDecoder(arr)
 	}
 }
+
+func TestReplaceNils(t *testing.T) {
+	tests := []struct {
+		name     string
+		reply    string
+		expected string
+	}{
+		{"Nil", "$-1\r\n", "_\r\n"},
+		{"Nil array", "*-1\r\n", "_\r\n"},
+		{"No nil", "*1\r\n$2\r\n-1\r\n", "*1\r\n$2\r\n-1\r\n"},
+		{"Nested", "*3\r\n$1\r\na\r\n$-1\r\n*2\r\n:-1\r\n*-1\r\n", "*3\r\n$1\r\na\r\n_\r\n*2\r\n:-1\r\n_\r\n"},
+		{"Map", "%1\r\n$1\r\nk\r\n$-1\r\n", "%1\r\n$1\r\nk\r\n_\r\n"},
+		{"Several replies", "$-1\r\n+OK\r\n$-1\r\n", "_\r\n+OK\r\n_\r\n"},
+		{"Truncated", "*2\r\n$-1\r\n", "*2\r\n$-1\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(resp.ReplaceNils([]byte(tt.reply))); got != tt.expected {
+				t.Errorf("got %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package tests
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/engine"
+	"github.com/codecrafters-io/redis-starter-go/app/server"
+)
+
+// parseScanReply splits a scan reply into its cursor and elements
+func parseScanReply(t *testing.T, reply string) (string, []string) {
+	t.Helper()
+	lines := strings.Split(strings.TrimSuffix(reply, "\r\n"), "\r\n")
+	if len(lines) < 4 || lines[0] != "*2" || !strings.HasPrefix(lines[3], "*") {
+		t.Fatalf("Expected a scan reply, got %q", reply)
+	}
+	var elements []string
+	for i := 5; i < len(lines); i += 2 {
+		elements = append(elements, lines[i])
+	}
+	return lines[2], elements
+}
+
+// scanAll runs a scan command, cursor excluded from args, until the iteration is complete
+func scanAll(t *testing.T, serv *server.Server, cmd string, args ...string) []string {
+	t.Helper()
+	var all []string
+	cursor := "0"
+	for calls := 0; ; calls++ {
+		if calls > 10000 {
+			t.Fatalf("Expected %s to complete", cmd)
+		}
+		var full []string
+		if cmd == "SCAN" {
+			full = append([]string{cmd, cursor}, args...)
+		} else {
+			full = append([]string{cmd, args[0], cursor}, args[1:]...)
+		}
+		var elements []string
+		cursor, elements = parseScanReply(t, runCommand(serv, full...))
+		all = append(all, elements...)
+		if cursor == "0" {
+			return all
+		}
+	}
+}
+
+func sortedSet(elements []string) []string {
+	sorted := slices.Clone(elements)
+	slices.Sort(sorted)
+	return slices.Compact(sorted)
+}
+
+func TestScan(t *testing.T) {
+	serv := newTestServer()
+	var want []string
+	for i := 0; i < 500; i++ {
+		key := "key:" + strconv.Itoa(i)
+		want = append(want, key)
+		runCommand(serv, "SET", key, "v")
+	}
+	runCommand(serv, "RPUSH", "list", "x")
+	runCommand(serv, "SET", "gone", "v", "PX", "1")
+	time.Sleep(5 * time.Millisecond)
+
+	cursor, first := parseScanReply(t, runCommand(serv, "SCAN", "0", "COUNT", "20"))
+	if cursor == "0" || len(first) == 0 || len(first) > 60 {
+		t.Errorf("Expected a partial first page, got cursor %s and %d keys", cursor, len(first))
+	}
+	want = append(want, "list")
+	if got := sortedSet(scanAll(t, serv, "SCAN", "COUNT", "20")); !slices.Equal(got, sortedSet(want)) {
+		t.Errorf("Expected every live key, got %d keys", len(got))
+	}
+	if got := sortedSet(scanAll(t, serv, "SCAN", "MATCH", "key:1?", "COUNT", "50")); len(got) != 10 {
+		t.Errorf("Expected the 10 keys matching key:1?, got %v", got)
+	}
+	if got := scanAll(t, serv, "SCAN", "TYPE", "LIST"); !slices.Equal(got, []string{"list"}) {
+		t.Errorf("Expected TYPE to keep the list only, got %v", got)
+	}
+	if got := scanAll(t, serv, "SCAN", "TYPE", "hash"); len(got) != 0 {
+		t.Errorf("Expected no hash, got %v", got)
+	}
+	runCases(t, serv, []commandCase{
+		{[]string{"SCAN", "-1"}, "-ERR invalid cursor\r\n"},
+		{[]string{"SCAN", "abc"}, "-ERR invalid cursor\r\n"},
+		{[]string{"SCAN", "0", "COUNT", "0"}, "-ERR syntax error\r\n"},
+		{[]string{"SCAN", "0", "COUNT", "x"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"SCAN", "0", "MATCH"}, "-ERR syntax error\r\n"},
+		{[]string{"SCAN", "0", "NOVALUES"}, "-ERR syntax error\r\n"},
+		{[]string{"SCAN"}, "-ERR wrong number of arguments for 'scan' command\r\n"},
+	})
+}
+
+func TestTypeScans(t *testing.T) {
+	serv := newTestServer()
+	runCommand(serv, "SADD", "set", "a", "b", "c")
+	runCommand(serv, "ZADD", "zset", "1", "a", "2.5", "b")
+	runCommand(serv, "SET", "str", "v")
+	if got := sortedSet(scanAll(t, serv, "SSCAN", "set", "COUNT", "1")); !slices.Equal(got, []string{"a", "b", "c"}) {
+		t.Errorf("Expected every member, got %v", got)
+	}
+	if got := scanAll(t, serv, "SSCAN", "set", "MATCH", "b"); !slices.Equal(got, []string{"b"}) {
+		t.Errorf("Expected the matching member, got %v", got)
+	}
+	pairs := scanAll(t, serv, "ZSCAN", "zset")
+	scores := map[string]string{}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		scores[pairs[i]] = pairs[i+1]
+	}
+	if len(scores) != 2 || scores["a"] != "1" || scores["b"] != "2.5" {
+		t.Errorf("Expected members with their scores, got %v", pairs)
+	}
+	runCases(t, serv, []commandCase{
+		{[]string{"SSCAN", "missing", "0"}, "*2\r\n$1\r\n0\r\n*0\r\n"},
+		{[]string{"SSCAN", "missing", "0", "COUNT", "1"}, "*2\r\n$1\r\n0\r\n*0\r\n"},
+		{[]string{"SSCAN", "str", "0"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"ZSCAN", "set", "0"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"HSCAN", "zset", "0"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"SSCAN", "set", "0", "TYPE", "set"}, "-ERR syntax error\r\n"},
+		{[]string{"ZSCAN", "zset", "0", "NOVALUES"}, "-ERR syntax error\r\n"},
+		{[]string{"ZSCAN", "zset", "x"}, "-ERR invalid cursor\r\n"},
+		{[]string{"SSCAN", "set"}, "-ERR wrong number of arguments for 'sscan' command\r\n"},
+	})
+}
+
+// scanWhileResizing scans index from scratch, calling resize after the first calls,
+// and reports the keys of kept that were never returned
+func scanWhileResizing(index *engine.ScanIndex, kept []string, resize func()) []string {
+	seen := map[string]bool{}
+	cursor := uint64(0)
+	for calls := 0; ; calls++ {
+		if calls == 5 {
+			resize()
+		}
+		cursor = index.Scan(cursor, 8, func(key string) { seen[key] = true })
+		if cursor == 0 {
+			break
+		}
+	}
+	var missed []string
+	for _, key := range kept {
+		if !seen[key] {
+			missed = append(missed, key)
+		}
+	}
+	return missed
+}
+
+func TestScanGuaranteeWhileResizing(t *testing.T) {
+	grown := engine.NewScanIndex[int](nil)
+	var kept []string
+	for i := 0; i < 100; i++ {
+		key := "k" + strconv.Itoa(i)
+		grown.Add(key)
+		kept = append(kept, key)
+	}
+	missed := scanWhileResizing(grown, kept, func() {
+		for i := 0; i < 5000; i++ {
+			grown.Add("new" + strconv.Itoa(i))
+		}
+	})
+	if len(missed) != 0 {
+		t.Errorf("Expected every key to be returned while the table grows, missed %v", missed)
+	}
+
+	shrunk := engine.NewScanIndex[int](nil)
+	for i := 0; i < 5000; i++ {
+		shrunk.Add("k" + strconv.Itoa(i))
+	}
+	missed = scanWhileResizing(shrunk, kept, func() {
+		for i := 100; i < 5000; i++ {
+			shrunk.Remove("k" + strconv.Itoa(i))
+		}
+	})
+	if len(missed) != 0 {
+		t.Errorf("Expected every key to be returned while the table shrinks, missed %v", missed)
+	}
+}
+
+func TestScanIndexFollowsWrites(t *testing.T) {
+	serv := newTestServer()
+	for i := 0; i < 1000; i++ {
+		runCommand(serv, "SET", "idx:"+strconv.Itoa(i), "v")
+	}
+	if got := len(scanAll(t, serv, "SCAN", "MATCH", "idx:*")); got != 1000 {
+		t.Fatalf("Expected 1000 keys, got %d", got)
+	}
+	serv.Db.Mu.RLock()
+	index := serv.Db.Keys()
+	serv.Db.Mu.RUnlock()
+
+	runCommand(serv, "DEL", "idx:0", "idx:1")
+	runCommand(serv, "SET", "idx:new", "v")
+	runCommand(serv, "RENAME", "idx:2", "idx:renamed")
+	keys := scanAll(t, serv, "SCAN", "MATCH", "idx:*")
+	if len(keys) != 999 || !slices.Contains(keys, "idx:new") || !slices.Contains(keys, "idx:renamed") || slices.Contains(keys, "idx:2") {
+		t.Errorf("Expected the keys after the writes, got %d keys", len(keys))
+	}
+	serv.Db.Mu.RLock()
+	defer serv.Db.Mu.RUnlock()
+	if serv.Db.Keys() != index {
+		t.Errorf("Expected the index to be updated, not built again")
+	}
+	if index.Len() != len(*serv.Db.Dict) {
+		t.Errorf("Expected %d indexed keys, got %d", len(*serv.Db.Dict), index.Len())
+	}
+}
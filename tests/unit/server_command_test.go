@@ -11,7 +11,10 @@ func TestCommandInitialization(t *testing.T) {
 	server.InitCommands()
 
 	// Test that we can create commands
-	cmd := server.CreateCommand("PING", []string{})
+	cmd, err := server.CreateCommand("PING", []string{})
+	if err != nil {
+		t.Fatalf("CreateCommand: %v", err)
+	}
 	if cmd.Name != "PING" {
 		t.Errorf("Expected command name 'PING', got '%s'", cmd.Name)
 	}
@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/codecrafters-io/redis-starter-go/app/engine"
+	"github.com/codecrafters-io/redis-starter-go/app/rdb"
+)
+
+func TestSetCommands(t *testing.T) {
+	serv := newTestServer()
+	runCases(t, serv, []commandCase{
+		{[]string{"SADD", "tags", "a", "b", "a"}, ":2\r\n"},
+		{[]string{"SADD", "tags", "b", "c"}, ":1\r\n"},
+		{[]string{"SCARD", "tags"}, ":3\r\n"},
+		{[]string{"SISMEMBER", "tags", "c"}, ":1\r\n"},
+		{[]string{"SMISMEMBER", "tags", "a", "z"}, "*2\r\n:1\r\n:0\r\n"},
+		{[]string{"SREM", "tags", "a", "z"}, ":1\r\n"},
+		{[]string{"SMOVE", "tags", "other", "b"}, ":1\r\n"},
+		{[]string{"SMEMBERS", "other"}, "*1\r\n$1\r\nb\r\n"},
+		{[]string{"SRANDMEMBER", "other"}, "$1\r\nb\r\n"},
+		{[]string{"SRANDMEMBER", "other", "-3"}, "*3\r\n$1\r\nb\r\n$1\r\nb\r\n$1\r\nb\r\n"},
+		{[]string{"SPOP", "other"}, "$1\r\nb\r\n"},
+		{[]string{"SCARD", "other"}, ":0\r\n"},
+		{[]string{"SPOP", "other"}, "$-1\r\n"},
+		{[]string{"SPOP", "tags", "5"}, "*1\r\n$1\r\nc\r\n"},
+	})
+	if len(*serv.Db.Dict) != 0 {
+		t.Errorf("Expected empty sets to be deleted, got %v", *serv.Db.Dict)
+	}
+}
+
+func TestSetAlgebra(t *testing.T) {
+	serv := newTestServer()
+	runCommand(serv, "SADD", "s1", "a", "b", "c", "d")
+	runCommand(serv, "SADD", "s2", "c", "d", "e")
+	runCommand(serv, "SADD", "s3", "d", "x")
+	runCommand(serv, "SET", "str", "v")
+	runCases(t, serv, []commandCase{
+		{[]string{"SINTER", "s1", "s2", "s3"}, "*1\r\n$1\r\nd\r\n"},
+		{[]string{"SINTER", "s1", "missing"}, "*0\r\n"},
+		{[]string{"SDIFF", "s2", "s1", "missing"}, "*1\r\n$1\r\ne\r\n"},
+		{[]string{"SUNIONSTORE", "dst", "s1", "s2", "s3"}, ":6\r\n"},
+		{[]string{"SINTERSTORE", "dst", "s1", "s2"}, ":2\r\n"},
+		{[]string{"SISMEMBER", "dst", "c"}, ":1\r\n"},
+		{[]string{"SDIFFSTORE", "dst", "s3", "s1", "s3"}, ":0\r\n"},
+		{[]string{"SINTERCARD", "2", "s1", "s2"}, ":2\r\n"},
+		{[]string{"SINTERCARD", "2", "s1", "s2", "LIMIT", "1"}, ":1\r\n"},
+		{[]string{"SINTERCARD", "0", "s1"}, "-ERR numkeys should be greater than 0\r\n"},
+		{[]string{"SINTERCARD", "3", "s1", "s2"}, "-ERR Number of keys can't be greater than number of args\r\n"},
+		{[]string{"SUNION", "s1", "str"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	})
+	if _, ok := (*serv.Db.Dict)["dst"]; ok {
+		t.Error("Expected empty store result to delete the destination")
+	}
+}
+
+func TestSetRandomMembersAreUniform(t *testing.T) {
+	serv := newTestServer()
+	const trials = 4000
+	members := []string{"a", "b", "c", "d"}
+	picked := map[string]int{}
+	popped := map[string]int{}
+	runCommand(serv, "SADD", "s", "a", "b", "c", "d")
+	for i := 0; i < trials; i++ {
+		picked[runCommand(serv, "SRANDMEMBER", "s")]++
+		runCommand(serv, "SADD", "p", "a", "b", "c", "d")
+		popped[runCommand(serv, "SPOP", "p")]++
+		runCommand(serv, "DEL", "p")
+	}
+	// each member is expected trials/4 = 1000 times, 700 is more than 10 deviations away
+	for _, member := range members {
+		reply := "$1\r\n" + member + "\r\n"
+		if picked[reply] < 700 || popped[reply] < 700 {
+			t.Errorf("Expected %s about 1000 times, picked %d and popped %d times", member, picked[reply], popped[reply])
+		}
+	}
+}
+
+func TestSetRDBRoundTrip(t *testing.T) {
+	dict := map[string]engine.RedisObj{
+		"tags": engine.RedisSet{Data: map[string]struct{}{"a": {}, "b": {}}},
+	}
+	path := filepath.Join(t.TempDir(), "dump.rdb")
+	if err := rdb.GenerateRDBFile(&dict, path); err != nil {
+		t.Fatalf("GenerateRDBFile failed: %v", err)
+	}
+	set, ok := rdb.Encode(path)["tags"].(engine.RedisSet)
+	if !ok {
+		t.Fatal("Expected tags to load as a set")
+	}
+	if _, ok := set.Data["a"]; !ok || len(set.Data) != 2 {
+		t.Errorf("Unexpected set contents %v", set.Data)
+	}
+}
@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamRead(t *testing.T) {
+	serv := newTestServer()
+	runCommand(serv, "XADD", "a", "1-0", "f", "1")
+	runCommand(serv, "XADD", "a", "2-0", "f", "2")
+	runCommand(serv, "XADD", "b", "5-0", "g", "5")
+	runCommand(serv, "RPUSH", "list", "x")
+	runCases(t, serv, []commandCase{
+		{[]string{"XREAD", "STREAMS", "a", "1-0"}, "*1\r\n*2\r\n$1\r\na\r\n*1\r\n*2\r\n$3\r\n2-0\r\n*2\r\n$1\r\nf\r\n$1\r\n2\r\n"},
+		{[]string{"XREAD", "COUNT", "1", "STREAMS", "a", "missing", "b", "0", "0", "0"}, "*2\r\n*2\r\n$1\r\na\r\n*1\r\n*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\nf\r\n$1\r\n1\r\n*2\r\n$1\r\nb\r\n*1\r\n*2\r\n$3\r\n5-0\r\n*2\r\n$1\r\ng\r\n$1\r\n5\r\n"},
+		{[]string{"XREAD", "STREAMS", "a", "$"}, "*-1\r\n"},
+		{[]string{"XREAD", "STREAMS", "a", "b", "0"}, "-ERR Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified.\r\n"},
+		{[]string{"XREAD", "NOACK", "STREAMS", "a", "0"}, "-ERR syntax error\r\n"},
+		{[]string{"XREAD", "STREAMS", "list", "0"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"XREAD", "BLOCK", "-1", "STREAMS", "a", "$"}, "-ERR timeout is negative\r\n"},
+		{[]string{"XREAD", "BLOCK", "0.5", "STREAMS", "a", "$"}, "-ERR timeout is not an integer or out of range\r\n"},
+		{[]string{"XREAD", "BLOCK", "0", "STREAMS", "a", "0"}, "*1\r\n*2\r\n$1\r\na\r\n*2\r\n*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\nf\r\n$1\r\n1\r\n*2\r\n$3\r\n2-0\r\n*2\r\n$1\r\nf\r\n$1\r\n2\r\n"},
+	})
+}
+
+func TestStreamReadBlockTimeout(t *testing.T) {
+	serv := newTestServer()
+	runCommand(serv, "XADD", "s", "1-0", "f", "v")
+	start := time.Now()
+	if got := runCommand(serv, "XREAD", "BLOCK", "100", "STREAMS", "s", "$"); got != "*-1\r\n" {
+		t.Errorf("Expected nil array on timeout, got %q", got)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("XREAD returned after %v, before its timeout", elapsed)
+	}
+	runCommand(serv, "XGROUP", "CREATE", "s", "g", "$")
+	if got := runCommand(serv, "XREADGROUP", "GROUP", "g", "c", "BLOCK", "50", "STREAMS", "s", ">"); got != "*-1\r\n" {
+		t.Errorf("Expected nil array on XREADGROUP timeout, got %q", got)
+	}
+	if got := runCommand(serv, "XREADGROUP", "GROUP", "g", "c", "BLOCK", "50", "STREAMS", "s", "0"); got != "*1\r\n*2\r\n$1\r\ns\r\n*0\r\n" {
+		t.Errorf("Expected the empty history without blocking, got %q", got)
+	}
+}
+
+func TestStreamReadWokenByAdd(t *testing.T) {
+	serv := newTestServer()
+	runCommand(serv, "XADD", "b", "1-0", "f", "old")
+	first := make(chan string)
+	second := make(chan string)
+	go func() { first <- runCommand(serv, "XREAD", "BLOCK", "0", "STREAMS", "a", "b", "$", "$") }()
+	go func() { second <- runCommand(serv, "XREAD", "BLOCK", "5000", "STREAMS", "b", "$") }()
+	waitBlocked(t, serv.Db, 2)
+
+	runCommand(serv, "XADD", "a", "1-0", "f", "other")
+	if got := <-first; got != "*1\r\n*2\r\n$1\r\na\r\n*1\r\n*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\nf\r\n$5\r\nother\r\n" {
+		t.Errorf("Expected the first reader to get the entry of a, got %q", got)
+	}
+	runCommand(serv, "XADD", "b", "2-0", "f", "new")
+	if got := <-second; got != "*1\r\n*2\r\n$1\r\nb\r\n*1\r\n*2\r\n$3\r\n2-0\r\n*2\r\n$1\r\nf\r\n$3\r\nnew\r\n" {
+		t.Errorf("Expected the second reader to get only the new entry of b, got %q", got)
+	}
+}
+
+func TestStreamReadGroupWokenByAdd(t *testing.T) {
+	serv := newTestServer()
+	runCommand(serv, "XGROUP", "CREATE", "s", "g", "$", "MKSTREAM")
+	alice := make(chan string)
+	bob := make(chan string)
+	go func() {
+		alice <- runCommand(serv, "XREADGROUP", "GROUP", "g", "alice", "BLOCK", "200", "STREAMS", "s", ">")
+	}()
+	waitBlocked(t, serv.Db, 1)
+	go func() {
+		bob <- runCommand(serv, "XREADGROUP", "GROUP", "g", "bob", "BLOCK", "200", "STREAMS", "s", ">")
+	}()
+	waitBlocked(t, serv.Db, 2)
+
+	runCommand(serv, "XADD", "s", "1-0", "f", "v")
+	got := []string{<-alice, <-bob}
+	delivered := "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\nf\r\n$1\r\nv\r\n"
+	if (got[0] != delivered || got[1] != "*-1\r\n") && (got[1] != delivered || got[0] != "*-1\r\n") {
+		t.Errorf("Expected the entry to be delivered to exactly one consumer, got %q", got)
+	}
+	if out := runCommand(serv, "XPENDING", "s", "g"); !strings.HasPrefix(out, "*4\r\n:1\r\n") {
+		t.Errorf("Expected one pending entry, got %q", out)
+	}
+}
+
+func TestStreamReadGroupDestroyed(t *testing.T) {
+	serv := newTestServer(groupStream)
+	runCommand(serv, "XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", ">")
+	reply := make(chan string)
+	go func() {
+		reply <- runCommand(serv, "XREADGROUP", "GROUP", "g", "alice", "BLOCK", "0", "STREAMS", "s", ">")
+	}()
+	waitBlocked(t, serv.Db, 1)
+
+	runCommand(serv, "XGROUP", "DESTROY", "s", "g")
+	if got := <-reply; got != "-NOGROUP No such key 's' or consumer group 'g' in XREADGROUP with GROUP option\r\n" {
+		t.Errorf("Expected a blocked reader of a destroyed group to get NOGROUP, got %q", got)
+	}
+}
@@ -0,0 +1,70 @@
+package tests
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/redis-starter-go/app/engine"
+)
+
+func TestStreamAddAndRange(t *testing.T) {
+	serv := newTestServer()
+	runCases(t, serv, []commandCase{
+		{[]string{"XADD", "s", "1-1", "f", "v1"}, "$3\r\n1-1\r\n"},
+		{[]string{"XADD", "s", "1-*", "f", "v2"}, "$3\r\n1-2\r\n"},
+		{[]string{"XADD", "s", "2", "f", "v3"}, "$3\r\n2-0\r\n"},
+		{[]string{"XADD", "s", "2-0", "f", "v"}, "-ERR The ID specified in XADD is equal or smaller than the target stream top item\r\n"},
+		{[]string{"XADD", "s", "0-0", "f", "v"}, "-ERR The ID specified in XADD must be greater than 0-0\r\n"},
+		{[]string{"XADD", "s", "1-x", "f", "v"}, "-ERR Invalid stream ID specified as stream command argument\r\n"},
+		{[]string{"XADD", "s", "3-0", "f"}, "-ERR wrong number of arguments for 'xadd' command\r\n"},
+		{[]string{"XADD", "e", "0-*", "f", "v"}, "$3\r\n0-1\r\n"},
+		{[]string{"XADD", "missing", "NOMKSTREAM", "*", "f", "v"}, "$-1\r\n"},
+		{[]string{"XLEN", "s"}, ":3\r\n"},
+		{[]string{"XRANGE", "s", "-", "+", "COUNT", "2"}, "*2\r\n*2\r\n$3\r\n1-1\r\n*2\r\n$1\r\nf\r\n$2\r\nv1\r\n*2\r\n$3\r\n1-2\r\n*2\r\n$1\r\nf\r\n$2\r\nv2\r\n"},
+		{[]string{"XRANGE", "s", "(1-1", "1"}, "*1\r\n*2\r\n$3\r\n1-2\r\n*2\r\n$1\r\nf\r\n$2\r\nv2\r\n"},
+		{[]string{"XREVRANGE", "s", "+", "-", "COUNT", "1"}, "*1\r\n*2\r\n$3\r\n2-0\r\n*2\r\n$1\r\nf\r\n$2\r\nv3\r\n"},
+		{[]string{"XRANGE", "s", "(-", "+"}, "-ERR Invalid stream ID specified as stream command argument\r\n"},
+		{[]string{"XDEL", "s", "1-2", "9-9"}, ":1\r\n"},
+		{[]string{"XRANGE", "s", "1", "1"}, "*1\r\n*2\r\n$3\r\n1-1\r\n*2\r\n$1\r\nf\r\n$2\r\nv1\r\n"},
+		{[]string{"XADD", "s", "1-5", "f", "v"}, "-ERR The ID specified in XADD is equal or smaller than the target stream top item\r\n"},
+		{[]string{"XLEN", "missing"}, ":0\r\n"},
+	})
+	if _, ok := serv.Db.Lookup("missing").(engine.RedisStream); ok {
+		t.Error("XADD NOMKSTREAM must not create the stream")
+	}
+}
+
+func TestStreamAutoID(t *testing.T) {
+	serv := newTestServer()
+	first := runCommand(serv, "XADD", "s", "*", "f", "v")
+	second := runCommand(serv, "XADD", "s", "*", "f", "v")
+	if !strings.HasPrefix(first, "$") || first == second {
+		t.Fatalf("Expected two distinct auto IDs, got %q and %q", first, second)
+	}
+	stream := serv.Db.Lookup("s").(engine.RedisStream).Data
+	entries := stream.Range(engine.StreamID{}, engine.MaxStreamID, 0, false)
+	if len(entries) != 2 || !entries[0].ID.Less(entries[1].ID) {
+		t.Errorf("Expected increasing IDs, got %v", entries)
+	}
+}
+
+func TestStreamTrim(t *testing.T) {
+	serv := newTestServer()
+	for i := 1; i <= 250; i++ {
+		runCommand(serv, "XADD", "s", fmt.Sprintf("%d-0", i), "n", fmt.Sprint(i))
+	}
+	runCases(t, serv, []commandCase{
+		{[]string{"XTRIM", "s", "MAXLEN", "~", "120"}, ":100\r\n"},
+		{[]string{"XLEN", "s"}, ":150\r\n"},
+		{[]string{"XTRIM", "s", "MAXLEN", "=", "120"}, ":30\r\n"},
+		{[]string{"XTRIM", "s", "MINID", "201"}, ":70\r\n"},
+		{[]string{"XRANGE", "s", "-", "-"}, "*0\r\n"},
+		{[]string{"XRANGE", "s", "-", "201"}, "*1\r\n*2\r\n$5\r\n201-0\r\n*2\r\n$1\r\nn\r\n$3\r\n201\r\n"},
+		{[]string{"XTRIM", "s", "MAXLEN", "10", "LIMIT", "5"}, "-ERR syntax error, LIMIT cannot be used without the special ~ option\r\n"},
+		{[]string{"XTRIM", "s", "MAXLEN", "-1"}, "-ERR The MAXLEN argument must be >= 0.\r\n"},
+		{[]string{"XADD", "s", "MAXLEN", "2", "300-0", "n", "300"}, "$5\r\n300-0\r\n"},
+		{[]string{"XLEN", "s"}, ":2\r\n"},
+		{[]string{"XADD", "s", "MAXLEN", "1", "MINID", "1", "*", "n", "v"}, "-ERR syntax error, MAXLEN and MINID options at the same time are not compatible\r\n"},
+	})
+}
@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/redis-starter-go/app/engine"
+	"github.com/codecrafters-io/redis-starter-go/app/rdb"
+)
+
+// groupStream is a stream s of two entries with a group g that read none of them
+var groupStream = withCommands(
+	[]string{"XADD", "s", "1-0", "f", "a"},
+	[]string{"XADD", "s", "2-0", "f", "b"},
+	[]string{"XGROUP", "CREATE", "s", "g", "0"},
+)
+
+func TestStreamGroupReadAndAck(t *testing.T) {
+	serv := newTestServer(groupStream)
+	runCases(t, serv, []commandCase{
+		{[]string{"XGROUP", "CREATE", "s", "g", "$"}, "-BUSYGROUP Consumer Group name already exists\r\n"},
+		{[]string{"XGROUP", "CREATE", "missing", "g", "$"}, "-ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.\r\n"},
+		{[]string{"XGROUP", "CREATE", "empty", "g", "$", "MKSTREAM"}, "+OK\r\n"},
+		{[]string{"XREADGROUP", "GROUP", "g", "alice", "COUNT", "1", "STREAMS", "s", ">"}, "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\nf\r\n$1\r\na\r\n"},
+		{[]string{"XREADGROUP", "GROUP", "g", "bob", "STREAMS", "s", ">"}, "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n*2\r\n$3\r\n2-0\r\n*2\r\n$1\r\nf\r\n$1\r\nb\r\n"},
+		{[]string{"XREADGROUP", "GROUP", "g", "bob", "STREAMS", "s", ">"}, "*-1\r\n"},
+		{[]string{"XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", "0"}, "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\nf\r\n$1\r\na\r\n"},
+		{[]string{"XPENDING", "s", "g"}, "*4\r\n:2\r\n$3\r\n1-0\r\n$3\r\n2-0\r\n*2\r\n*2\r\n$5\r\nalice\r\n$1\r\n1\r\n*2\r\n$3\r\nbob\r\n$1\r\n1\r\n"},
+		{[]string{"XACK", "s", "g", "1-0", "9-0"}, ":1\r\n"},
+		{[]string{"XPENDING", "s", "g", "-", "+", "10", "alice"}, "*0\r\n"},
+		{[]string{"XREADGROUP", "GROUP", "g", "bob", "STREAMS", "s", "$"}, "-ERR The $ ID is meaningless in the context of XREADGROUP: you want to read the history of this consumer by specifying a proper ID, or use the > ID to get new messages. The $ ID would just return an empty result set.\r\n"},
+		{[]string{"XREADGROUP", "GROUP", "nope", "bob", "STREAMS", "s", ">"}, "-NOGROUP No such key 's' or consumer group 'nope' in XREADGROUP with GROUP option\r\n"},
+		{[]string{"XGROUP", "DELCONSUMER", "s", "g", "bob"}, ":1\r\n"},
+		{[]string{"XPENDING", "s", "g"}, "*4\r\n:0\r\n$-1\r\n$-1\r\n*-1\r\n"},
+		{[]string{"XGROUP", "DESTROY", "s", "g"}, ":1\r\n"},
+	})
+
+	s := serv.Db.Lookup("s").(engine.RedisStream).Data
+	if s.Group("g") != nil {
+		t.Error("Expected group g to be destroyed")
+	}
+}
+
+func TestStreamGroupDeliveryCount(t *testing.T) {
+	serv := newTestServer(groupStream)
+	runCommand(serv, "XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", ">")
+	runCommand(serv, "XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", "0")
+	out := runCommand(serv, "XPENDING", "s", "g", "IDLE", "0", "-", "+", "10")
+	if !strings.HasPrefix(out, "*2\r\n*4\r\n$3\r\n1-0\r\n$5\r\nalice\r\n:") || !strings.HasSuffix(out, ":2\r\n") {
+		t.Errorf("Unexpected XPENDING reply %q", out)
+	}
+	if out := runCommand(serv, "XPENDING", "s", "g", "IDLE", "60000", "-", "+", "10"); out != "*0\r\n" {
+		t.Errorf("Expected no entry idle for a minute, got %q", out)
+	}
+	group := serv.Db.Lookup("s").(engine.RedisStream).Data.Group("g")
+	if nack := group.Pending[engine.StreamID{Ms: 2}]; nack == nil || nack.DeliveryCount != 2 || nack.Consumer.Name != "alice" {
+		t.Errorf("Expected 2-0 delivered twice to alice, got %+v", nack)
+	}
+}
+
+func TestStreamClaim(t *testing.T) {
+	serv := newTestServer(groupStream)
+	runCommand(serv, "XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", ">")
+	runCases(t, serv, []commandCase{
+		{[]string{"XCLAIM", "s", "g", "bob", "3600000", "1-0"}, "*0\r\n"},
+		{[]string{"XCLAIM", "s", "g", "bob", "0", "1-0", "JUSTID"}, "*1\r\n$3\r\n1-0\r\n"},
+		{[]string{"XCLAIM", "s", "g", "bob", "0", "1-0", "BOGUS"}, "-ERR Unrecognized XCLAIM option 'BOGUS'\r\n"},
+		{[]string{"XDEL", "s", "2-0"}, ":1\r\n"},
+		{[]string{"XAUTOCLAIM", "s", "g", "carol", "0", "0", "COUNT", "1"}, "*3\r\n$3\r\n2-0\r\n*1\r\n*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\nf\r\n$1\r\na\r\n*0\r\n"},
+		{[]string{"XAUTOCLAIM", "s", "g", "carol", "0", "2-0"}, "*3\r\n$3\r\n0-0\r\n*0\r\n*1\r\n$3\r\n2-0\r\n"},
+		{[]string{"XAUTOCLAIM", "s", "g", "carol", "0", "0", "COUNT", "0"}, "-ERR COUNT must be > 0\r\n"},
+	})
+	group := serv.Db.Lookup("s").(engine.RedisStream).Data.Group("g")
+	nack := group.Pending[engine.StreamID{Ms: 1}]
+	if len(group.Pending) != 1 || nack.Consumer.Name != "carol" || nack.DeliveryCount != 2 {
+		t.Errorf("Expected 1-0 owned by carol after two deliveries, got %+v", nack)
+	}
+	if len(group.Consumers["alice"].Pending) != 0 || len(group.Consumers["bob"].Pending) != 0 {
+		t.Error("Expected claimed entries to leave the PEL of their previous owners")
+	}
+}
+
+func TestStreamInfo(t *testing.T) {
+	serv := newTestServer(groupStream)
+	runCommand(serv, "XREADGROUP", "GROUP", "g", "alice", "COUNT", "1", "STREAMS", "s", ">")
+	runCases(t, serv, []commandCase{
+		{[]string{"XINFO", "GROUPS", "s"}, "*1\r\n*12\r\n$4\r\nname\r\n$1\r\ng\r\n$9\r\nconsumers\r\n:1\r\n$7\r\npending\r\n:1\r\n$17\r\nlast-delivered-id\r\n$3\r\n1-0\r\n$12\r\nentries-read\r\n:1\r\n$3\r\nlag\r\n:1\r\n"},
+		{[]string{"XINFO", "GROUPS", "missing"}, "-ERR no such key\r\n"},
+		{[]string{"XINFO", "CONSUMERS", "s", "nope"}, "-NOGROUP No such consumer group 'nope' for key name 's'\r\n"},
+	})
+	out := runCommand(serv, "XINFO", "STREAM", "s")
+	for _, want := range []string{"$6\r\nlength\r\n:2\r\n", "$17\r\nlast-generated-id\r\n$3\r\n2-0\r\n", "$6\r\ngroups\r\n:1\r\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected XINFO STREAM to contain %q, got %q", want, out)
+		}
+	}
+	out = runCommand(serv, "XINFO", "CONSUMERS", "s", "g")
+	if !strings.HasPrefix(out, "*1\r\n*8\r\n$4\r\nname\r\n$5\r\nalice\r\n$7\r\npending\r\n:1\r\n") {
+		t.Errorf("Unexpected XINFO CONSUMERS reply %q", out)
+	}
+}
+
+func TestStreamRDBRoundTrip(t *testing.T) {
+	serv := newTestServer(groupStream)
+	runCommand(serv, "XADD", "s", "3-0", "other", "x", "f", "c")
+	runCommand(serv, "XDEL", "s", "2-0")
+	runCommand(serv, "XREADGROUP", "GROUP", "g", "alice", "COUNT", "1", "STREAMS", "s", ">")
+	path := filepath.Join(t.TempDir(), "dump.rdb")
+	if err := rdb.GenerateRDBFile(serv.Db.Dict, path); err != nil {
+		t.Fatalf("GenerateRDBFile failed: %v", err)
+	}
+	loaded, ok := rdb.Encode(path)["s"].(engine.RedisStream)
+	if !ok {
+		t.Fatal("Expected s to load as a stream")
+	}
+	s := loaded.Data
+	entries := s.Range(engine.StreamID{}, engine.MaxStreamID, 0, false)
+	if len(entries) != 2 || entries[0].ID != (engine.StreamID{Ms: 1}) || strings.Join(entries[0].Fields, " ") != "f a" {
+		t.Fatalf("Unexpected entries %v", entries)
+	}
+	if s.LastID != (engine.StreamID{Ms: 3}) || s.MaxDeletedID != (engine.StreamID{Ms: 2}) || s.EntriesAdded != 3 {
+		t.Errorf("Unexpected stream metadata %+v", s)
+	}
+	group := s.Group("g")
+	if group == nil || group.LastID != (engine.StreamID{Ms: 1}) || group.EntriesRead != engine.InvalidEntriesRead {
+		t.Fatalf("Unexpected group %+v", group)
+	}
+	nack := group.Pending[engine.StreamID{Ms: 1}]
+	if nack == nil || nack.Consumer.Name != "alice" || nack.DeliveryCount != 1 || nack.DeliveryTime.IsZero() {
+		t.Errorf("Unexpected pending entry %+v", nack)
+	}
+}
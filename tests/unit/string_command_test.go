@@ -0,0 +1,250 @@
+package tests
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/engine"
+	"github.com/codecrafters-io/redis-starter-go/app/server"
+)
+
+func TestCounterCommands(t *testing.T) {
+	serv := newTestServer()
+	runCommand(serv, "SET", "text", "abc")
+	runCommand(serv, "SET", "padded", "007")
+	runCommand(serv, "SET", "max", "9223372036854775807")
+	runCommand(serv, "RPUSH", "list", "x")
+	runCases(t, serv, []commandCase{
+		{[]string{"INCR", "n"}, ":1\r\n"},
+		{[]string{"INCRBY", "n", "41"}, ":42\r\n"},
+		{[]string{"DECR", "n"}, ":41\r\n"},
+		{[]string{"DECRBY", "n", "50"}, ":-9\r\n"},
+		{[]string{"GET", "n"}, "+-9\r\n"},
+		{[]string{"INCR", "text"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"INCR", "padded"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"INCRBY", "n", "+1"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"INCR", "max"}, "-ERR increment or decrement would overflow\r\n"},
+		{[]string{"DECRBY", "n", "-9223372036854775808"}, "-ERR decrement would overflow\r\n"},
+		{[]string{"INCR", "list"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"INCR"}, "-ERR wrong number of arguments for 'incr' command\r\n"},
+		{[]string{"INCRBYFLOAT", "f", "10.5"}, "$4\r\n10.5\r\n"},
+		{[]string{"INCRBYFLOAT", "f", "0.1"}, "$4\r\n10.6\r\n"},
+		{[]string{"INCRBYFLOAT", "f", "-5.6"}, "$1\r\n5\r\n"},
+		{[]string{"INCRBYFLOAT", "f", "5.0e3"}, "$4\r\n5005\r\n"},
+		{[]string{"INCRBYFLOAT", "text", "1"}, "-ERR value is not a valid float\r\n"},
+		{[]string{"INCRBYFLOAT", "f", "abc"}, "-ERR value is not a valid float\r\n"},
+		{[]string{"INCRBYFLOAT", "f", "1e308"}, "$309\r\n1" + strings.Repeat("0", 308) + "\r\n"},
+		{[]string{"INCRBYFLOAT", "f", "1e308"}, "-ERR increment would produce NaN or Infinity\r\n"},
+	})
+}
+
+func TestIntegerEncoding(t *testing.T) {
+	serv := newTestServer()
+	runCommand(serv, "SET", "n", "123")
+	runCommand(serv, "SET", "padded", "0123")
+	if str := serv.Db.Lookup("n").(engine.RedisString); !str.IsInt || str.Int != 123 || str.Data != "" {
+		t.Errorf("Expected 123 to be stored as an integer, got %+v", str)
+	}
+	if str := serv.Db.Lookup("padded").(engine.RedisString); str.IsInt || str.Data != "0123" {
+		t.Errorf("Expected 0123 to be stored as a string, got %+v", str)
+	}
+
+	expiration := time.Now().Add(time.Hour)
+	(*serv.Db.Dict)["ttl"] = engine.NewRedisString("1", expiration)
+	runCommand(serv, "INCR", "ttl")
+	if str := serv.Db.Lookup("ttl").(engine.RedisString); !str.IsInt || str.Int != 2 || !str.Expiration.Equal(expiration) {
+		t.Errorf("Expected INCR to keep the TTL, got %+v", str)
+	}
+	runCommand(serv, "INCRBYFLOAT", "ttl", "0.5")
+	if got := runCommand(serv, "GET", "ttl"); got != "+2.5\r\n" {
+		t.Errorf("Expected 2.5, got %q", got)
+	}
+	if str := serv.Db.Lookup("ttl").(engine.RedisString); !str.Expiration.Equal(expiration) {
+		t.Errorf("Expected INCRBYFLOAT to keep the TTL, got %+v", str)
+	}
+}
+
+func TestSetOptions(t *testing.T) {
+	serv := newTestServer()
+	runCommand(serv, "RPUSH", "list", "x")
+	runCases(t, serv, []commandCase{
+		{[]string{"SET", "k", "v1", "XX"}, "$-1\r\n"},
+		{[]string{"SET", "k", "v1", "NX"}, "+OK\r\n"},
+		{[]string{"SET", "k", "v2", "NX"}, "$-1\r\n"},
+		{[]string{"SET", "k", "v2", "NX", "GET"}, "$2\r\nv1\r\n"},
+		{[]string{"SET", "k", "v2", "XX", "GET"}, "$2\r\nv1\r\n"},
+		{[]string{"SET", "new", "v", "GET"}, "$-1\r\n"},
+		{[]string{"SET", "list", "v", "GET"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"SET", "k", "v", "NX", "XX"}, "-ERR syntax error\r\n"},
+		{[]string{"SET", "k", "v", "EX", "10", "PX", "100"}, "-ERR syntax error\r\n"},
+		{[]string{"SET", "k", "v", "EX", "10", "KEEPTTL"}, "-ERR syntax error\r\n"},
+		{[]string{"SET", "k", "v", "EXAT", "0"}, "-ERR invalid expire time in 'set' command\r\n"},
+		{[]string{"SET", "k", "v", "EX", "0"}, "-ERR invalid expire time in 'set' command\r\n"},
+		{[]string{"SET", "k", "v", "EX", "-5"}, "-ERR invalid expire time in 'set' command\r\n"},
+		{[]string{"SET", "k", "v", "PX", "0"}, "-ERR invalid expire time in 'set' command\r\n"},
+		{[]string{"SET", "k", "v", "PXAT", "-1"}, "-ERR invalid expire time in 'set' command\r\n"},
+		{[]string{"TTL", "k"}, ":-1\r\n"},
+		{[]string{"SET", "k", "v", "PXAT", "abc"}, "-ERR invalid PXAT time\r\n"},
+		{[]string{"GET", "k"}, "+v2\r\n"},
+		{[]string{"SET", "list", "v"}, "+OK\r\n"},
+		{[]string{"SET", "past", "v", "PXAT", "1"}, "+OK\r\n"},
+		{[]string{"GET", "past"}, "$-1\r\n"},
+	})
+
+	deadline := time.Now().Add(time.Hour).Truncate(time.Second)
+	runCommand(serv, "SET", "ttl", "v", "EXAT", strconv.FormatInt(deadline.Unix(), 10))
+	runCommand(serv, "SET", "ttl", "w", "KEEPTTL")
+	if obj := serv.Db.Lookup("ttl"); !obj.GetExpiration().Equal(deadline) {
+		t.Errorf("Expected KEEPTTL to keep %v, got %v", deadline, obj.GetExpiration())
+	}
+	runCommand(serv, "SET", "ttl", "x")
+	if obj := serv.Db.Lookup("ttl"); obj.HasExpiration() {
+		t.Error("Expected a plain SET to clear the TTL")
+	}
+}
+
+func TestSetPropagatesAbsoluteExpiration(t *testing.T) {
+	serv := newTestServer()
+	cmd, _ := server.CreateCommand("SET", []string{"k", "v", "EX", "100", "GET"})
+	request := &server.Request{Serv: serv, Cmd: &cmd}
+	before := time.Now().Add(100 * time.Second).UnixMilli()
+	server.ProcessCommand(request)
+	if len(request.AlsoPropagate) != 1 {
+		t.Fatalf("Expected SET to be propagated once, got %v", request.AlsoPropagate)
+	}
+	args := request.AlsoPropagate[0].Args
+	if len(args) != 4 || args[2] != "PXAT" {
+		t.Fatalf("Expected SET k v PXAT ms, got %v", args)
+	}
+	if ms, _ := strconv.ParseInt(args[3], 10, 64); ms < before || ms > before+1000 {
+		t.Errorf("Expected a deadline about 100s from now, got %d", ms)
+	}
+
+	cmd, _ = server.CreateCommand("SET", []string{"k", "w", "NX"})
+	request = &server.Request{Serv: serv, Cmd: &cmd}
+	server.ProcessCommand(request)
+	if len(request.AlsoPropagate) != 0 {
+		t.Errorf("Expected an aborted SET NX not to be propagated, got %v", request.AlsoPropagate)
+	}
+}
+
+func TestStringManipulation(t *testing.T) {
+	serv := newTestServer()
+	runCommand(serv, "RPUSH", "list", "x")
+	runCases(t, serv, []commandCase{
+		{[]string{"APPEND", "log", "Hello"}, ":5\r\n"},
+		{[]string{"APPEND", "log", " World"}, ":11\r\n"},
+		{[]string{"STRLEN", "log"}, ":11\r\n"},
+		{[]string{"STRLEN", "missing"}, ":0\r\n"},
+		{[]string{"GETRANGE", "log", "0", "4"}, "$5\r\nHello\r\n"},
+		{[]string{"GETRANGE", "log", "-5", "-1"}, "$5\r\nWorld\r\n"},
+		{[]string{"GETRANGE", "log", "5", "100"}, "$6\r\n World\r\n"},
+		{[]string{"GETRANGE", "log", "-1", "-5"}, "$0\r\n\r\n"},
+		{[]string{"GETRANGE", "missing", "0", "-1"}, "$0\r\n\r\n"},
+		{[]string{"SETRANGE", "log", "6", "Redis"}, ":11\r\n"},
+		{[]string{"GETRANGE", "log", "0", "-1"}, "$11\r\nHello Redis\r\n"},
+		{[]string{"SETRANGE", "pad", "3", "x"}, ":4\r\n"},
+		{[]string{"GETRANGE", "pad", "0", "-1"}, "$4\r\n\x00\x00\x00x\r\n"},
+		{[]string{"SETRANGE", "empty", "5", ""}, ":0\r\n"},
+		{[]string{"SETRANGE", "log", "-1", "x"}, "-ERR offset is out of range\r\n"},
+		{[]string{"SETRANGE", "log", "536870911", "xy"}, "-ERR string exceeds maximum allowed size (proto-max-bulk-len)\r\n"},
+		{[]string{"APPEND", "list", "x"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"GETSET", "log", "new"}, "$11\r\nHello Redis\r\n"},
+		{[]string{"GETSET", "fresh", "v"}, "$-1\r\n"},
+		{[]string{"GETDEL", "log"}, "$3\r\nnew\r\n"},
+		{[]string{"GETDEL", "log"}, "$-1\r\n"},
+		{[]string{"GETDEL", "list"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	})
+	if obj := serv.Db.Lookup("empty"); obj != nil {
+		t.Error("Expected SETRANGE with an empty value not to create the key")
+	}
+}
+
+func TestGetEx(t *testing.T) {
+	serv := newTestServer()
+	runCommand(serv, "SET", "k", "v")
+	runCases(t, serv, []commandCase{
+		{[]string{"GETEX", "k", "EX", "100"}, "$1\r\nv\r\n"},
+		{[]string{"GETEX", "missing", "EX", "100"}, "$-1\r\n"},
+		{[]string{"GETEX", "k", "EX", "0"}, "-ERR invalid expire time in 'getex' command\r\n"},
+		{[]string{"GETEX", "k", "EX", "ten"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"GETEX", "k", "EX", "10", "PERSIST"}, "-ERR syntax error\r\n"},
+	})
+	if obj := serv.Db.Lookup("k"); !obj.HasExpiration() {
+		t.Error("Expected GETEX EX to set a TTL")
+	}
+	runCommand(serv, "GETEX", "k", "PERSIST")
+	if obj := serv.Db.Lookup("k"); obj.HasExpiration() {
+		t.Error("Expected GETEX PERSIST to clear the TTL")
+	}
+	deadline := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	runCommand(serv, "GETEX", "k", "PXAT", strconv.FormatInt(deadline.UnixMilli(), 10))
+	if obj := serv.Db.Lookup("k"); !obj.GetExpiration().Equal(deadline) {
+		t.Errorf("Expected GETEX PXAT to expire at %v, got %v", deadline, obj.GetExpiration())
+	}
+	runCommand(serv, "GETEX", "k", "EXAT", "1")
+	if got := runCommand(serv, "GETEX", "k"); got != "$-1\r\n" {
+		t.Errorf("Expected a deadline in the past to expire the key, got %q", got)
+	}
+}
+
+func TestLCS(t *testing.T) {
+	serv := newTestServer()
+	runCommand(serv, "SET", "key1", "ohmytext")
+	runCommand(serv, "SET", "key2", "mynewtext")
+	runCommand(serv, "RPUSH", "list", "x")
+	matches := "*2\r\n*2\r\n*2\r\n:4\r\n:7\r\n*2\r\n:5\r\n:8\r\n*2\r\n*2\r\n:2\r\n:3\r\n*2\r\n:0\r\n:1\r\n"
+	runCases(t, serv, []commandCase{
+		{[]string{"LCS", "key1", "key2"}, "$6\r\nmytext\r\n"},
+		{[]string{"LCS", "key1", "key2", "LEN"}, ":6\r\n"},
+		{[]string{"LCS", "key1", "key2", "IDX"}, "*4\r\n$7\r\nmatches\r\n" + matches + "$3\r\nlen\r\n:6\r\n"},
+		{[]string{"LCS", "key1", "key2", "IDX", "MINMATCHLEN", "4", "WITHMATCHLEN"}, "*4\r\n$7\r\nmatches\r\n*1\r\n*3\r\n*2\r\n:4\r\n:7\r\n*2\r\n:5\r\n:8\r\n:4\r\n$3\r\nlen\r\n:6\r\n"},
+		{[]string{"LCS", "key1", "missing"}, "$0\r\n\r\n"},
+		{[]string{"LCS", "key1", "key2", "LEN", "IDX"}, "-ERR If you want both the length and indexes, please just use IDX.\r\n"},
+		{[]string{"LCS", "key1", "list"}, "-ERR The specified keys must contain string values\r\n"},
+	})
+}
+
+func TestMultiKeyStrings(t *testing.T) {
+	serv := newTestServer()
+	runCommand(serv, "RPUSH", "list", "x")
+	runCases(t, serv, []commandCase{
+		{[]string{"MSET", "a", "1", "b", "2"}, "+OK\r\n"},
+		{[]string{"MGET", "a", "missing", "list", "b"}, "*4\r\n$1\r\n1\r\n$-1\r\n$-1\r\n$1\r\n2\r\n"},
+		{[]string{"MSET", "a", "1", "b"}, "-ERR wrong number of arguments for 'mset' command\r\n"},
+		{[]string{"MSETNX", "c", "3", "a", "x"}, ":0\r\n"},
+		{[]string{"MGET", "c", "a"}, "*2\r\n$-1\r\n$1\r\n1\r\n"},
+		{[]string{"MSETNX", "c", "3", "d", "4"}, ":1\r\n"},
+		{[]string{"MGET", "c", "d"}, "*2\r\n$1\r\n3\r\n$1\r\n4\r\n"},
+	})
+	if cmd, _ := server.CreateCommand("MSET", []string{"a", "1"}); !cmd.IsPropagatable {
+		t.Error("Expected MSET to be propagated as one command")
+	}
+}
+
+func TestMSetIsAtomic(t *testing.T) {
+	serv := newTestServer()
+	runCommand(serv, "MSET", "a", "0", "b", "0")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= 500; i++ {
+			n := strconv.Itoa(i)
+			runCommand(serv, "MSET", "a", n, "b", n)
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		got := runCommand(serv, "MGET", "a", "b")
+		parts := strings.Split(got, "\r\n")
+		if len(parts) < 5 || parts[2] != parts[4] {
+			t.Fatalf("Expected MGET to never see a partial MSET, got %q", got)
+		}
+	}
+}
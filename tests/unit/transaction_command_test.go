@@ -0,0 +1,270 @@
+package tests
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/server"
+)
+
+func TestTransaction(t *testing.T) {
+	serv := newTestServer()
+	client := &server.Client{}
+	runCommand(serv, "SET", "name", "redis")
+	runClientCases(t, serv, client, []commandCase{
+		{[]string{"EXEC"}, "-ERR EXEC without MULTI\r\n"},
+		{[]string{"DISCARD"}, "-ERR DISCARD without MULTI\r\n"},
+		{[]string{"MULTI"}, "+OK\r\n"},
+		{[]string{"MULTI"}, "-ERR MULTI calls can not be nested\r\n"},
+		{[]string{"INCR", "counter"}, "+QUEUED\r\n"},
+		{[]string{"INCR", "name"}, "+QUEUED\r\n"},
+		{[]string{"RPUSH", "list", "a", "b"}, "+QUEUED\r\n"},
+		{[]string{"GET", "counter"}, "+QUEUED\r\n"},
+	})
+	if got := runCommand(serv, "EXISTS", "counter"); got != ":0\r\n" {
+		t.Errorf("Expected queued commands not to run before EXEC, got %q", got)
+	}
+	want := "*4\r\n:1\r\n-ERR value is not an integer or out of range\r\n:2\r\n+1\r\n"
+	if got := runClientCommand(serv, client, "EXEC"); got != want {
+		t.Errorf("Expected the replies of every queued command, got %q", got)
+	}
+	runClientCases(t, serv, client, []commandCase{
+		{[]string{"GET", "counter"}, "+1\r\n"},
+		{[]string{"MULTI"}, "+OK\r\n"},
+		{[]string{"INCR", "counter"}, "+QUEUED\r\n"},
+		{[]string{"DISCARD"}, "+OK\r\n"},
+		{[]string{"GET", "counter"}, "+1\r\n"},
+		{[]string{"MULTI"}, "+OK\r\n"},
+		{[]string{"EXEC"}, "*0\r\n"},
+	})
+}
+
+func TestTransactionQueueErrors(t *testing.T) {
+	serv := newTestServer()
+	client := &server.Client{}
+	runClientCases(t, serv, client, []commandCase{
+		{[]string{"MULTI"}, "+OK\r\n"},
+		{[]string{"SET", "k", "v"}, "+QUEUED\r\n"},
+		{[]string{"GET"}, "-ERR wrong number of arguments for 'get' command\r\n"},
+		{[]string{"SET", "other", "v"}, "+QUEUED\r\n"},
+		{[]string{"EXEC"}, "-EXECABORT Transaction discarded because of previous errors.\r\n"},
+		{[]string{"EXISTS", "k", "other"}, ":0\r\n"},
+		{[]string{"EXEC"}, "-ERR EXEC without MULTI\r\n"},
+		{[]string{"MULTI"}, "+OK\r\n"},
+	})
+	unknown := server.Command{Name: "NOPE"}
+	out, _ := server.ProcessCommand(&server.Request{Serv: serv, Cmd: &unknown, Client: client})
+	if string(out) != "-ERR unknown command\r\n" {
+		t.Errorf("Expected an unknown command to be rejected, got %q", out)
+	}
+	if got := runClientCommand(serv, client, "EXEC"); got != "-EXECABORT Transaction discarded because of previous errors.\r\n" {
+		t.Errorf("Expected an unknown command to abort the transaction, got %q", got)
+	}
+}
+
+func TestTransactionPropagation(t *testing.T) {
+	serv := newTestServer(withDatabases(2))
+	serv.Role = server.Master
+	replica := &server.Replica{Pending: true}
+	serv.ConnectedReplica = &[]*server.Replica{replica}
+	client := &server.Client{}
+	for _, args := range [][]string{
+		{"MULTI"}, {"SET", "k", "v"}, {"GET", "k"}, {"SELECT", "1"}, {"RPUSH", "list", "x"}, {"EXEC"},
+	} {
+		runClientCommand(serv, client, args...)
+	}
+	want := "*1\r\n$5\r\nMULTI\r\n" +
+		"*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$1\r\nv\r\n" +
+		"*2\r\n$6\r\nSELECT\r\n$1\r\n1\r\n" +
+		"*3\r\n$5\r\nRPUSH\r\n$4\r\nlist\r\n$1\r\nx\r\n" +
+		"*1\r\n$4\r\nEXEC\r\n"
+	if got := replica.Buffer.String(); got != want {
+		t.Errorf("Expected the transaction to be propagated in MULTI / EXEC, got %q", got)
+	}
+	replica.Buffer.Reset()
+	runClientCommand(serv, client, "MULTI")
+	runClientCommand(serv, client, "LLEN", "list")
+	runClientCommand(serv, client, "EXEC")
+	if got := replica.Buffer.String(); got != "" {
+		t.Errorf("Expected a read-only transaction not to be propagated, got %q", got)
+	}
+}
+
+func TestTransactionIsAtomic(t *testing.T) {
+	serv := newTestServer()
+	runCommand(serv, "SET", "a", "0")
+	runCommand(serv, "SET", "b", "0")
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client := &server.Client{}
+			for j := 0; j < 200; j++ {
+				runClientCommand(serv, client, "MULTI")
+				runClientCommand(serv, client, "INCR", "a")
+				runClientCommand(serv, client, "INCR", "b")
+				runClientCommand(serv, client, "EXEC")
+			}
+		}()
+	}
+	client := &server.Client{}
+	for i := 0; i < 200; i++ {
+		runClientCommand(serv, client, "MULTI")
+		runClientCommand(serv, client, "GET", "a")
+		runClientCommand(serv, client, "GET", "b")
+		got := runClientCommand(serv, client, "EXEC")
+		parts := strings.Split(got, "\r\n")
+		if len(parts) != 4 || parts[0] != "*2" || parts[1] != parts[2] {
+			t.Fatalf("Expected a and b to be read together, got %q", got)
+		}
+	}
+	wg.Wait()
+	if got := runCommand(serv, "GET", "b"); got != "+800\r\n" {
+		t.Errorf("Expected every transaction to run, got %q", got)
+	}
+}
+
+func TestBlockingCommandsInTransaction(t *testing.T) {
+	serv := newTestServer()
+	blocked := make(chan string)
+	go func() { blocked <- runCommand(serv, "BLPOP", "jobs", "5") }()
+	waitBlocked(t, serv.Db, 1)
+
+	client := &server.Client{}
+	runClientCommand(serv, client, "MULTI")
+	runClientCommand(serv, client, "BLPOP", "empty", "0")
+	runClientCommand(serv, client, "XREAD", "BLOCK", "0", "STREAMS", "stream", "$")
+	runClientCommand(serv, client, "RPUSH", "jobs", "job")
+	done := make(chan string)
+	go func() { done <- runClientCommand(serv, client, "EXEC") }()
+	select {
+	case got := <-done:
+		if got != "*3\r\n*-1\r\n*-1\r\n:1\r\n" {
+			t.Errorf("Expected blocking commands to time out right away, got %q", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected EXEC not to wait for a parked client nor to block")
+	}
+	if got := <-blocked; got != "*2\r\n$4\r\njobs\r\n$3\r\njob\r\n" {
+		t.Errorf("Expected the push of the transaction to serve the parked client, got %q", got)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	serv := newTestServer()
+	client := &server.Client{}
+	runCommand(serv, "SET", "balance", "10")
+	runClientCases(t, serv, client, []commandCase{
+		{[]string{"WATCH", "balance"}, "+OK\r\n"},
+		{[]string{"MULTI"}, "+OK\r\n"},
+		{[]string{"WATCH", "other"}, "-ERR WATCH inside MULTI is not allowed\r\n"},
+		{[]string{"INCRBY", "balance", "5"}, "+QUEUED\r\n"},
+		{[]string{"EXEC"}, "*1\r\n:15\r\n"},
+		{[]string{"WATCH", "balance", "missing"}, "+OK\r\n"},
+	})
+	runCommand(serv, "SET", "balance", "0")
+	runClientCases(t, serv, client, []commandCase{
+		{[]string{"MULTI"}, "+OK\r\n"},
+		{[]string{"INCRBY", "balance", "5"}, "+QUEUED\r\n"},
+		{[]string{"EXEC"}, "*-1\r\n"},
+		{[]string{"GET", "balance"}, "+0\r\n"},
+		// EXEC unwatched the keys
+		{[]string{"MULTI"}, "+OK\r\n"},
+		{[]string{"INCRBY", "balance", "5"}, "+QUEUED\r\n"},
+		{[]string{"EXEC"}, "*1\r\n:5\r\n"},
+		{[]string{"WATCH", "balance"}, "+OK\r\n"},
+		{[]string{"UNWATCH"}, "+OK\r\n"},
+	})
+	runCommand(serv, "DEL", "balance")
+	runClientCases(t, serv, client, []commandCase{
+		{[]string{"MULTI"}, "+OK\r\n"},
+		{[]string{"EXEC"}, "*0\r\n"},
+	})
+
+	// reads and writes that change nothing do not touch the key
+	runCommand(serv, "RPUSH", "list", "a")
+	runClientCommand(serv, client, "WATCH", "list")
+	runCommand(serv, "LRANGE", "list", "0", "-1")
+	runCommand(serv, "LREM", "list", "0", "missing")
+	runCommand(serv, "SADD", "list", "x")
+	runClientCommand(serv, client, "MULTI")
+	if got := runClientCommand(serv, client, "EXEC"); got != "*0\r\n" {
+		t.Errorf("Expected commands that did not modify the key to keep the watch, got %q", got)
+	}
+}
+
+func TestWatchInvalidatedByEveryWrite(t *testing.T) {
+	serv := newTestServer(withDatabases(2))
+	for _, tc := range []struct {
+		watched string
+		write   []string
+	}{
+		{"list", []string{"LPUSH", "list", "x"}},
+		{"list", []string{"LSET", "list", "0", "y"}},
+		{"hash", []string{"HSET", "hash", "f", "v"}},
+		{"set", []string{"SREM", "set", "a"}},
+		{"zset", []string{"ZINCRBY", "zset", "1", "m"}},
+		{"stream", []string{"XADD", "stream", "*", "f", "v"}},
+		{"str", []string{"EXPIRE", "str", "100"}},
+		{"renamed", []string{"RENAME", "str", "renamed"}},
+		{"str", []string{"MOVE", "str", "1"}},
+		{"str", []string{"FLUSHDB"}},
+		{"str", []string{"SWAPDB", "0", "1"}},
+	} {
+		runCommand(serv, "FLUSHALL")
+		runCommand(serv, "SET", "str", "v")
+		runCommand(serv, "RPUSH", "list", "a")
+		runCommand(serv, "SADD", "set", "a")
+		client := &server.Client{}
+		runClientCommand(serv, client, "WATCH", tc.watched)
+		runCommand(serv, tc.write...)
+		runClientCommand(serv, client, "MULTI")
+		if got := runClientCommand(serv, client, "EXEC"); got != "*-1\r\n" {
+			t.Errorf("Expected %v to abort the transaction watching %s, got %q", tc.write, tc.watched, got)
+		}
+	}
+	// flushing a database does not touch the watched keys it did not hold
+	client := &server.Client{}
+	runClientCommand(serv, client, "WATCH", "missing")
+	runCommand(serv, "FLUSHDB")
+	runClientCommand(serv, client, "MULTI")
+	if got := runClientCommand(serv, client, "EXEC"); got != "*0\r\n" {
+		t.Errorf("Expected FLUSHDB to keep the watch of a missing key, got %q", got)
+	}
+}
+
+func TestWatchExpiredKeys(t *testing.T) {
+	serv := newTestServer()
+	client := &server.Client{}
+	runCommand(serv, "SET", "gone", "v", "PX", "1")
+	time.Sleep(5 * time.Millisecond)
+	// watching a key already expired, then deleted, does not abort
+	runClientCommand(serv, client, "WATCH", "gone")
+	runCommand(serv, "EXISTS", "gone")
+	server.ActiveExpireCycle(serv)
+	runClientCommand(serv, client, "MULTI")
+	if got := runClientCommand(serv, client, "EXEC"); got != "*0\r\n" {
+		t.Errorf("Expected the deletion of an already expired key to keep the watch, got %q", got)
+	}
+
+	runCommand(serv, "SET", "volatile", "v", "PX", "20")
+	runClientCommand(serv, client, "WATCH", "volatile")
+	time.Sleep(30 * time.Millisecond)
+	runClientCommand(serv, client, "MULTI")
+	if got := runClientCommand(serv, client, "EXEC"); got != "*-1\r\n" {
+		t.Errorf("Expected a key expiring after WATCH to abort, got %q", got)
+	}
+	runCommand(serv, "SET", "volatile", "v", "PX", "20")
+	runClientCommand(serv, client, "WATCH", "volatile")
+	time.Sleep(30 * time.Millisecond)
+	if deleted := server.ActiveExpireCycle(serv); deleted != 1 {
+		t.Fatalf("Expected the cycle to delete the key, deleted %d", deleted)
+	}
+	runClientCommand(serv, client, "MULTI")
+	if got := runClientCommand(serv, client, "EXEC"); got != "*-1\r\n" {
+		t.Errorf("Expected the active expiry of a watched key to abort, got %q", got)
+	}
+}
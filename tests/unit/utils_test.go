@@ -142,3 +142,47 @@ func TestGenerateID_Length(t *testing.T) {
 		}
 	}
 }
+
+func TestStringMatch(t *testing.T) {
+	cases := []struct {
+		pattern string
+		s       string
+		nocase  bool
+		want    bool
+	}{
+		{"*", "anything", false, true},
+		{"h?llo", "hello", false, true},
+		{"h?llo", "hllo", false, false},
+		{"h*llo", "heeeello", false, true},
+		{"h*llo", "hllo", false, true},
+		{"h[ae]llo", "hallo", false, true},
+		{"h[ae]llo", "hillo", false, false},
+		{"h[^e]llo", "hallo", false, true},
+		{"h[^e]llo", "hello", false, false},
+		{"h[a-b]llo", "hbllo", false, true},
+		{"h[b-a]llo", "hbllo", false, true},
+		{"h[a-b]llo", "hcllo", false, false},
+		{"user:*", "user:1/profile", false, true},
+		{"a/*/c", "a/b/c", false, true},
+		{`h\*llo`, "h*llo", false, true},
+		{`h\*llo`, "hello", false, false},
+		{`h[\]]llo`, "h]llo", false, true},
+		{"HELLO", "hello", false, false},
+		{"HELLO", "hello", true, true},
+		{"h[A-C]llo", "hbllo", true, true},
+		{"h[", "h", false, false},
+		{"h[ab", "ha", false, true},
+		{`abc\`, `abc\`, false, true},
+		{"[]", "a", false, false},
+		{"a**b", "ab", false, true},
+		{"a*", "a", false, true},
+		{"*a*b*c*", "xxaxxbxxcxx", false, true},
+		{"*a*b*c*", "xxaxxcxxbxx", false, false},
+		{strings.Repeat("a*", 50) + "b", strings.Repeat("a", 60), false, false},
+	}
+	for _, c := range cases {
+		if got := utils.StringMatch(c.pattern, c.s, c.nocase); got != c.want {
+			t.Errorf("StringMatch(%q, %q, %v) = %v, want %v", c.pattern, c.s, c.nocase, got, c.want)
+		}
+	}
+}
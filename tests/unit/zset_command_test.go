@@ -0,0 +1,132 @@
+package tests
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/codecrafters-io/redis-starter-go/app/engine"
+	"github.com/codecrafters-io/redis-starter-go/app/rdb"
+)
+
+func TestSkipListRanks(t *testing.T) {
+	sl := engine.NewSkipList()
+	scores := make([]float64, 0, 500)
+	for i := 0; i < 500; i++ {
+		score := float64((i * 7919) % 500)
+		scores = append(scores, score)
+		sl.Insert(score, fmt.Sprintf("m%d", i))
+	}
+	sort.Float64s(scores)
+	for rank := 1; rank <= 500; rank++ {
+		node := sl.ByRank(rank)
+		if node == nil || node.Score != scores[rank-1] {
+			t.Fatalf("ByRank(%d) returned %v, want score %v", rank, node, scores[rank-1])
+		}
+		if got := sl.Rank(node.Score, node.Member); got != rank {
+			t.Fatalf("Rank(%v, %s) = %d, want %d", node.Score, node.Member, got, rank)
+		}
+	}
+	for i := 0; i < 500; i += 2 {
+		if !sl.Delete(float64((i*7919)%500), fmt.Sprintf("m%d", i)) {
+			t.Fatalf("Delete of m%d failed", i)
+		}
+	}
+	if sl.Len() != 250 {
+		t.Errorf("Expected 250 nodes after deletes, got %d", sl.Len())
+	}
+	prev := -1.0
+	for node := sl.ByRank(1); node != nil; node = node.Next() {
+		if node.Score < prev {
+			t.Fatalf("List out of order at %v", node.Score)
+		}
+		prev = node.Score
+	}
+}
+
+func TestZAddFlags(t *testing.T) {
+	serv := newTestServer()
+	runCases(t, serv, []commandCase{
+		{[]string{"ZADD", "z", "1", "a", "2", "b"}, ":2\r\n"},
+		{[]string{"ZADD", "z", "NX", "5", "a", "3", "c"}, ":1\r\n"},
+		{[]string{"ZSCORE", "z", "a"}, "$1\r\n1\r\n"},
+		{[]string{"ZADD", "z", "XX", "CH", "5", "a", "9", "d"}, ":1\r\n"},
+		{[]string{"ZSCORE", "z", "d"}, "$-1\r\n"},
+		{[]string{"ZADD", "z", "GT", "CH", "4", "a", "1", "b"}, ":0\r\n"},
+		{[]string{"ZADD", "z", "LT", "CH", "4", "a", "1", "b"}, ":2\r\n"},
+		{[]string{"ZADD", "z", "INCR", "1.5", "a"}, "$3\r\n5.5\r\n"},
+		{[]string{"ZADD", "z", "NX", "INCR", "1", "a"}, "$-1\r\n"},
+		{[]string{"ZADD", "z", "NX", "XX", "1", "a"}, "-ERR XX and NX options at the same time are not compatible\r\n"},
+		{[]string{"ZADD", "z", "GT", "LT", "1", "a"}, "-ERR GT, LT, and/or NX options at the same time are not compatible\r\n"},
+		{[]string{"ZADD", "z", "INCR", "1", "a", "2", "b"}, "-ERR INCR option supports a single increment-element pair\r\n"},
+		{[]string{"ZADD", "z", "x", "a"}, "-ERR value is not a valid float\r\n"},
+		{[]string{"ZADD", "z", "1", "a", "2"}, "-ERR syntax error\r\n"},
+		{[]string{"ZINCRBY", "z", "-0.5", "a"}, "$1\r\n5\r\n"},
+		{[]string{"ZADD", "z2", "XX", "1", "a"}, ":0\r\n"},
+	})
+	if _, ok := (*serv.Db.Dict)["z2"]; ok {
+		t.Error("ZADD XX on a missing key must not create it")
+	}
+}
+
+func TestZRange(t *testing.T) {
+	serv := newTestServer()
+	runCommand(serv, "ZADD", "z", "1", "a", "2", "b", "3", "c", "4", "d", "5", "e")
+	runCommand(serv, "ZADD", "lex", "0", "a", "0", "b", "0", "c", "0", "d")
+	runCases(t, serv, []commandCase{
+		{[]string{"ZRANGE", "z", "0", "1"}, "*2\r\n$1\r\na\r\n$1\r\nb\r\n"},
+		{[]string{"ZRANGE", "z", "-2", "-1", "WITHSCORES"}, "*4\r\n$1\r\nd\r\n$1\r\n4\r\n$1\r\ne\r\n$1\r\n5\r\n"},
+		{[]string{"ZRANGE", "z", "0", "1", "REV"}, "*2\r\n$1\r\ne\r\n$1\r\nd\r\n"},
+		{[]string{"ZRANGE", "z", "(1", "3", "BYSCORE"}, "*2\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+		{[]string{"ZRANGE", "z", "+inf", "-inf", "BYSCORE", "REV", "LIMIT", "1", "2"}, "*2\r\n$1\r\nd\r\n$1\r\nc\r\n"},
+		{[]string{"ZRANGE", "z", "0", "1", "LIMIT", "0", "1"}, "-ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX\r\n"},
+		{[]string{"ZRANGE", "lex", "[b", "(d", "BYLEX"}, "*2\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+		{[]string{"ZRANGE", "lex", "+", "-", "BYLEX", "REV", "LIMIT", "0", "2"}, "*2\r\n$1\r\nd\r\n$1\r\nc\r\n"},
+		{[]string{"ZRANGE", "lex", "a", "b", "BYLEX"}, "-ERR min or max not valid string range item\r\n"},
+		{[]string{"ZRANGEBYSCORE", "z", "2", "4", "LIMIT", "1", "-1"}, "*2\r\n$1\r\nc\r\n$1\r\nd\r\n"},
+		{[]string{"ZREVRANGEBYSCORE", "z", "4", "(2"}, "*2\r\n$1\r\nd\r\n$1\r\nc\r\n"},
+		{[]string{"ZREVRANGE", "z", "0", "0", "WITHSCORES"}, "*2\r\n$1\r\ne\r\n$1\r\n5\r\n"},
+		{[]string{"ZRANGEBYLEX", "lex", "-", "[a"}, "*1\r\n$1\r\na\r\n"},
+		{[]string{"ZCOUNT", "z", "(1", "+inf"}, ":4\r\n"},
+		{[]string{"ZLEXCOUNT", "lex", "[b", "+"}, ":3\r\n"},
+		{[]string{"ZRANK", "z", "c"}, ":2\r\n"},
+		{[]string{"ZREVRANK", "z", "c", "WITHSCORE"}, "*2\r\n:2\r\n$1\r\n3\r\n"},
+		{[]string{"ZRANK", "z", "missing"}, "$-1\r\n"},
+		{[]string{"ZMSCORE", "z", "a", "missing"}, "*2\r\n$1\r\n1\r\n$-1\r\n"},
+	})
+}
+
+func TestZPopAndRemove(t *testing.T) {
+	serv := newTestServer()
+	runCommand(serv, "ZADD", "z", "1", "a", "2", "b", "3", "c", "4", "d", "5", "e")
+	runCases(t, serv, []commandCase{
+		{[]string{"ZPOPMIN", "z"}, "*2\r\n$1\r\na\r\n$1\r\n1\r\n"},
+		{[]string{"ZPOPMAX", "z", "2"}, "*4\r\n$1\r\ne\r\n$1\r\n5\r\n$1\r\nd\r\n$1\r\n4\r\n"},
+		{[]string{"ZREM", "z", "b", "missing"}, ":1\r\n"},
+		{[]string{"ZCARD", "z"}, ":1\r\n"},
+		{[]string{"ZADD", "z", "10", "x", "20", "y"}, ":2\r\n"},
+		{[]string{"ZREMRANGEBYSCORE", "z", "-inf", "(20"}, ":2\r\n"},
+		{[]string{"ZREMRANGEBYRANK", "z", "0", "-1"}, ":1\r\n"},
+		{[]string{"ZCARD", "z"}, ":0\r\n"},
+		{[]string{"ZPOPMIN", "z"}, "*0\r\n"},
+	})
+}
+
+func TestZSetRDBRoundTrip(t *testing.T) {
+	zset := engine.NewRedisZSet()
+	zset.Add("alice", 10)
+	zset.Add("bob", 2.5)
+	dict := map[string]engine.RedisObj{"board": zset}
+	path := filepath.Join(t.TempDir(), "dump.rdb")
+	if err := rdb.GenerateRDBFile(&dict, path); err != nil {
+		t.Fatalf("GenerateRDBFile failed: %v", err)
+	}
+	loaded, ok := rdb.Encode(path)["board"].(engine.RedisZSet)
+	if !ok {
+		t.Fatal("Expected board to load as a sorted set")
+	}
+	if rank, _ := loaded.Rank("alice"); rank != 1 || loaded.Data["bob"] != 2.5 {
+		t.Errorf("Unexpected sorted set contents %v", loaded.Data)
+	}
+}